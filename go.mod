@@ -1,5 +1,13 @@
 module github.com/phbarton/Telemetry-Go
 
-go 1.15
+go 1.21
 
-require github.com/microsoft/ApplicationInsights-Go v0.4.3
+require (
+	github.com/microsoft/ApplicationInsights-Go v0.4.3
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	code.cloudfoundry.org/clock v0.0.0-20180518195852-02e53af36e6c // indirect
+	github.com/satori/go.uuid v1.2.0 // indirect
+)
@@ -0,0 +1,20 @@
+package telemetry
+
+import "time"
+
+// Clock provides the current time to trace listeners and duration traces, so that timestamps and durations can be controlled in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// SystemClock returns the Clock backed by the system time
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (sc systemClock) Now() time.Time {
+	return time.Now()
+}
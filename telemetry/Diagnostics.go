@@ -0,0 +1,52 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrTraceDone is reported through the diagnostics handler when a duration trace is used after it is done, e.g. when Done is called twice
+// or Fail is called after Done. The call is ignored, so the trace is only recorded once.
+var ErrTraceDone = errors.New("the duration trace is already done")
+
+// ErrListenerPanicked is reported through the diagnostics handler when a trace listener, or one of its duration traces, panics. The panic
+// is recovered, so that it reaches neither the application nor the other listeners.
+var ErrListenerPanicked = errors.New("a trace listener panicked")
+
+var diagnosticsHandler atomic.Pointer[func(err error)]
+
+// SetDiagnosticsHandler sets the function which is called with the errors in the use of the telemetry which are otherwise ignored, such as
+// ErrTraceDone. The handler may be called from any goroutine, so it must be safe for concurrent use. Nil, the default, discards them.
+func SetDiagnosticsHandler(handler func(err error)) {
+	if handler == nil {
+		diagnosticsHandler.Store(nil)
+		return
+	}
+
+	diagnosticsHandler.Store(&handler)
+}
+
+// ReportDiagnostic passes the error to the diagnostics handler, if one is set. It is used by trace listeners and duration traces to report
+// their misuse.
+func ReportDiagnostic(err error) {
+	if handler := diagnosticsHandler.Load(); handler != nil {
+		(*handler)(err)
+	}
+}
+
+// reportTraceDone reports the call of a method on a duration trace which is already done
+func reportTraceDone(method string, description string) {
+	ReportDiagnostic(fmt.Errorf("%v called on the %v: %w", method, description, ErrTraceDone))
+}
+
+// protectListener calls the named method of a trace listener or duration trace, recovering a panic and reporting it as ErrListenerPanicked
+func protectListener(method string, call func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			ReportDiagnostic(fmt.Errorf("%w in %v: %v", ErrListenerPanicked, method, r))
+		}
+	}()
+
+	call()
+}
@@ -0,0 +1,412 @@
+package telemetry
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what happens to an item when the asynchronous dispatch queue is full
+type OverflowPolicy int32
+
+const (
+	// Block waits for space in the queue, slowing the caller down to the speed of the listeners
+	Block OverflowPolicy = 0
+
+	// Drop discards the item, counting it in DroppedItems
+	Drop OverflowPolicy = 1
+)
+
+const (
+	// DefaultQueueSize is the capacity of each dispatch queue when the DispatchOptions do not specify one
+	DefaultQueueSize int = 1024
+)
+
+// DispatchOptions configures asynchronous dispatch
+type DispatchOptions struct {
+	// Workers is the number of queues, each with a goroutine delivering its items to the listeners. Items of the same operation always use
+	// the same queue, so they are delivered in the order they were traced. Items without an operation ID all use the first queue, so they
+	// too are delivered in order, but only items traced in operations are spread across the other workers. Defaults to 1, which delivers
+	// every item in the order it was traced.
+	Workers int
+
+	// QueueSize is the capacity of each queue, which bounds the memory used by items waiting to be delivered. Defaults to DefaultQueueSize.
+	QueueSize int
+
+	// Overflow decides what happens when a queue is full. Defaults to Block.
+	Overflow OverflowPolicy
+
+	// Clock timestamps the items as they are queued. Defaults to the SystemClock.
+	Clock Clock
+}
+
+type dispatchEntry struct {
+	item    *Item
+	trace   *asyncDurationTrace
+	finish  bool
+	barrier chan struct{}
+}
+
+type dispatcher struct {
+	mutex    sync.RWMutex
+	queues   []chan dispatchEntry
+	overflow OverflowPolicy
+	clock    Clock
+	stopped  bool
+	stopping chan struct{}
+	senders  sync.WaitGroup
+	workers  sync.WaitGroup
+}
+
+var (
+	activeDispatcher atomic.Pointer[dispatcher]
+	droppedItems     atomic.Uint64
+)
+
+// StartAsyncDispatch changes the package-level functions from delivering items to the listeners on the caller's goroutine to queueing them
+// for worker goroutines to deliver. Each item is copied and timestamped as it is queued. TracePanic is always delivered on the caller's
+// goroutine, as the panic can only be recovered there. Any previous asynchronous dispatch is stopped first.
+func StartAsyncDispatch(options DispatchOptions) {
+	StopAsyncDispatch()
+
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+
+	if options.Clock == nil {
+		options.Clock = SystemClock()
+	}
+
+	d := &dispatcher{
+		queues:   make([]chan dispatchEntry, options.Workers),
+		overflow: options.Overflow,
+		clock:    options.Clock,
+		stopping: make(chan struct{}),
+	}
+
+	for i := range d.queues {
+		d.queues[i] = make(chan dispatchEntry, options.QueueSize)
+		d.workers.Add(1)
+
+		go d.work(d.queues[i])
+	}
+
+	activeDispatcher.Store(d)
+}
+
+// StopAsyncDispatch delivers the items which are still queued, then returns to delivering items on the caller's goroutine. Callers
+// waiting for space in a queue stop waiting, and deliver their items themselves.
+func StopAsyncDispatch() {
+	d := activeDispatcher.Swap(nil)
+	if d == nil {
+		return
+	}
+
+	d.mutex.Lock()
+	d.stopped = true
+	close(d.stopping)
+	d.mutex.Unlock()
+
+	d.senders.Wait()
+
+	for _, queue := range d.queues {
+		close(queue)
+	}
+
+	d.workers.Wait()
+}
+
+// DroppedItems returns the number of items which have been discarded because a dispatch queue was full
+func DroppedItems() uint64 {
+	return droppedItems.Load()
+}
+
+// traceItem queues a copy of the item. It returns false if the dispatcher has been stopped, so that the item can be delivered directly.
+func (d *dispatcher) traceItem(item *Item) bool {
+	if d.enqueue(d.shard(item), dispatchEntry{item: d.stamp(item)}, d.overflow == Block) {
+		return true
+	}
+
+	return !d.isStopped()
+}
+
+// trackItem queues a copy of the item, returning a trace which queues its outcome when it is done. If the dispatcher has been stopped,
+// nil is returned so that the item can be delivered directly.
+func (d *dispatcher) trackItem(item *Item) *DurationTrace {
+	queued := d.stamp(item)
+	trace := &asyncDurationTrace{TraceState: NewTraceState(item.Describe(), d.clock, queued.Timestamp), dispatcher: d, shard: d.shard(item), item: item}
+
+	if !d.enqueue(trace.shard, dispatchEntry{item: queued, trace: trace}, d.overflow == Block) {
+		if d.isStopped() {
+			return nil
+		}
+
+		trace.dropped = true
+	}
+
+	var dt DurationTrace = trace
+	return &dt
+}
+
+// flush waits until every item queued so far has been delivered
+func (d *dispatcher) flush() {
+	barriers := make([]chan struct{}, 0, len(d.queues))
+
+	for i := range d.queues {
+		barrier := make(chan struct{})
+
+		if d.enqueue(i, dispatchEntry{barrier: barrier}, true) {
+			barriers = append(barriers, barrier)
+		}
+	}
+
+	for _, barrier := range barriers {
+		<-barrier
+	}
+}
+
+// enqueue adds the entry to the queue, waiting for space if block is set. It returns false if the entry was not queued, including when
+// the dispatcher is stopped while waiting. The lock is not held while waiting, so that stopping is never held up by a full queue; the
+// queues are only closed once every caller has stopped sending.
+func (d *dispatcher) enqueue(shard int, entry dispatchEntry, block bool) bool {
+	d.mutex.RLock()
+
+	if d.stopped {
+		d.mutex.RUnlock()
+		return false
+	}
+
+	d.senders.Add(1)
+	d.mutex.RUnlock()
+
+	defer d.senders.Done()
+
+	if block {
+		select {
+		case d.queues[shard] <- entry:
+			return true
+
+		case <-d.stopping:
+			return false
+		}
+	}
+
+	select {
+	case d.queues[shard] <- entry:
+		return true
+
+	default:
+		droppedItems.Add(1)
+		return false
+	}
+}
+
+func (d *dispatcher) isStopped() bool {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.stopped
+}
+
+func (d *dispatcher) stamp(item *Item) *Item {
+	queued := item.Clone()
+
+	if queued.Timestamp.IsZero() {
+		queued.Timestamp = d.clock.Now()
+	}
+
+	return queued
+}
+
+// shard chooses the queue for the item: the same queue for every item of an operation, and the first queue for every item without one
+func (d *dispatcher) shard(item *Item) int {
+	if len(d.queues) == 1 || item.OperationID == "" {
+		return 0
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(item.OperationID))
+
+	return int(hash.Sum64() % uint64(len(d.queues)))
+}
+
+func (d *dispatcher) work(queue chan dispatchEntry) {
+	defer d.workers.Done()
+
+	for entry := range queue {
+		switch {
+		case entry.barrier != nil:
+			close(entry.barrier)
+		case entry.finish:
+			entry.trace.deliverOutcome()
+		case entry.trace != nil:
+			entry.trace.inner = deliverTrackItem(entry.item)
+		default:
+			deliverItem(entry.item)
+		}
+	}
+}
+
+// asyncDurationTrace records the outcome of a tracked activity on the caller's goroutine, and queues it for delivery when the trace is done.
+// The inner trace is created and used only by the worker goroutine of its queue.
+type asyncDurationTrace struct {
+	TraceState
+	dispatcher *dispatcher
+	shard      int
+	item       *Item
+	dropped    bool
+	inner      *DurationTrace
+	reported   bool
+	success    bool
+	statusCode string
+	details    Item
+}
+
+// Complete indicates a successful completion of the measured duration activity
+func (adt *asyncDurationTrace) Complete() {
+	adt.Update("Complete", func() {
+		adt.reported = true
+		adt.success = true
+		adt.statusCode = "OK"
+	})
+}
+
+// Fail indicates an unsuccessful completion of the measured duration activity
+func (adt *asyncDurationTrace) Fail(statusCode string) {
+	adt.Update("Fail", func() {
+		adt.reported = true
+		adt.success = false
+		adt.statusCode = statusCode
+	})
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (adt *asyncDurationTrace) CompleteWithStatus(statusCode string) {
+	adt.Update("CompleteWithStatus", func() {
+		adt.reported = true
+		adt.success = true
+		adt.statusCode = statusCode
+	})
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code, which is delivered in its text form
+func (adt *asyncDurationTrace) SetStatusCode(code int) {
+	adt.Update("SetStatusCode", func() {
+		adt.reported = true
+		adt.success = IsSuccessStatusCode(code)
+		adt.statusCode = strconv.Itoa(code)
+	})
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity, which is queued in the same way as its parent. The
+// children of a trace which was dropped are dropped too.
+func (adt *asyncDurationTrace) StartChild(name string) *DurationTrace {
+	var child *Item
+
+	if !adt.Update("StartChild", func() { child = NewChildItem(adt.item, name) }) || adt.dropped {
+		return NoopDurationTrace()
+	}
+
+	return trackItemImpl(child)
+}
+
+// SetProperty sets a custom named value of the measured duration activity
+func (adt *asyncDurationTrace) SetProperty(name string, value string) {
+	adt.Update("SetProperty", func() { adt.details.SetProperty(name, value) })
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+func (adt *asyncDurationTrace) SetMeasurement(name string, value float64) {
+	adt.Update("SetMeasurement", func() { adt.details.SetMeasurement(name, value) })
+}
+
+// SetSource sets the source of a request
+func (adt *asyncDurationTrace) SetSource(source string) {
+	adt.Update("SetSource", func() { adt.details.Source = source })
+}
+
+// SetURL sets the full URL of a request
+func (adt *asyncDurationTrace) SetURL(url string) {
+	adt.Update("SetURL", func() { adt.details.URL = url })
+}
+
+// SetData sets the command of a dependency call
+func (adt *asyncDurationTrace) SetData(data string) {
+	adt.Update("SetData", func() { adt.details.Data = data })
+}
+
+// SetRunLocation sets where an availability test ran
+func (adt *asyncDurationTrace) SetRunLocation(location string) {
+	adt.Update("SetRunLocation", func() { adt.details.RunLocation = location })
+}
+
+// Done indicates that the trace is complete and should be committed to the telemetry source
+func (adt *asyncDurationTrace) Done() {
+	adt.DoneAt(adt.dispatcher.clock.Now())
+}
+
+// DoneAt queues the outcome of the trace, as ending at the specified time, for delivery after its start. If the dispatcher has since been
+// stopped, the start has already been delivered, so the outcome is delivered directly.
+func (adt *asyncDurationTrace) DoneAt(end time.Time) {
+	if !adt.Finish(end) || adt.dropped {
+		return
+	}
+
+	if !adt.dispatcher.enqueue(adt.shard, dispatchEntry{trace: adt, finish: true}, true) {
+		adt.dispatcher.workers.Wait()
+		adt.deliverOutcome()
+	}
+}
+
+func (adt *asyncDurationTrace) deliverOutcome() {
+	if adt.inner == nil {
+		return
+	}
+
+	setDetails(adt.inner, &adt.details)
+
+	switch {
+	case !adt.reported:
+	case adt.success && adt.statusCode == "OK":
+		(*adt.inner).Complete()
+	case adt.success:
+		(*adt.inner).CompleteWithStatus(adt.statusCode)
+	default:
+		(*adt.inner).Fail(adt.statusCode)
+	}
+
+	DoneAt(adt.inner, adt.end)
+}
+
+// setDetails passes the properties, measurements and kind-specific details which were set on a trace to another trace
+func setDetails(trace *DurationTrace, details *Item) {
+	for name, value := range details.Properties {
+		(*trace).SetProperty(name, value)
+	}
+
+	for name, value := range details.Measurements {
+		(*trace).SetMeasurement(name, value)
+	}
+
+	if details.Source != "" {
+		(*trace).SetSource(details.Source)
+	}
+
+	if details.URL != "" {
+		(*trace).SetURL(details.URL)
+	}
+
+	if details.Data != "" {
+		(*trace).SetData(details.Data)
+	}
+
+	if details.RunLocation != "" {
+		(*trace).SetRunLocation(details.RunLocation)
+	}
+}
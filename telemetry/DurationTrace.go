@@ -1,5 +1,11 @@
 package telemetry
 
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
 // DurationTrace provides an interface for those traces which require a duration
 type DurationTrace interface {
 	// Complete indicates a successful completion of the measured duration activity
@@ -8,6 +14,229 @@ type DurationTrace interface {
 	// Fail indicates an unsuccessful completion of the measured duration activity
 	Fail(statusCode string)
 
-	// Done indicates that the trace is complete and should be committed to the telemetry source
+	// CompleteWithStatus indicates a successful completion of the measured duration activity with a status code other than "OK", e.g. "204"
+	CompleteWithStatus(statusCode string)
+
+	// SetStatusCode indicates the completion of the measured duration activity with a numeric status code, such as an HTTP status code,
+	// which is successful or not as classified by IsSuccessStatusCode
+	SetStatusCode(code int)
+
+	// Done indicates that the trace is complete and should be committed to the telemetry source. If neither Complete nor Fail (nor their
+	// variants) was called first, the trace is reported as incomplete, distinctly from a failure, as this is usually a mistake. The trace is
+	// only committed once: calling Done again, or any other method after it, is ignored and reported as ErrTraceDone to the diagnostics
+	// handler. A trace is safe for concurrent use.
 	Done()
+
+	// Finished indicates whether Done has been called
+	Finished() bool
+
+	// Duration returns the time taken by the measured duration activity, which is the time elapsed so far until the trace is done
+	Duration() time.Duration
+
+	// StartChild starts the trace of a named phase of the measured duration activity, e.g. "validate" or "render" within a request, as an
+	// in-process dependency which records this trace as its parent. The child is done separately, normally before its parent.
+	StartChild(name string) *DurationTrace
+
+	// SetProperty sets a custom named value of the measured duration activity
+	SetProperty(name string, value string)
+
+	// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+	SetMeasurement(name string, value float64)
+
+	// SetSource sets the source of a request, e.g. the ID of the calling application. It is ignored by other traces.
+	SetSource(source string)
+
+	// SetURL sets the full URL of a request, e.g. when it was tracked with a route template as its URI. It is ignored by other traces.
+	SetURL(url string)
+
+	// SetData sets the command of a dependency call, e.g. the SQL statement or the full URL. It is ignored by other traces.
+	SetData(data string)
+
+	// SetRunLocation sets where an availability test ran. It is ignored by other traces.
+	SetRunLocation(location string)
+}
+
+// TimedDurationTrace is implemented by duration traces which can be done at a time other than now, such as when the trace is delivered
+// to the listeners asynchronously
+type TimedDurationTrace interface {
+	DurationTrace
+
+	// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source
+	DoneAt(end time.Time)
+}
+
+// DoneAt commits the trace as ending at the specified time if it implements TimedDurationTrace, or calls Done otherwise
+func DoneAt(trace *DurationTrace, end time.Time) {
+	if timed, ok := (*trace).(TimedDurationTrace); ok {
+		timed.DoneAt(end)
+		return
+	}
+
+	(*trace).Done()
 }
+
+// End completes the trace, or fails it with ErrorStatusCode if the error that err points to is not nil, and then marks it as done. It is
+// meant to be deferred with the named error result of the traced function:
+//
+//	func loadOrders(ctx context.Context) (err error) {
+//		defer telemetry.End(telemetry.TrackDependencyContext(ctx, "orders", "SQL", "server"), &err)
+//		...
+//	}
+//
+// The text of the error is set as the "error" property. When End is deferred directly, a panic in the function is recovered, recorded as
+// the "panic" property of a trace failed with PanicStatusCode, and then continued once the trace is done.
+func End(trace *DurationTrace, err *error) {
+	if r := recover(); r != nil {
+		(*trace).SetProperty("panic", fmt.Sprint(r))
+		(*trace).Fail(PanicStatusCode)
+		(*trace).Done()
+
+		panic(r)
+	}
+
+	if err != nil && *err != nil {
+		(*trace).SetProperty("error", (*err).Error())
+		(*trace).Fail(ErrorStatusCode)
+	} else {
+		(*trace).Complete()
+	}
+
+	(*trace).Done()
+}
+
+const (
+	// IncompleteStatusCode is the status code of a trace which is done without being completed or failed
+	IncompleteStatusCode = "Incomplete"
+
+	// ErrorStatusCode is the status code with which End fails a trace whose function returned an error
+	ErrorStatusCode = "Error"
+
+	// PanicStatusCode is the status code with which End fails a trace whose function panicked
+	PanicStatusCode = "Panic"
+)
+
+// IsSuccessStatusCode indicates whether a numeric status code is successful, in the way that ApplicationInsights classifies HTTP status
+// codes: the informational, success and redirection codes below 400 are successful, and the client and server error codes are not
+func IsSuccessStatusCode(code int) bool {
+	return code > 0 && code < 400
+}
+
+// TraceState keeps whether a duration trace is done, and when it started and ended, on behalf of the implementations of DurationTrace, which
+// embed it to provide Finished and Duration. Its lock guards the rest of the trace's state, so that the trace is safe for concurrent use
+// and is only committed once.
+type TraceState struct {
+	mutex       sync.Mutex
+	description string
+	clock       Clock
+	start       time.Time
+	end         time.Time
+	finished    bool
+}
+
+// NewTraceState creates the state of a trace of the described activity, e.g. "request GET /orders", which started at the time given, by
+// the clock
+func NewTraceState(description string, clock Clock, start time.Time) TraceState {
+	return TraceState{description: description, clock: clock, start: start}
+}
+
+// Update runs the change to the trace while holding its lock, and returns true, unless the trace is done. The call of the named method is
+// then reported as ErrTraceDone and false is returned.
+func (ts *TraceState) Update(method string, change func()) bool {
+	ts.mutex.Lock()
+	finished := ts.finished
+
+	if !finished {
+		change()
+	}
+
+	ts.mutex.Unlock()
+
+	if finished {
+		reportTraceDone(method, ts.description)
+	}
+
+	return !finished
+}
+
+// Finish marks the trace as done at the end time, and returns true, unless it was already done. The call is then reported as ErrTraceDone
+// and false is returned. Once the trace is done no change can be made to it, so its state can be read without the lock to commit it.
+func (ts *TraceState) Finish(end time.Time) bool {
+	ts.mutex.Lock()
+	finished := ts.finished
+
+	if !finished {
+		ts.finished = true
+		ts.end = end
+	}
+
+	ts.mutex.Unlock()
+
+	if finished {
+		reportTraceDone("Done", ts.description)
+	}
+
+	return !finished
+}
+
+// Finished indicates whether the trace is done
+func (ts *TraceState) Finished() bool {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	return ts.finished
+}
+
+// Duration returns the time from the start of the trace to its end, or to the current time of the clock while it is not done
+func (ts *TraceState) Duration() time.Duration {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if ts.finished {
+		return ts.end.Sub(ts.start)
+	}
+
+	return ts.clock.Now().Sub(ts.start)
+}
+
+type noopDurationTrace struct{}
+
+// NoopDurationTrace returns a DurationTrace which records nothing, for activities which are not traced, e.g. because they were sampled out.
+// It is never finished, and its duration is zero.
+func NoopDurationTrace() *DurationTrace {
+	var dt DurationTrace = noopDurationTrace{}
+	return &dt
+}
+
+func (noopDurationTrace) Complete() {}
+
+func (noopDurationTrace) Fail(statusCode string) {}
+
+func (noopDurationTrace) CompleteWithStatus(statusCode string) {}
+
+func (noopDurationTrace) SetStatusCode(code int) {}
+
+func (noopDurationTrace) Done() {}
+
+func (noopDurationTrace) Finished() bool {
+	return false
+}
+
+func (noopDurationTrace) Duration() time.Duration {
+	return 0
+}
+
+func (noopDurationTrace) StartChild(name string) *DurationTrace {
+	return NoopDurationTrace()
+}
+
+func (noopDurationTrace) SetProperty(name string, value string) {}
+
+func (noopDurationTrace) SetMeasurement(name string, value float64) {}
+
+func (noopDurationTrace) SetSource(source string) {}
+
+func (noopDurationTrace) SetURL(url string) {}
+
+func (noopDurationTrace) SetData(data string) {}
+
+func (noopDurationTrace) SetRunLocation(location string) {}
@@ -0,0 +1,260 @@
+package telemetry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ItemKind identifies the kind of telemetry carried by an Item
+type ItemKind int32
+
+const (
+	// MessageItem represents a message traced with a severity
+	MessageItem ItemKind = 0
+
+	// ExceptionItem represents a traced error
+	ExceptionItem ItemKind = 1
+
+	// MetricItem represents a named single-valued metric
+	MetricItem ItemKind = 2
+
+	// EventItem represents a named event
+	EventItem ItemKind = 3
+
+	// RequestItem represents a tracked service request
+	RequestItem ItemKind = 4
+
+	// DependencyItem represents a tracked call to an external service dependency
+	DependencyItem ItemKind = 5
+
+	// AvailabilityItem represents a tracked availability test
+	AvailabilityItem ItemKind = 6
+)
+
+// ToString converts the ItemKind to a readable string
+func (k ItemKind) ToString() string {
+	switch k {
+	case MessageItem:
+		return "Message"
+	case ExceptionItem:
+		return "Exception"
+	case MetricItem:
+		return "Metric"
+	case EventItem:
+		return "Event"
+	case RequestItem:
+		return "Request"
+	case DependencyItem:
+		return "Dependency"
+	case AvailabilityItem:
+		return "Availability"
+	default:
+		return "<unknown>"
+	}
+}
+
+// IsTracked indicates whether the kind is measured by a DurationTrace, i.e. it is a request, dependency or availability item
+func (k ItemKind) IsTracked() bool {
+	return k == RequestItem || k == DependencyItem || k == AvailabilityItem
+}
+
+// Item is a single unit of telemetry on its way to the trace listeners. Only the fields relevant to the Kind are set.
+type Item struct {
+	// Kind identifies the kind of telemetry
+	Kind ItemKind
+
+	// OperationID correlates the items belonging to the same logical operation, such as a request and its dependencies
+	OperationID string
+
+	// ID identifies a tracked request, dependency or availability item, so that the activities started within it can refer to it
+	ID string
+
+	// ParentID is the ID of the tracked item within which this one was started, e.g. the request of which a child trace is a phase
+	ParentID string
+
+	// Timestamp is when the item was traced, or when a tracked activity started. Zero means now, by the listener's clock.
+	Timestamp time.Time
+
+	// SampleRate is the percentage of items like this one which are kept by sampling. Zero indicates that the item was not sampled, as does 100.
+	SampleRate float64
+
+	// Message is the text of a MessageItem
+	Message string
+
+	// Severity is the severity of a MessageItem
+	Severity Severity
+
+	// Err is the error of an ExceptionItem
+	Err error
+
+	// Name is the name of a metric, event, dependency or availability item
+	Name string
+
+	// Value is the value of a MetricItem
+	Value float64
+
+	// Method is the method of a RequestItem
+	Method string
+
+	// URI is the URI of a RequestItem
+	URI string
+
+	// DependencyType is the type of a DependencyItem
+	DependencyType string
+
+	// Target is the target of a DependencyItem
+	Target string
+
+	// Source identifies the caller of a RequestItem, e.g. the ID of the calling application
+	Source string
+
+	// URL is the full URL of a RequestItem, when it differs from the URI, e.g. because the URI is a route template
+	URL string
+
+	// Data is the command of a DependencyItem, e.g. the SQL statement or the full URL called
+	Data string
+
+	// RunLocation is where the test of an AvailabilityItem ran
+	RunLocation string
+
+	// Properties are the custom named values attached to the item, e.g. by an enriching Processor
+	Properties map[string]string
+
+	// Measurements are the custom named numeric values attached to the item
+	Measurements map[string]float64
+}
+
+// InProcDependencyType is the dependency type of the child traces started within a tracked activity, which are phases of the activity
+// rather than calls to other services
+const InProcDependencyType = "InProc"
+
+// NewChildItem creates the item of a child trace named for a phase of the tracked parent item, e.g. "validate" within a request. The child
+// is an in-process dependency in the parent's operation, with the parent's ID as its ParentID and its own ID. It has the parent's sample
+// rate, as it is kept whenever the parent is.
+func NewChildItem(parent *Item, name string) *Item {
+	return &Item{
+		Kind:           DependencyItem,
+		OperationID:    parent.OperationID,
+		ID:             NewSpanID(),
+		ParentID:       parent.ID,
+		SampleRate:     parent.SampleRate,
+		Name:           name,
+		DependencyType: InProcDependencyType,
+	}
+}
+
+// Time returns the Timestamp of the item, or the current time of the clock if it has none
+func (item *Item) Time(clock Clock) time.Time {
+	if item.Timestamp.IsZero() {
+		return clock.Now()
+	}
+
+	return item.Timestamp
+}
+
+// Describe returns a short description of a tracked item for diagnostics, e.g. "request GET /orders" or "dependency db"
+func (item *Item) Describe() string {
+	switch item.Kind {
+	case RequestItem:
+		return fmt.Sprintf("request %v %v", item.Method, item.URI)
+	case DependencyItem:
+		return fmt.Sprintf("dependency %v", item.Name)
+	case AvailabilityItem:
+		return fmt.Sprintf("availability test %v", item.Name)
+	default:
+		return fmt.Sprintf("%v %v", strings.ToLower(item.Kind.ToString()), item.Name)
+	}
+}
+
+// SetProperty sets the named property of the item, creating the properties if needed
+func (item *Item) SetProperty(name string, value string) {
+	if item.Properties == nil {
+		item.Properties = make(map[string]string)
+	}
+
+	item.Properties[name] = value
+}
+
+// SetMeasurement sets the named measurement of the item, creating the measurements if needed
+func (item *Item) SetMeasurement(name string, value float64) {
+	if item.Measurements == nil {
+		item.Measurements = make(map[string]float64)
+	}
+
+	item.Measurements[name] = value
+}
+
+// Clone creates a copy of the item which can be modified without affecting the original
+func (item *Item) Clone() *Item {
+	clone := *item
+
+	if item.Properties != nil {
+		clone.Properties = make(map[string]string, len(item.Properties))
+
+		for k, v := range item.Properties {
+			clone.Properties[k] = v
+		}
+	}
+
+	if item.Measurements != nil {
+		clone.Measurements = make(map[string]float64, len(item.Measurements))
+
+		for k, v := range item.Measurements {
+			clone.Measurements[k] = v
+		}
+	}
+
+	return &clone
+}
+
+// ItemTraceListener is implemented by trace listeners which can record everything carried by an Item, such as the operation and sample rate,
+// rather than only the arguments of the TraceListener methods. Listeners must not modify the items they are given.
+type ItemTraceListener interface {
+	TraceListener
+
+	// TraceItem records a message, exception, metric or event item
+	TraceItem(item *Item)
+
+	// TrackItem creates a tracking of a request, dependency or availability item
+	TrackItem(item *Item) *DurationTrace
+}
+
+// TraceItemTo delivers a message, exception, metric or event item to the listener, using TraceItem if the listener implements
+// ItemTraceListener, and the equivalent TraceListener method otherwise
+func TraceItemTo(listener TraceListener, item *Item) {
+	if il, ok := listener.(ItemTraceListener); ok {
+		il.TraceItem(item)
+		return
+	}
+
+	switch item.Kind {
+	case MessageItem:
+		listener.TraceMessage(item.Message, item.Severity)
+	case ExceptionItem:
+		listener.TraceException(item.Err)
+	case MetricItem:
+		listener.TraceMetric(item.Name, item.Value)
+	case EventItem:
+		listener.TraceEvent(item.Name)
+	}
+}
+
+// TrackItemTo delivers a request, dependency or availability item to the listener, using TrackItem if the listener implements
+// ItemTraceListener, and the equivalent TraceListener method otherwise
+func TrackItemTo(listener TraceListener, item *Item) *DurationTrace {
+	if il, ok := listener.(ItemTraceListener); ok {
+		return il.TrackItem(item)
+	}
+
+	switch item.Kind {
+	case RequestItem:
+		return listener.TrackRequest(item.Method, item.URI)
+	case DependencyItem:
+		return listener.TrackDependency(item.Name, item.DependencyType, item.Target)
+	case AvailabilityItem:
+		return listener.TrackAvailability(item.Name)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,32 @@
+package telemetry
+
+// ListenerOptions holds the optional settings which are common to the trace listener implementations
+type ListenerOptions struct {
+	// Clock provides the timestamps and durations recorded by the listener. Defaults to the SystemClock.
+	Clock Clock
+}
+
+// ListenerOption sets an optional setting when creating a trace listener
+type ListenerOption func(options *ListenerOptions)
+
+// WithClock sets the Clock used by a trace listener and its duration traces
+func WithClock(clock Clock) ListenerOption {
+	return func(options *ListenerOptions) {
+		options.Clock = clock
+	}
+}
+
+// NewListenerOptions applies the supplied options over the defaults. It is used by trace listener implementations.
+func NewListenerOptions(options ...ListenerOption) ListenerOptions {
+	result := ListenerOptions{Clock: SystemClock()}
+
+	for _, option := range options {
+		option(&result)
+	}
+
+	if result.Clock == nil {
+		result.Clock = SystemClock()
+	}
+
+	return result
+}
@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type operationKey struct{}
+
+// NewOperationID creates a new random operation ID
+func NewOperationID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// NewSpanID creates a new random ID for a tracked activity, which the activities started within it refer to as their parent
+func NewSpanID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// WithOperationID returns a copy of the context which carries the operation ID
+func WithOperationID(ctx context.Context, operationID string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operationID)
+}
+
+// OperationIDFromContext returns the operation ID carried by the context, or an empty string if there is none
+func OperationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	operationID, _ := ctx.Value(operationKey{}).(string)
+	return operationID
+}
@@ -0,0 +1,76 @@
+package telemetry
+
+type processingTraceListener struct {
+	inner      *TraceListener
+	processors []Processor
+}
+
+// NewProcessingTraceListener creates a trace listener which runs every item through the processors before passing the results to the
+// inner listener, for enrichment and filtering which only applies to that listener. Use AddProcessor for processors which apply to all.
+func NewProcessingTraceListener(listener TraceListener, processors ...Processor) TraceListener {
+	traceListener := processingTraceListener{inner: &listener, processors: processors}
+
+	return &traceListener
+}
+
+func (ptl *processingTraceListener) TraceMessage(message string, severity Severity) {
+	ptl.TraceItem(&Item{Kind: MessageItem, Message: message, Severity: severity})
+}
+
+func (ptl *processingTraceListener) TraceException(err error) {
+	ptl.TraceItem(&Item{Kind: ExceptionItem, Err: err})
+}
+
+func (ptl *processingTraceListener) TracePanic(rethrow bool) {
+	(*ptl.inner).TracePanic(rethrow)
+}
+
+func (ptl *processingTraceListener) TrackAvailability(name string) *DurationTrace {
+	return ptl.TrackItem(&Item{Kind: AvailabilityItem, Name: name})
+}
+
+func (ptl *processingTraceListener) TrackRequest(method string, uri string) *DurationTrace {
+	return ptl.TrackItem(&Item{Kind: RequestItem, Method: method, URI: uri})
+}
+
+func (ptl *processingTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
+	return ptl.TrackItem(&Item{Kind: DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
+
+func (ptl *processingTraceListener) TraceMetric(name string, value float64) {
+	ptl.TraceItem(&Item{Kind: MetricItem, Name: name, Value: value})
+}
+
+func (ptl *processingTraceListener) TraceEvent(name string) {
+	ptl.TraceItem(&Item{Kind: EventItem, Name: name})
+}
+
+func (ptl *processingTraceListener) TraceItem(item *Item) {
+	for _, processed := range process(ptl.processors, item) {
+		TraceItemTo(*ptl.inner, processed)
+	}
+}
+
+// TrackItem processes the item, giving it an ID if it has none so that child traces can refer to it. The children, and the details set on
+// the trace, are processed in the same way.
+func (ptl *processingTraceListener) TrackItem(item *Item) *DurationTrace {
+	item = withID(item)
+	traces := make([]*DurationTrace, 0)
+
+	for _, processed := range process(ptl.processors, item) {
+		if trace := TrackItemTo(*ptl.inner, processed); trace != nil {
+			traces = append(traces, trace)
+		}
+	}
+
+	dt := newAggregateDurationTrace(item, ptl.processors, traces, ptl.TrackItem)
+	return &dt
+}
+
+func (ptl *processingTraceListener) Flush() {
+	(*ptl.inner).Flush()
+}
+
+func (ptl *processingTraceListener) Close() {
+	(*ptl.inner).Close()
+}
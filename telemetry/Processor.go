@@ -0,0 +1,62 @@
+package telemetry
+
+// Processor inspects each item before it reaches the trace listeners. It may modify the item, drop it by returning no items, or fan it out
+// by returning several. The item passed to a processor is its own copy. Each detail set on the trace of a tracked item, such as a property or
+// URL, is also passed through the processors, as a copy of the tracked item with the detail set.
+type Processor interface {
+	// Process returns the items which continue to the next processor and then the listeners
+	Process(item *Item) []*Item
+}
+
+// ProcessorFunc adapts an ordinary function to the Processor interface
+type ProcessorFunc func(item *Item) []*Item
+
+// Process calls the function
+func (pf ProcessorFunc) Process(item *Item) []*Item {
+	return pf(item)
+}
+
+// Enrich creates a Processor which adds the properties to every item, without replacing properties which the item already has
+func Enrich(properties map[string]string) Processor {
+	return ProcessorFunc(func(item *Item) []*Item {
+		for k, v := range properties {
+			if _, ok := item.Properties[k]; !ok {
+				item.SetProperty(k, v)
+			}
+		}
+
+		return []*Item{item}
+	})
+}
+
+// Filter creates a Processor which drops the items for which keep returns false
+func Filter(keep func(item *Item) bool) Processor {
+	return ProcessorFunc(func(item *Item) []*Item {
+		if keep(item) {
+			return []*Item{item}
+		}
+
+		return nil
+	})
+}
+
+// process runs a copy of the item through the processors in order, returning the items which remain
+func process(processors []Processor, item *Item) []*Item {
+	items := []*Item{item.Clone()}
+
+	for _, processor := range processors {
+		next := make([]*Item, 0, len(items))
+
+		for _, current := range items {
+			for _, result := range processor.Process(current) {
+				if result != nil {
+					next = append(next, result)
+				}
+			}
+		}
+
+		items = next
+	}
+
+	return items
+}
@@ -0,0 +1,84 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ListenerFactory creates a trace listener from the settings given for it in a configuration file
+type ListenerFactory func(settings map[string]any) (TraceListener, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = make(map[string]ListenerFactory)
+)
+
+// RegisterListenerFactory makes a kind of trace listener available by name to configuration files, in the same way that database/sql drivers
+// are registered. It is intended to be called from the init function of the package which implements the listener. If the name is
+// registered twice, or the factory is nil, it panics.
+func RegisterListenerFactory(name string, factory ListenerFactory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+
+	if factory == nil {
+		panic("telemetry: RegisterListenerFactory factory is nil")
+	}
+
+	if _, registered := factories[name]; registered {
+		panic("telemetry: RegisterListenerFactory called twice for listener " + name)
+	}
+
+	factories[name] = factory
+}
+
+// ListenerFactories returns the sorted names of the registered listener factories
+func ListenerFactories() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// NewListener creates a trace listener using the factory registered with the name
+func NewListener(name string, settings map[string]any) (TraceListener, error) {
+	factoriesMutex.RLock()
+	factory, registered := factories[name]
+	factoriesMutex.RUnlock()
+
+	if !registered {
+		return nil, fmt.Errorf("unknown listener type %q (forgotten import?)", name)
+	}
+
+	if settings == nil {
+		settings = map[string]any{}
+	}
+
+	return factory(settings)
+}
+
+// DecodeSettings copies the settings given to a ListenerFactory into the fields of the target struct, matched by their json tags. Settings
+// which have no matching field are reported as errors, so that misspelt settings are not ignored.
+func DecodeSettings(settings map[string]any, target any) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(target); err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+
+	return nil
+}
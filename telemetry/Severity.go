@@ -1,5 +1,10 @@
 package telemetry
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Severity provides constants for the severity level of a traced statement.
 type Severity int32
 
@@ -37,3 +42,37 @@ func (s Severity) ToString() string {
 		return "<unknown>"
 	}
 }
+
+// ParseSeverity finds the Severity by its name, ignoring case. The short names "debug", "info" and "warn" are also accepted.
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "verbose", "debug":
+		return Verbose, nil
+	case "information", "info":
+		return Information, nil
+	case "warning", "warn":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	case "critical":
+		return Critical, nil
+	default:
+		return Verbose, fmt.Errorf("unknown severity %q, expected verbose, information, warning, error or critical", name)
+	}
+}
+
+// MarshalText converts the Severity to its name, so that it is written by name in JSON and other text formats
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.ToString()), nil
+}
+
+// UnmarshalText sets the Severity from its name, as accepted by ParseSeverity
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = severity
+	return nil
+}
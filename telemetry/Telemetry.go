@@ -1,10 +1,18 @@
 package telemetry
 
+import (
+	"context"
+	"time"
+)
+
 var (
 	traceListeners []*TraceListener
+	processors     []Processor
 )
 
-// AddListener adds an implementation of the TraceListener interface to the list of all listeners
+// AddListener adds an implementation of the TraceListener interface to the list of all listeners. The listener is called directly, so one
+// which panics or hangs affects the caller; wrap it with guard.NewGuardedTraceListener, or set guard in its section of the configuration
+// built by the config package, to isolate it.
 func AddListener(listener *TraceListener) {
 	if traceListeners == nil {
 		traceListeners = []*TraceListener{listener}
@@ -13,6 +21,12 @@ func AddListener(listener *TraceListener) {
 	}
 }
 
+// AddProcessor adds a Processor to the pipeline which every item passes through before reaching the listeners. Processors run in the order
+// they are added.
+func AddProcessor(processor Processor) {
+	processors = append(processors, processor)
+}
+
 // TraceVerbose writes a verbose message (typically for debugging) to the underlyng trace listeners
 func TraceVerbose(message string) {
 	traceMessageImpl(message, Verbose)
@@ -38,13 +52,24 @@ func TraceCritical(message string) {
 	traceMessageImpl(message, Critical)
 }
 
+// TraceMessage writes a message with the specified severity to the underlyng trace listeners
+func TraceMessage(message string, severity Severity) {
+	traceMessageImpl(message, severity)
+}
+
+// TraceMessageContext writes a message with the specified severity to the underlyng trace listeners, as part of the operation carried by the context
+func TraceMessageContext(ctx context.Context, message string, severity Severity) {
+	traceItemImpl(&Item{Kind: MessageItem, OperationID: OperationIDFromContext(ctx), Message: message, Severity: severity})
+}
+
 // TraceException traces the specified error to the underlyng trace listeners
 func TraceException(err error) {
-	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			(*tl).TraceException(err)
-		}
-	}
+	traceItemImpl(&Item{Kind: ExceptionItem, Err: err})
+}
+
+// TraceExceptionContext traces the specified error to the underlyng trace listeners, as part of the operation carried by the context
+func TraceExceptionContext(ctx context.Context, err error) {
+	traceItemImpl(&Item{Kind: ExceptionItem, OperationID: OperationIDFromContext(ctx), Err: err})
 }
 
 // TracePanic traces any panic error that is thrown. Typically used in a defer statement.
@@ -58,116 +83,312 @@ func TracePanic(rethrow bool) {
 
 // TraceMetric traces named single-valued metric to the underlyng trace listeners
 func TraceMetric(name string, value float64) {
-	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			(*tl).TraceMetric(name, value)
-		}
-	}
+	traceItemImpl(&Item{Kind: MetricItem, Name: name, Value: value})
 }
 
 // TraceEvent traces named event to the underlyng trace listeners
 func TraceEvent(name string) {
-	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			(*tl).TraceEvent(name)
-		}
-	}
+	traceItemImpl(&Item{Kind: EventItem, Name: name})
+}
+
+// TraceItem traces a message, exception, metric or event item to the underlyng trace listeners
+func TraceItem(item *Item) {
+	traceItemImpl(item)
 }
 
 // TrackAvailability creates a tracking of the availability of the named service
 func TrackAvailability(name string) *DurationTrace {
-	traces := make([]*DurationTrace, 0)
+	return trackItemImpl(&Item{Kind: AvailabilityItem, Name: name})
+}
 
-	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			traces = append(traces, (*tl).TrackAvailability(name))
-		}
-	}
+// TrackAvailabilityContext creates a tracking of the availability of the named service, as part of the operation carried by the context
+func TrackAvailabilityContext(ctx context.Context, name string) *DurationTrace {
+	return trackItemImpl(&Item{Kind: AvailabilityItem, OperationID: OperationIDFromContext(ctx), Name: name})
+}
 
-	dt := newAggregateDurationTrace(traces)
-	return &dt
+// TrackAvailabilityFunc tracks the availability test run by fn, as part of the operation carried by the context. The trace is ended with
+// the error returned by fn, which is returned, as by End.
+func TrackAvailabilityFunc(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	defer End(TrackAvailabilityContext(ctx, name), &err)
+
+	return fn(ctx)
 }
 
 // TrackRequest creates a tracking of the service request at the specified URI and method
 func TrackRequest(method string, uri string) *DurationTrace {
-	traces := make([]*DurationTrace, 0)
+	return trackItemImpl(&Item{Kind: RequestItem, Method: method, URI: uri})
+}
 
-	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			traces = append(traces, (*tl).TrackRequest(method, uri))
-		}
+// TrackRequestContext creates a tracking of the service request at the specified URI and method. The request joins the operation carried
+// by the context, or starts a new operation if there is none; the returned context carries the operation for the request's dependencies.
+func TrackRequestContext(ctx context.Context, method string, uri string) (context.Context, *DurationTrace) {
+	operationID := OperationIDFromContext(ctx)
+
+	if operationID == "" {
+		operationID = NewOperationID()
+		ctx = WithOperationID(ctx, operationID)
 	}
 
-	dt := newAggregateDurationTrace(traces)
-	return &dt
+	return ctx, trackItemImpl(&Item{Kind: RequestItem, OperationID: operationID, Method: method, URI: uri})
+}
+
+// TrackRequestFunc tracks the handling of the service request by fn, which is given the context carrying the request's operation, as by
+// TrackRequestContext. The trace is ended with the error returned by fn, which is returned, as by End.
+func TrackRequestFunc(ctx context.Context, method string, uri string, fn func(ctx context.Context) error) (err error) {
+	ctx, trace := TrackRequestContext(ctx, method, uri)
+	defer End(trace, &err)
+
+	return fn(ctx)
 }
 
 // TrackDependency creates a tracking of the specified external service dependency
 func TrackDependency(name string, dependencyType string, target string) *DurationTrace {
-	traces := make([]*DurationTrace, 0)
+	return trackItemImpl(&Item{Kind: DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
 
-	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			traces = append(traces, (*tl).TrackDependency(name, dependencyType, target))
-		}
-	}
+// TrackDependencyContext creates a tracking of the specified external service dependency, as part of the operation carried by the context
+func TrackDependencyContext(ctx context.Context, name string, dependencyType string, target string) *DurationTrace {
+	return trackItemImpl(&Item{Kind: DependencyItem, OperationID: OperationIDFromContext(ctx), Name: name, DependencyType: dependencyType, Target: target})
+}
 
-	dt := newAggregateDurationTrace(traces)
-	return &dt
+// TrackDependencyFunc tracks the call of the external service dependency made by fn, as part of the operation carried by the context. The
+// trace is ended with the error returned by fn, which is returned, as by End.
+func TrackDependencyFunc(ctx context.Context, name string, dependencyType string, target string, fn func(ctx context.Context) error) (err error) {
+	defer End(TrackDependencyContext(ctx, name, dependencyType, target), &err)
+
+	return fn(ctx)
 }
 
-// Flush causes all trace listeners to flush their data to their respective providers.
+// TrackItem creates a tracking of a request, dependency or availability item
+func TrackItem(item *Item) *DurationTrace {
+	return trackItemImpl(item)
+}
+
+// Flush causes all trace listeners to flush their data to their respective providers, after any items queued for asynchronous dispatch
+// have been delivered.
 func Flush() {
+	if d := activeDispatcher.Load(); d != nil {
+		d.flush()
+	}
+
 	if traceListeners != nil {
 		for _, tl := range traceListeners {
-			(*tl).Flush()
+			protectListener("Flush", (*tl).Flush)
 		}
 	}
 }
 
-// Close closes all trace listeners and removes the references to them.
+// Close stops any asynchronous dispatch, closes all trace listeners and removes the references to them and to the processors.
 func Close() {
+	StopAsyncDispatch()
 	Flush()
 
 	if traceListeners != nil {
 		for _, tl := range traceListeners {
-			(*tl).Close()
+			protectListener("Close", (*tl).Close)
 		}
 	}
 
 	traceListeners = nil
+	processors = nil
 }
 
 func traceMessageImpl(message string, severity Severity) {
+	traceItemImpl(&Item{Kind: MessageItem, Message: message, Severity: severity})
+}
+
+func traceItemImpl(item *Item) {
+	if d := activeDispatcher.Load(); d != nil && d.traceItem(item) {
+		return
+	}
+
+	deliverItem(item)
+}
+
+// trackItemImpl delivers the item, giving it an ID if it has none so that child traces can refer to it
+func trackItemImpl(item *Item) *DurationTrace {
+	item = withID(item)
+
+	if d := activeDispatcher.Load(); d != nil {
+		if trace := d.trackItem(item); trace != nil {
+			return trace
+		}
+	}
+
+	return deliverTrackItem(item)
+}
+
+// deliverItem passes the item through the processors to the listeners. A listener which panics does not keep the item from the others.
+func deliverItem(item *Item) {
 	if traceListeners != nil {
-		for _, tl := range traceListeners {
-			(*tl).TraceMessage(message, severity)
+		for _, processed := range process(processors, item) {
+			for _, tl := range traceListeners {
+				protectListener("TraceItem", func() { TraceItemTo(*tl, processed) })
+			}
+		}
+	}
+}
+
+// deliverTrackItem passes the item through the processors to the listeners, aggregating the traces they create
+func deliverTrackItem(item *Item) *DurationTrace {
+	traces := make([]*DurationTrace, 0)
+
+	if traceListeners != nil {
+		for _, processed := range process(processors, item) {
+			for _, tl := range traceListeners {
+				protectListener("TrackItem", func() {
+					if trace := TrackItemTo(*tl, processed); trace != nil {
+						traces = append(traces, trace)
+					}
+				})
+			}
 		}
 	}
+
+	dt := newAggregateDurationTrace(item, processors, traces, trackItemImpl)
+	return &dt
+}
+
+// withID returns the item if it has an ID, or a copy of it with a new ID
+func withID(item *Item) *Item {
+	if item.ID != "" {
+		return item
+	}
+
+	identified := item.Clone()
+	identified.ID = NewSpanID()
+
+	return identified
 }
 
+// aggregateDurationTrace passes the calls of a duration trace to the traces created by each listener, recovering their panics. Its children
+// are tracked in the same way as the item was, so they pass through the same processors to the same listeners. Once it is done, its calls
+// are no longer passed on, so that a misuse is reported once rather than by every listener. The details set on it, including the "error"
+// and "panic" properties set by End, pass through the processors too, so that a processor which scrubs items also scrubs them.
 type aggregateDurationTrace struct {
-	traces []*DurationTrace
+	TraceState
+	item       *Item
+	processors []Processor
+	traces     []*DurationTrace
+	track      func(item *Item) *DurationTrace
 }
 
-func newAggregateDurationTrace(tracers []*DurationTrace) DurationTrace {
-	return &aggregateDurationTrace{traces: tracers}
+func newAggregateDurationTrace(item *Item, processors []Processor, tracers []*DurationTrace, track func(item *Item) *DurationTrace) DurationTrace {
+	clock := SystemClock()
+
+	return &aggregateDurationTrace{TraceState: NewTraceState(item.Describe(), clock, item.Time(clock)), item: item, processors: processors,
+		traces: tracers, track: track}
 }
 
-func (atl aggregateDurationTrace) Complete() {
-	for _, trace := range atl.traces {
-		(*trace).Complete()
+func (atl *aggregateDurationTrace) StartChild(name string) *DurationTrace {
+	var child *Item
+
+	if !atl.Update("StartChild", func() { child = NewChildItem(atl.item, name) }) {
+		return NoopDurationTrace()
 	}
+
+	return atl.track(child)
+}
+
+func (atl *aggregateDurationTrace) Complete() {
+	atl.forEach("Complete", func(trace *DurationTrace) { (*trace).Complete() })
+}
+
+func (atl *aggregateDurationTrace) Fail(statusCode string) {
+	atl.forEach("Fail", func(trace *DurationTrace) { (*trace).Fail(statusCode) })
+}
+
+func (atl *aggregateDurationTrace) CompleteWithStatus(statusCode string) {
+	atl.forEach("CompleteWithStatus", func(trace *DurationTrace) { (*trace).CompleteWithStatus(statusCode) })
+}
+
+func (atl *aggregateDurationTrace) SetStatusCode(code int) {
+	atl.forEach("SetStatusCode", func(trace *DurationTrace) { (*trace).SetStatusCode(code) })
 }
 
-func (atl aggregateDurationTrace) Fail(statusCode string) {
+func (atl *aggregateDurationTrace) Done() {
+	if !atl.Finish(atl.clock.Now()) {
+		return
+	}
+
 	for _, trace := range atl.traces {
-		(*trace).Fail(statusCode)
+		protectListener("Done", (*trace).Done)
 	}
 }
 
-func (atl aggregateDurationTrace) Done() {
+func (atl *aggregateDurationTrace) DoneAt(end time.Time) {
+	if !atl.Finish(end) {
+		return
+	}
+
 	for _, trace := range atl.traces {
-		(*trace).Done()
+		protectListener("DoneAt", func() { DoneAt(trace, end) })
+	}
+}
+
+func (atl *aggregateDurationTrace) SetProperty(name string, value string) {
+	value, ok := atl.processDetail(func(item *Item) { item.SetProperty(name, value) }, func(item *Item) (string, bool) {
+		processed, ok := item.Properties[name]
+		return processed, ok
+	})
+
+	if ok {
+		atl.forEach("SetProperty", func(trace *DurationTrace) { (*trace).SetProperty(name, value) })
+	}
+}
+
+func (atl *aggregateDurationTrace) SetMeasurement(name string, value float64) {
+	atl.forEach("SetMeasurement", func(trace *DurationTrace) { (*trace).SetMeasurement(name, value) })
+}
+
+func (atl *aggregateDurationTrace) SetSource(source string) {
+	if source, ok := atl.processField(func(item *Item) *string { return &item.Source }, source); ok {
+		atl.forEach("SetSource", func(trace *DurationTrace) { (*trace).SetSource(source) })
 	}
 }
+
+func (atl *aggregateDurationTrace) SetURL(url string) {
+	if url, ok := atl.processField(func(item *Item) *string { return &item.URL }, url); ok {
+		atl.forEach("SetURL", func(trace *DurationTrace) { (*trace).SetURL(url) })
+	}
+}
+
+func (atl *aggregateDurationTrace) SetData(data string) {
+	if data, ok := atl.processField(func(item *Item) *string { return &item.Data }, data); ok {
+		atl.forEach("SetData", func(trace *DurationTrace) { (*trace).SetData(data) })
+	}
+}
+
+func (atl *aggregateDurationTrace) SetRunLocation(location string) {
+	if location, ok := atl.processField(func(item *Item) *string { return &item.RunLocation }, location); ok {
+		atl.forEach("SetRunLocation", func(trace *DurationTrace) { (*trace).SetRunLocation(location) })
+	}
+}
+
+// processField runs the value of a detail through the processors, as the field of a copy of the item
+func (atl *aggregateDurationTrace) processField(field func(item *Item) *string, value string) (string, bool) {
+	return atl.processDetail(func(item *Item) { *field(item) = value }, func(item *Item) (string, bool) { return *field(item), true })
+}
+
+// processDetail sets a detail on a copy of the item, runs it through the processors and reads the detail back from the first item which
+// remains. It returns false when the processors drop the item or the detail, in which case the detail is not passed on.
+func (atl *aggregateDurationTrace) processDetail(set func(item *Item), get func(item *Item) (string, bool)) (string, bool) {
+	detailed := atl.item.Clone()
+	set(detailed)
+
+	processed := process(atl.processors, detailed)
+	if len(processed) == 0 {
+		return "", false
+	}
+
+	return get(processed[0])
+}
+
+// forEach passes the call of the named method to the trace of each listener, unless the trace is done
+func (atl *aggregateDurationTrace) forEach(method string, call func(trace *DurationTrace)) {
+	atl.Update(method, func() {
+		for _, trace := range atl.traces {
+			protectListener(method, func() { call(trace) })
+		}
+	})
+}
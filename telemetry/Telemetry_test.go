@@ -1,6 +1,14 @@
 package telemetry
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -135,6 +143,42 @@ func TestEnsureTraceVerboseDataIsPassedToListener(t *testing.T) {
 	}
 }
 
+func TestEnsureTraceMessageDataIsPassedToListener(t *testing.T) {
+	expectedMessage := "Message"
+	expectedSeverity := Warning
+	expectedValue := 1
+
+	defer Close()
+
+	t.Log("Given an implementation of the TraceListener interface")
+	{
+		info := &trackingInformation{}
+		rtl := newRecordingTraceListener(info)
+
+		AddListener(&rtl)
+		actualValue := len(traceListeners)
+
+		if actualValue == expectedValue {
+			t.Logf("\t[%v] There should only be one trace listener in the global list of listeners", checkMark)
+		} else {
+			t.Fatalf("\t[%v] There should only be one trace listener in the global list of listeners. Expected: %v, Actual: %v", ballotX, expectedValue, actualValue)
+		}
+
+		t.Log("\tWhen a trace message is sent with a severity")
+		{
+			TraceMessage(expectedMessage, expectedSeverity)
+			actualMessage := info.message
+			actualSeverity := info.severity
+
+			if actualMessage == expectedMessage && actualSeverity == expectedSeverity {
+				t.Logf("\t\t[%v] The message and severity are correctly passed to the underlying trace listener.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message and severity are correctly passed to the underlying trace listener. Expected message: \"%v\", Actual message: \"%v\"; Expected severity: %v, Actual severity %v", ballotX, expectedMessage, actualMessage, expectedSeverity.ToString(), actualSeverity.ToString())
+			}
+		}
+	}
+}
+
 func TestEnsureTraceInformationDataIsPassedToListener(t *testing.T) {
 	expectedMessage := "Message"
 	expectedSeverity := Information
@@ -788,186 +832,1273 @@ func TestEnsureDurationTraceIsTransferringDependencyData(t *testing.T) {
 	}
 }
 
-type testError struct {
-	err string
-}
+func TestEnsureDurationTraceIsTransferringDetails(t *testing.T) {
+	defer Close()
 
-func (te *testError) Error() string {
-	return te.err
-}
+	t.Log("Given an implementation of the TraceListener interface")
+	{
+		trace := newTrackingTraceInformation()
+		dtl := newDurationTraceListener(&trace)
 
-func newEmptyTraceListener() TraceListener {
-	return &emptyTraceListener{}
-}
+		AddListener(&dtl)
 
-type emptyTraceListener struct{}
+		t.Log("\tWhen properties, measurements and details are set on a tracked request")
+		{
+			request := TrackRequest("GET", "/orders/{id}")
+			(*request).SetProperty("tenant", "contoso")
+			(*request).SetMeasurement("items", 3)
+			(*request).SetSource("checkout")
+			(*request).SetURL("https://example.com/orders/42")
+			(*request).SetData("SELECT 1")
+			(*request).SetRunLocation("westeurope")
+			(*request).Complete()
+			(*request).Done()
+
+			if trace.details.Properties["tenant"] == "contoso" && trace.details.Measurements["items"] == 3 {
+				t.Logf("\t\t[%v] The properties and measurements are passed to the listener's trace.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The properties and measurements are passed to the listener's trace. Actual: %v, %v", ballotX, trace.details.Properties, trace.details.Measurements)
+			}
 
-func (etl *emptyTraceListener) TraceMessage(message string, severity Severity) {}
+			details := trace.details
+			if details.Source == "checkout" && details.URL == "https://example.com/orders/42" && details.Data == "SELECT 1" && details.RunLocation == "westeurope" {
+				t.Logf("\t\t[%v] The kind-specific details are passed to the listener's trace.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The kind-specific details are passed to the listener's trace. Actual: %+v", ballotX, details)
+			}
+		}
+	}
+}
 
-func (etl *emptyTraceListener) TraceException(err error) {}
+func TestEnsureOperationIsPassedToItemListener(t *testing.T) {
+	defer Close()
 
-func (etl *emptyTraceListener) TracePanic(rethrow bool) {}
+	t.Log("Given an implementation of the ItemTraceListener interface")
+	{
+		itl := newItemTraceListener()
+		var tl TraceListener = itl
 
-func (etl *emptyTraceListener) TrackAvailability(name string) *DurationTrace {
-	return nil
-}
+		AddListener(&tl)
 
-func (etl *emptyTraceListener) TrackRequest(method string, uri string) *DurationTrace {
-	return nil
-}
+		t.Log("\tWhen a request is tracked without an operation in the context")
+		{
+			ctx, request := TrackRequestContext(context.Background(), "GET", "/orders")
+			dependency := TrackDependencyContext(ctx, "db", "SQL", "server")
+			TraceMessageContext(ctx, "Test message", Warning)
 
-func (etl *emptyTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
-	return nil
-}
+			(*dependency).Done()
+			(*request).Done()
 
-func (etl *emptyTraceListener) TraceMetric(name string, value float64) {}
+			operationID := OperationIDFromContext(ctx)
 
-func (etl *emptyTraceListener) TraceEvent(name string) {}
+			if operationID != "" && itl.items[0].OperationID == operationID && itl.items[0].Kind == RequestItem {
+				t.Logf("\t\t[%v] The request starts a new operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request starts a new operation. Actual: '%v'", ballotX, operationID)
+			}
 
-func (etl *emptyTraceListener) Flush() {}
+			if itl.items[1].OperationID == operationID && itl.items[2].OperationID == operationID && itl.items[2].Message == "Test message" {
+				t.Logf("\t\t[%v] The dependency and message are part of the request's operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency and message are part of the request's operation. Actual: '%v', '%v'", ballotX, itl.items[1].OperationID, itl.items[2].OperationID)
+			}
+		}
 
-func (etl *emptyTraceListener) Close() {}
+		t.Log("\tWhen a request is tracked with an operation in the context")
+		{
+			ctx, _ := TrackRequestContext(WithOperationID(context.Background(), "op-1"), "GET", "/orders")
 
-type trackingInformation struct {
-	message  string
-	severity Severity
-	err      error
-	rethrow  bool
-	name     string
-	value    float64
+			if OperationIDFromContext(ctx) == "op-1" && itl.items[3].OperationID == "op-1" {
+				t.Logf("\t\t[%v] The request joins the operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request joins the operation. Actual: '%v'", ballotX, itl.items[3].OperationID)
+			}
+		}
+	}
 }
 
-type recordingTraceListener struct {
-	info *trackingInformation
-}
+func TestEnsureChildTracesArePassedToItemListener(t *testing.T) {
+	defer Close()
 
-func newRecordingTraceListener(info *trackingInformation) TraceListener {
-	return &recordingTraceListener{info: info}
-}
+	t.Log("Given an implementation of the ItemTraceListener interface")
+	{
+		itl := newItemTraceListener()
+		var tl TraceListener = itl
 
-func (rtl *recordingTraceListener) TraceMessage(message string, severity Severity) {
-	rtl.info.message = message
-	rtl.info.severity = severity
-}
+		AddListener(&tl)
 
-func (rtl *recordingTraceListener) TraceException(err error) {
-	rtl.info.err = err
-}
+		t.Log("\tWhen a child trace is started within a tracked request")
+		{
+			ctx, request := TrackRequestContext(context.Background(), "GET", "/orders")
+			child := (*request).StartChild("validate")
 
-func (rtl *recordingTraceListener) TracePanic(rethrow bool) {
-	rtl.info.rethrow = rethrow
-}
+			(*child).Complete()
+			(*child).Done()
+			(*request).Done()
 
-func (rtl *recordingTraceListener) TrackAvailability(name string) *DurationTrace {
-	return nil
-}
+			parent, phase := itl.items[0], itl.items[1]
 
-func (rtl *recordingTraceListener) TrackRequest(method string, uri string) *DurationTrace {
-	return nil
-}
+			if parent.ID != "" && phase.ParentID == parent.ID && phase.ID != "" && phase.ID != parent.ID {
+				t.Logf("\t\t[%v] The child refers to the request as its parent.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The child refers to the request as its parent. Parent: '%v', Actual: '%v'", ballotX, parent.ID, phase.ParentID)
+			}
 
-func (rtl *recordingTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
-	return nil
+			if phase.Kind == DependencyItem && phase.Name == "validate" && phase.DependencyType == InProcDependencyType && phase.OperationID == OperationIDFromContext(ctx) {
+				t.Logf("\t\t[%v] The child is an in-process dependency in the request's operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The child is an in-process dependency in the request's operation. Actual: %+v", ballotX, phase)
+			}
+		}
+	}
 }
 
-func (rtl *recordingTraceListener) TraceMetric(name string, value float64) {
-	rtl.info.name = name
-	rtl.info.value = value
-}
+func TestEnsureProcessorsRunBeforeListeners(t *testing.T) {
+	defer Close()
 
-func (rtl *recordingTraceListener) TraceEvent(name string) {
-	rtl.info.name = name
-}
+	t.Log("Given an ItemTraceListener and global processors which enrich, filter and fan out")
+	{
+		itl := newItemTraceListener()
+		var tl TraceListener = itl
+
+		AddListener(&tl)
+		AddProcessor(Enrich(map[string]string{"service": "orders", "region": "west"}))
+		AddProcessor(Filter(func(item *Item) bool { return item.Kind != EventItem }))
+		AddProcessor(ProcessorFunc(func(item *Item) []*Item {
+			if item.Kind == ExceptionItem {
+				return []*Item{item, {Kind: MetricItem, Name: "Exceptions", Value: 1}}
+			}
 
-func (rtl *recordingTraceListener) Flush() {}
+			return []*Item{item}
+		}))
 
-func (rtl *recordingTraceListener) Close() {}
+		t.Log("\tWhen a message with a region property is traced")
+		{
+			TraceItem(&Item{Kind: MessageItem, Message: "Test message", Properties: map[string]string{"region": "east"}})
 
-type trackingTraceInformation struct {
-	statusCode     string
-	success        bool
-	startTime      time.Time
-	name           string
-	dependencyType string
-	target         string
-	method         string
-	uri            string
-	completed      bool
-	duration       time.Duration
-}
+			properties := itl.items[0].Properties
 
-func newTrackingTraceInformation() trackingTraceInformation {
-	return trackingTraceInformation{
-		statusCode: "Incomplete",
-		success:    false,
-		startTime:  time.Now(),
-		completed:  false,
+			if properties["service"] == "orders" && properties["region"] == "east" {
+				t.Logf("\t\t[%v] The message is enriched without replacing its own properties.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message is enriched without replacing its own properties. Actual: %v", ballotX, properties)
+			}
+		}
+
+		t.Log("\tWhen an event is traced")
+		{
+			TraceEvent("Noisy event")
+
+			if len(itl.items) == 1 {
+				t.Logf("\t\t[%v] The event is dropped.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The event is dropped. Actual: %v", ballotX, itl.items[len(itl.items)-1].Kind.ToString())
+			}
+		}
+
+		t.Log("\tWhen an exception is traced")
+		{
+			TraceException(&testError{err: "Test error"})
+
+			if len(itl.items) == 3 && itl.items[1].Kind == ExceptionItem && itl.items[2].Kind == MetricItem && itl.items[2].Name == "Exceptions" {
+				t.Logf("\t\t[%v] The exception is fanned out to a metric.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The exception is fanned out to a metric. Actual: %v items", ballotX, len(itl.items))
+			}
+		}
 	}
 }
 
-// Complete indicates a successful completion of the measured duration activity
-func (tti *trackingTraceInformation) Complete() {
-	tti.success = true
-	tti.statusCode = "OK"
-}
+func TestEnsureListenerProcessorsOnlyApplyToTheirListener(t *testing.T) {
+	defer Close()
 
-// Fail indicates an unsuccessful completion of the measured duration activity
-func (tti *trackingTraceInformation) Fail(statusCode string) {
-	tti.success = false
-	tti.statusCode = statusCode
-}
+	t.Log("Given two ItemTraceListeners, one of which has a processor")
+	{
+		plain := newItemTraceListener()
+		processed := newItemTraceListener()
+		var plainListener TraceListener = plain
+		processingListener := NewProcessingTraceListener(processed, Enrich(map[string]string{"audience": "ops"}))
 
-// Done indicates that the trace is complete and should be committed to the telemetry source
-func (tti *trackingTraceInformation) Done() {
-	tti.duration = time.Now().Sub(tti.startTime)
-	tti.completed = true
-}
+		AddListener(&plainListener)
+		AddListener(&processingListener)
 
-func newDurationTraceListener(tti *trackingTraceInformation) TraceListener {
-	return &durationTraceListener{trace: tti}
-}
+		t.Log("\tWhen a request is tracked")
+		{
+			(*TrackRequest("GET", "/orders")).Done()
 
-type durationTraceListener struct {
-	trace *trackingTraceInformation
+			if len(processed.items) == 1 && processed.items[0].Properties["audience"] == "ops" {
+				t.Logf("\t\t[%v] The request to the processing listener is enriched.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request to the processing listener is enriched.", ballotX)
+			}
+
+			if len(plain.items) == 1 && plain.items[0].Properties == nil {
+				t.Logf("\t\t[%v] The request to the other listener is not.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request to the other listener is not. Actual: %v", ballotX, plain.items[0].Properties)
+			}
+		}
+	}
 }
 
-func (dtl *durationTraceListener) TraceMessage(message string, severity Severity) {}
+func TestEnsureProcessorsRunOverTheDetailsOfTraces(t *testing.T) {
+	defer Close()
 
-func (dtl *durationTraceListener) TraceException(err error) {}
+	t.Log("Given an implementation of the TraceListener interface and a processor which masks secrets")
+	{
+		trace := newTrackingTraceInformation()
+		dtl := newDurationTraceListener(&trace)
 
-func (dtl *durationTraceListener) TracePanic(rethrow bool) {}
+		AddListener(&dtl)
+		AddProcessor(ProcessorFunc(func(item *Item) []*Item {
+			item.URL = strings.ReplaceAll(item.URL, "secret", "***")
 
-func (dtl *durationTraceListener) TrackAvailability(name string) *DurationTrace {
-	dtl.trace.name = name
+			for k, v := range item.Properties {
+				item.Properties[k] = strings.ReplaceAll(v, "secret", "***")
+			}
 
-	var trace DurationTrace = dtl.trace
+			return []*Item{item}
+		}))
 
-	return &trace
-}
+		t.Log("\tWhen a URL is set on a tracked request which then ends with an error")
+		{
+			request := TrackRequest("GET", "/orders")
+			(*request).SetURL("https://example.com/orders?key=secret")
 
-func (dtl *durationTraceListener) TrackRequest(method string, uri string) *DurationTrace {
-	dtl.trace.method = method
-	dtl.trace.uri = uri
+			err := error(&testError{err: "password secret rejected"})
+			End(request, &err)
 
-	var trace DurationTrace = dtl.trace
+			if trace.details.URL == "https://example.com/orders?key=***" {
+				t.Logf("\t\t[%v] The URL is processed before it reaches the listener's trace.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The URL is processed before it reaches the listener's trace. Actual: %v", ballotX, trace.details.URL)
+			}
 
-	return &trace
+			if property := trace.details.Properties["error"]; property == "password *** rejected" {
+				t.Logf("\t\t[%v] The error property set by End is processed before it reaches the listener's trace.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The error property set by End is processed before it reaches the listener's trace. Actual: %v", ballotX, property)
+			}
+		}
+	}
 }
 
-func (dtl *durationTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
-	dtl.trace.name = name
-	dtl.trace.dependencyType = dependencyType
-	dtl.trace.target = target
+func TestAsyncDispatchPreservesOrderPerOperation(t *testing.T) {
+	const goroutines, messages = 8, 500
 
-	var trace DurationTrace = dtl.trace
+	defer Close()
 
-	return &trace
-}
+	t.Log("Given asynchronous dispatch with 4 workers")
+	{
+		atl := newAsyncTraceListener()
+		var tl TraceListener = atl
 
-func (dtl *durationTraceListener) TraceMetric(name string, value float64) {}
+		AddListener(&tl)
+		StartAsyncDispatch(DispatchOptions{Workers: 4, QueueSize: 16})
 
-func (dtl *durationTraceListener) TraceEvent(name string) {}
+		t.Logf("\tWhen %v goroutines each trace %v numbered messages in their own operation", goroutines, messages)
+		{
+			var wg sync.WaitGroup
 
-func (dtl *durationTraceListener) Flush() {}
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
 
-func (dtl *durationTraceListener) Close() {}
+				go func(g int) {
+					defer wg.Done()
+
+					ctx := WithOperationID(context.Background(), fmt.Sprintf("operation-%v", g))
+
+					for i := 0; i < messages; i++ {
+						TraceMessageContext(ctx, fmt.Sprintf("%v:%v", g, i), Information)
+					}
+				}(g)
+			}
+
+			wg.Wait()
+			Flush()
+
+			next := make(map[int]int)
+			ordered := true
+
+			for _, item := range atl.snapshot() {
+				var g, i int
+				fmt.Sscanf(item.Message, "%d:%d", &g, &i)
+
+				ordered = ordered && i == next[g]
+				next[g] = i + 1
+			}
+
+			if len(atl.snapshot()) == goroutines*messages {
+				t.Logf("\t\t[%v] Every message is delivered by Flush.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Every message is delivered by Flush. Actual: %v", ballotX, len(atl.snapshot()))
+			}
+
+			if ordered {
+				t.Logf("\t\t[%v] The messages of each operation are delivered in order.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The messages of each operation are delivered in order.", ballotX)
+			}
+		}
+	}
+}
+
+func TestAsyncDispatchPreservesOrderWithoutOperations(t *testing.T) {
+	const goroutines, messages = 8, 500
+
+	defer Close()
+
+	t.Log("Given asynchronous dispatch with 4 workers")
+	{
+		atl := newAsyncTraceListener()
+		var tl TraceListener = atl
+
+		AddListener(&tl)
+		StartAsyncDispatch(DispatchOptions{Workers: 4, QueueSize: 16})
+
+		t.Logf("\tWhen %v goroutines each trace %v numbered messages outside of any operation", goroutines, messages)
+		{
+			var wg sync.WaitGroup
+
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+
+				go func(g int) {
+					defer wg.Done()
+
+					for i := 0; i < messages; i++ {
+						TraceMessage(fmt.Sprintf("%v:%v", g, i), Information)
+					}
+				}(g)
+			}
+
+			wg.Wait()
+			Flush()
+
+			next := make(map[int]int)
+			ordered := true
+
+			for _, item := range atl.snapshot() {
+				var g, i int
+				fmt.Sscanf(item.Message, "%d:%d", &g, &i)
+
+				ordered = ordered && i == next[g]
+				next[g] = i + 1
+			}
+
+			if len(atl.snapshot()) == goroutines*messages {
+				t.Logf("\t\t[%v] Every message is delivered by Flush.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Every message is delivered by Flush. Actual: %v", ballotX, len(atl.snapshot()))
+			}
+
+			if ordered {
+				t.Logf("\t\t[%v] The messages of each goroutine are delivered in order.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The messages of each goroutine are delivered in order.", ballotX)
+			}
+		}
+	}
+}
+
+func TestAsyncDispatchDeliversExactTimes(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+
+	defer Close()
+
+	t.Log("Given asynchronous dispatch using a test clock")
+	{
+		clock := &testClock{now: start}
+		atl := newAsyncTraceListener()
+		var tl TraceListener = atl
+
+		AddListener(&tl)
+		StartAsyncDispatch(DispatchOptions{Clock: clock})
+
+		t.Log("\tWhen a request fails after 250ms")
+		{
+			request := TrackRequest("GET", "/orders")
+			clock.advance(250 * time.Millisecond)
+			(*request).SetSource("checkout")
+			(*request).SetMeasurement("items", 3)
+			(*request).SetStatusCode(503)
+			(*request).Done()
+
+			StopAsyncDispatch()
+
+			items := atl.snapshot()
+
+			if len(items) == 1 && items[0].Timestamp.Equal(start) {
+				t.Logf("\t\t[%v] The request is delivered with the time it started.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request is delivered with the time it started. Actual: %v", ballotX, items)
+			}
+
+			trace := atl.traces[0]
+
+			if trace.end.Sub(trace.start) == 250*time.Millisecond && trace.statusCode == "503" {
+				t.Logf("\t\t[%v] The outcome is delivered with the time it ended.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The outcome is delivered with the time it ended. Actual: %v, %v", ballotX, trace.end.Sub(trace.start), trace.statusCode)
+			}
+
+			if trace.details.Source == "checkout" && trace.details.Measurements["items"] == 3 {
+				t.Logf("\t\t[%v] The details set on the trace are delivered with the outcome.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The details set on the trace are delivered with the outcome. Actual: %+v", ballotX, trace.details)
+			}
+		}
+
+		t.Log("\tWhen a message is traced after asynchronous dispatch is stopped")
+		{
+			TraceInformation("Test message")
+
+			if len(atl.snapshot()) == 2 {
+				t.Logf("\t\t[%v] The message is delivered on the caller's goroutine.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message is delivered on the caller's goroutine.", ballotX)
+			}
+		}
+	}
+}
+
+func TestAsyncDispatchDropsWhenTheQueueIsFull(t *testing.T) {
+	defer Close()
+
+	t.Log("Given asynchronous dispatch to a blocked listener, with a queue of 2 which drops on overflow")
+	{
+		atl := newAsyncTraceListener()
+		atl.block = make(chan struct{})
+		var tl TraceListener = atl
+
+		AddListener(&tl)
+		StartAsyncDispatch(DispatchOptions{QueueSize: 2, Overflow: Drop})
+
+		t.Log("\tWhen 10 messages are traced")
+		{
+			before := DroppedItems()
+
+			for i := 0; i < 10; i++ {
+				TraceInformation("Test message")
+			}
+
+			dropped := DroppedItems() - before
+
+			if dropped >= 7 && dropped <= 8 {
+				t.Logf("\t\t[%v] The messages which do not fit are dropped without blocking.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The messages which do not fit are dropped without blocking. Actual: %v", ballotX, dropped)
+			}
+
+			close(atl.block)
+			Flush()
+
+			if delivered := len(atl.snapshot()); uint64(delivered)+dropped == 10 {
+				t.Logf("\t\t[%v] The rest are delivered.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The rest are delivered. Actual: %v", ballotX, delivered)
+			}
+		}
+	}
+}
+
+func TestStopAsyncDispatchDoesNotWaitForAFullQueue(t *testing.T) {
+	defer Close()
+
+	t.Log("Given asynchronous dispatch with a queue of 1 to a listener which traces two messages of its own from the worker")
+	{
+		waiting := make(chan struct{})
+		rtl := &reentrantTraceListener{waiting: waiting}
+		var tl TraceListener = rtl
+
+		AddListener(&tl)
+		StartAsyncDispatch(DispatchOptions{QueueSize: 1})
+
+		t.Log("\tWhen dispatch is stopped while the worker waits for space in its own queue")
+		{
+			TraceInformation("Outer message")
+			<-waiting
+			time.Sleep(50 * time.Millisecond) // Wait a bit for the worker to block on the full queue
+
+			stopped := make(chan struct{})
+			go func() {
+				StopAsyncDispatch()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+				t.Logf("\t\t[%v] Dispatch stops.", checkMark)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t\t[%v] Dispatch stops.", ballotX)
+			}
+
+			if messages := rtl.snapshot(); len(messages) == 3 {
+				t.Logf("\t\t[%v] Every message is delivered.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Every message is delivered. Actual: %v", ballotX, messages)
+			}
+		}
+	}
+}
+
+func TestDurationTracesAreOnlyDoneOnce(t *testing.T) {
+	var mutex sync.Mutex
+	var diagnostics []error
+
+	SetDiagnosticsHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		diagnostics = append(diagnostics, err)
+	})
+
+	defer SetDiagnosticsHandler(nil)
+	defer Close()
+
+	t.Log("Given a request tracked to a listener")
+	{
+		atl := newAsyncTraceListener()
+		var tl TraceListener = atl
+
+		AddListener(&tl)
+
+		request := TrackRequest("GET", "/orders")
+		(*request).Complete()
+
+		t.Log("\tWhen the trace is done by 10 goroutines at once and then failed")
+		{
+			var wg sync.WaitGroup
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+					(*request).Done()
+				}()
+			}
+
+			wg.Wait()
+			(*request).Fail("500")
+
+			if atl.traces[0].dones == 1 && atl.traces[0].statusCode == "OK" {
+				t.Logf("\t\t[%v] The trace is done once, with its outcome before Done.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The trace is done once, with its outcome before Done. Actual: %v, '%v'", ballotX, atl.traces[0].dones, atl.traces[0].statusCode)
+			}
+
+			reported := len(diagnostics) == 10
+
+			for _, err := range diagnostics {
+				reported = reported && errors.Is(err, ErrTraceDone) && strings.Contains(err.Error(), "request GET /orders")
+			}
+
+			if reported && strings.HasPrefix(diagnostics[9].Error(), "Fail called") {
+				t.Logf("\t\t[%v] The extra calls are reported to the diagnostics handler.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The extra calls are reported to the diagnostics handler. Actual: %v", ballotX, diagnostics)
+			}
+
+			if (*request).Finished() && (*request).Duration() >= 0 {
+				t.Logf("\t\t[%v] The trace is finished.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The trace is finished.", ballotX)
+			}
+		}
+	}
+}
+
+func TestTrackFuncsEndTracesWithTheOutcome(t *testing.T) {
+	defer Close()
+
+	t.Log("Given a listener")
+	{
+		atl := newAsyncTraceListener()
+		var tl TraceListener = atl
+
+		AddListener(&tl)
+
+		t.Log("\tWhen a request handles a dependency which fails")
+		{
+			var operationID string
+			failure := errors.New("connection refused")
+
+			err := TrackRequestFunc(context.Background(), "GET", "/orders", func(ctx context.Context) error {
+				operationID = OperationIDFromContext(ctx)
+
+				return TrackDependencyFunc(ctx, "db", "SQL", "server", func(ctx context.Context) error { return failure })
+			})
+
+			request, dependency := atl.traces[0], atl.traces[1]
+
+			if err == failure && dependency.statusCode == ErrorStatusCode && dependency.details.Properties["error"] == "connection refused" && dependency.dones == 1 {
+				t.Logf("\t\t[%v] The dependency is failed with the error, which is returned.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency is failed with the error, which is returned. Actual: %v, %+v", ballotX, err, dependency)
+			}
+
+			if request.statusCode == ErrorStatusCode && operationID != "" && atl.items[1].OperationID == operationID {
+				t.Logf("\t\t[%v] The request is failed, and the dependency is part of its operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request is failed, and the dependency is part of its operation. Actual: %+v", ballotX, request)
+			}
+		}
+
+		t.Log("\tWhen an availability test succeeds")
+		{
+			err := TrackAvailabilityFunc(context.Background(), "orders", func(ctx context.Context) error { return nil })
+
+			if availability := atl.traces[2]; err == nil && availability.statusCode == "OK" && availability.dones == 1 {
+				t.Logf("\t\t[%v] The availability test is completed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The availability test is completed. Actual: %+v", ballotX, availability)
+			}
+		}
+
+		t.Log("\tWhen a function which ends its trace with End panics")
+		{
+			var recovered any
+
+			func() {
+				defer func() { recovered = recover() }()
+
+				_ = func() (err error) {
+					defer End(TrackDependency("cache", "Redis", "server"), &err)
+
+					panic("out of memory")
+				}()
+			}()
+
+			if cache := atl.traces[3]; recovered == "out of memory" && cache.statusCode == PanicStatusCode && cache.details.Properties["panic"] == "out of memory" && cache.dones == 1 {
+				t.Logf("\t\t[%v] The trace is failed with the panic, which continues.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The trace is failed with the panic, which continues. Actual: %v, %+v", ballotX, recovered, cache)
+			}
+		}
+	}
+}
+
+func TestPanickingListenersDoNotAffectTheOthers(t *testing.T) {
+	var diagnostics []error
+
+	SetDiagnosticsHandler(func(err error) { diagnostics = append(diagnostics, err) })
+
+	defer SetDiagnosticsHandler(nil)
+	defer Close()
+
+	t.Log("Given a listener which panics and an item listener")
+	{
+		var panicking TraceListener = &panickingTraceListener{}
+		itl := newItemTraceListener()
+		var tl TraceListener = itl
+
+		AddListener(&panicking)
+		AddListener(&tl)
+
+		t.Log("\tWhen a message is traced")
+		{
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("\t\t[%v] The panic does not reach the caller. Panic: %v", ballotX, r)
+					}
+				}()
+
+				TraceInformation("Test message")
+			}()
+
+			if len(itl.items) == 1 && itl.items[0].Message == "Test message" {
+				t.Logf("\t\t[%v] The item listener receives the message.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The item listener receives the message. Actual: %+v", ballotX, itl.items)
+			}
+
+			if len(diagnostics) == 1 && errors.Is(diagnostics[0], ErrListenerPanicked) && strings.Contains(diagnostics[0].Error(), "listener is broken") {
+				t.Logf("\t\t[%v] The panic is reported to the diagnostics handler.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The panic is reported to the diagnostics handler. Actual: %v", ballotX, diagnostics)
+			}
+		}
+	}
+}
+
+func TestListenerFactoriesAreRegisteredByName(t *testing.T) {
+	t.Log("Given a listener factory registered as 'empty'")
+	{
+		var received map[string]any
+
+		RegisterListenerFactory("empty", func(settings map[string]any) (TraceListener, error) {
+			var es struct {
+				Level Severity `json:"level"`
+			}
+
+			if err := DecodeSettings(settings, &es); err != nil {
+				return nil, err
+			}
+
+			received = settings
+			return newEmptyTraceListener(), nil
+		})
+
+		t.Log("\tWhen a listener is created by name")
+		{
+			listener, err := NewListener("empty", map[string]any{"level": "warn"})
+
+			if listener != nil && err == nil && received["level"] == "warn" {
+				t.Logf("\t\t[%v] The factory creates the listener from the settings.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The factory creates the listener from the settings. Error: %v", ballotX, err)
+			}
+		}
+
+		t.Log("\tWhen a listener is created with a misspelt setting or an unknown severity")
+		{
+			_, misspelt := NewListener("empty", map[string]any{"levle": "warn"})
+			_, unknown := NewListener("empty", map[string]any{"level": "loud"})
+
+			if misspelt != nil && strings.Contains(misspelt.Error(), "levle") && unknown != nil && strings.Contains(unknown.Error(), "\"loud\"") {
+				t.Logf("\t\t[%v] The settings are reported as invalid.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The settings are reported as invalid. Errors: %v, %v", ballotX, misspelt, unknown)
+			}
+		}
+
+		t.Log("\tWhen a listener of an unregistered type is created")
+		{
+			_, err := NewListener("kafka", nil)
+
+			if err != nil && strings.Contains(err.Error(), "\"kafka\"") {
+				t.Logf("\t\t[%v] The unknown type is reported.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The unknown type is reported. Error: %v", ballotX, err)
+			}
+		}
+
+		t.Log("\tWhen the name is registered again")
+		{
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Logf("\t\t[%v] Registration panics.", checkMark)
+					} else {
+						t.Errorf("\t\t[%v] Registration panics.", ballotX)
+					}
+				}()
+
+				RegisterListenerFactory("empty", func(settings map[string]any) (TraceListener, error) { return nil, nil })
+			}()
+		}
+
+		if names := ListenerFactories(); slices.Contains(names, "empty") {
+			t.Logf("\t[%v] The registered names are listed.", checkMark)
+		} else {
+			t.Errorf("\t[%v] The registered names are listed. Actual: %v", ballotX, names)
+		}
+	}
+}
+
+func BenchmarkInlineDispatch(b *testing.B) {
+	benchmarkDispatch(b, nil, false)
+}
+
+func BenchmarkAsyncDispatch(b *testing.B) {
+	benchmarkDispatch(b, &DispatchOptions{Overflow: Drop}, false)
+}
+
+func BenchmarkAsyncDispatchBlocking(b *testing.B) {
+	benchmarkDispatch(b, &DispatchOptions{}, false)
+}
+
+func BenchmarkInlineDispatchParallel(b *testing.B) {
+	benchmarkDispatch(b, nil, true)
+}
+
+func BenchmarkAsyncDispatchParallel(b *testing.B) {
+	benchmarkDispatch(b, &DispatchOptions{Overflow: Drop}, true)
+}
+
+func BenchmarkShardedAsyncDispatchParallel(b *testing.B) {
+	benchmarkDispatch(b, &DispatchOptions{Workers: 4, Overflow: Drop}, true)
+}
+
+// benchmarkDispatch measures the latency of tracing a message as seen by the caller, with a listener which formats and writes each message
+// to a shared writer, as the stream listener does. Asynchronous dispatch which drops on overflow measures the cost of queueing alone, and
+// reports the proportion of messages which the listener could not keep up with; blocking dispatch is limited to the speed of the listener.
+func benchmarkDispatch(b *testing.B, options *DispatchOptions, parallel bool) {
+	var tl TraceListener = &writingTraceListener{writer: io.Discard}
+
+	AddListener(&tl)
+	defer Close()
+
+	if options != nil {
+		StartAsyncDispatch(*options)
+	}
+
+	dropped := DroppedItems()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	if parallel {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				TraceInformation("Benchmark message")
+			}
+		})
+	} else {
+		for i := 0; i < b.N; i++ {
+			TraceInformation("Benchmark message")
+		}
+	}
+
+	b.StopTimer()
+	Flush()
+
+	b.ReportMetric(float64(DroppedItems()-dropped)/float64(b.N), "dropped/op")
+}
+
+type testError struct {
+	err string
+}
+
+func (te *testError) Error() string {
+	return te.err
+}
+
+func newEmptyTraceListener() TraceListener {
+	return &emptyTraceListener{}
+}
+
+type emptyTraceListener struct{}
+
+func (etl *emptyTraceListener) TraceMessage(message string, severity Severity) {}
+
+func (etl *emptyTraceListener) TraceException(err error) {}
+
+func (etl *emptyTraceListener) TracePanic(rethrow bool) {}
+
+func (etl *emptyTraceListener) TrackAvailability(name string) *DurationTrace {
+	return nil
+}
+
+func (etl *emptyTraceListener) TrackRequest(method string, uri string) *DurationTrace {
+	return nil
+}
+
+func (etl *emptyTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
+	return nil
+}
+
+func (etl *emptyTraceListener) TraceMetric(name string, value float64) {}
+
+func (etl *emptyTraceListener) TraceEvent(name string) {}
+
+func (etl *emptyTraceListener) Flush() {}
+
+func (etl *emptyTraceListener) Close() {}
+
+// panickingTraceListener panics when it is given a message
+type panickingTraceListener struct {
+	emptyTraceListener
+}
+
+func (ptl *panickingTraceListener) TraceMessage(message string, severity Severity) {
+	panic("listener is broken")
+}
+
+type trackingInformation struct {
+	message  string
+	severity Severity
+	err      error
+	rethrow  bool
+	name     string
+	value    float64
+}
+
+type recordingTraceListener struct {
+	info *trackingInformation
+}
+
+func newRecordingTraceListener(info *trackingInformation) TraceListener {
+	return &recordingTraceListener{info: info}
+}
+
+func (rtl *recordingTraceListener) TraceMessage(message string, severity Severity) {
+	rtl.info.message = message
+	rtl.info.severity = severity
+}
+
+func (rtl *recordingTraceListener) TraceException(err error) {
+	rtl.info.err = err
+}
+
+func (rtl *recordingTraceListener) TracePanic(rethrow bool) {
+	rtl.info.rethrow = rethrow
+}
+
+func (rtl *recordingTraceListener) TrackAvailability(name string) *DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TrackRequest(method string, uri string) *DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TraceMetric(name string, value float64) {
+	rtl.info.name = name
+	rtl.info.value = value
+}
+
+func (rtl *recordingTraceListener) TraceEvent(name string) {
+	rtl.info.name = name
+}
+
+func (rtl *recordingTraceListener) Flush() {}
+
+func (rtl *recordingTraceListener) Close() {}
+
+type trackingTraceInformation struct {
+	statusCode     string
+	success        bool
+	startTime      time.Time
+	name           string
+	dependencyType string
+	target         string
+	method         string
+	uri            string
+	completed      bool
+	duration       time.Duration
+	details        Item
+}
+
+func newTrackingTraceInformation() trackingTraceInformation {
+	return trackingTraceInformation{
+		statusCode: "Incomplete",
+		success:    false,
+		startTime:  time.Now(),
+		completed:  false,
+	}
+}
+
+// Complete indicates a successful completion of the measured duration activity
+func (tti *trackingTraceInformation) Complete() {
+	tti.success = true
+	tti.statusCode = "OK"
+}
+
+// Fail indicates an unsuccessful completion of the measured duration activity
+func (tti *trackingTraceInformation) Fail(statusCode string) {
+	tti.success = false
+	tti.statusCode = statusCode
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (tti *trackingTraceInformation) CompleteWithStatus(statusCode string) {
+	tti.success = true
+	tti.statusCode = statusCode
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code
+func (tti *trackingTraceInformation) SetStatusCode(code int) {
+	tti.success = IsSuccessStatusCode(code)
+	tti.statusCode = strconv.Itoa(code)
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity
+func (tti *trackingTraceInformation) StartChild(name string) *DurationTrace {
+	return NoopDurationTrace()
+}
+
+// SetProperty sets a custom named value of the measured duration activity
+func (tti *trackingTraceInformation) SetProperty(name string, value string) {
+	tti.details.SetProperty(name, value)
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+func (tti *trackingTraceInformation) SetMeasurement(name string, value float64) {
+	tti.details.SetMeasurement(name, value)
+}
+
+// SetSource sets the source of a request
+func (tti *trackingTraceInformation) SetSource(source string) {
+	tti.details.Source = source
+}
+
+// SetURL sets the full URL of a request
+func (tti *trackingTraceInformation) SetURL(url string) {
+	tti.details.URL = url
+}
+
+// SetData sets the command of a dependency call
+func (tti *trackingTraceInformation) SetData(data string) {
+	tti.details.Data = data
+}
+
+// SetRunLocation sets where an availability test ran
+func (tti *trackingTraceInformation) SetRunLocation(location string) {
+	tti.details.RunLocation = location
+}
+
+// Done indicates that the trace is complete and should be committed to the telemetry source
+func (tti *trackingTraceInformation) Done() {
+	tti.duration = time.Now().Sub(tti.startTime)
+	tti.completed = true
+}
+
+// Finished indicates whether Done has been called
+func (tti *trackingTraceInformation) Finished() bool {
+	return tti.completed
+}
+
+// Duration returns the time taken by the measured duration activity
+func (tti *trackingTraceInformation) Duration() time.Duration {
+	return tti.duration
+}
+
+func newDurationTraceListener(tti *trackingTraceInformation) TraceListener {
+	return &durationTraceListener{trace: tti}
+}
+
+type durationTraceListener struct {
+	trace *trackingTraceInformation
+}
+
+func (dtl *durationTraceListener) TraceMessage(message string, severity Severity) {}
+
+func (dtl *durationTraceListener) TraceException(err error) {}
+
+func (dtl *durationTraceListener) TracePanic(rethrow bool) {}
+
+func (dtl *durationTraceListener) TrackAvailability(name string) *DurationTrace {
+	dtl.trace.name = name
+
+	var trace DurationTrace = dtl.trace
+
+	return &trace
+}
+
+func (dtl *durationTraceListener) TrackRequest(method string, uri string) *DurationTrace {
+	dtl.trace.method = method
+	dtl.trace.uri = uri
+
+	var trace DurationTrace = dtl.trace
+
+	return &trace
+}
+
+func (dtl *durationTraceListener) TrackDependency(name string, dependencyType string, target string) *DurationTrace {
+	dtl.trace.name = name
+	dtl.trace.dependencyType = dependencyType
+	dtl.trace.target = target
+
+	var trace DurationTrace = dtl.trace
+
+	return &trace
+}
+
+func (dtl *durationTraceListener) TraceMetric(name string, value float64) {}
+
+func (dtl *durationTraceListener) TraceEvent(name string) {}
+
+func (dtl *durationTraceListener) Flush() {}
+
+func (dtl *durationTraceListener) Close() {}
+
+type itemTraceListener struct {
+	emptyTraceListener
+	items []Item
+}
+
+func newItemTraceListener() *itemTraceListener {
+	return &itemTraceListener{}
+}
+
+func (itl *itemTraceListener) TraceItem(item *Item) {
+	itl.items = append(itl.items, *item)
+}
+
+func (itl *itemTraceListener) TrackItem(item *Item) *DurationTrace {
+	itl.items = append(itl.items, *item)
+
+	return NoopDurationTrace()
+}
+
+// reentrantTraceListener traces two messages through the package functions when it receives the outer message, signalling before the
+// second so that a test can wait for it to block on a full queue
+type reentrantTraceListener struct {
+	emptyTraceListener
+	mutex    sync.Mutex
+	messages []string
+	waiting  chan struct{}
+}
+
+func (rtl *reentrantTraceListener) TraceMessage(message string, severity Severity) {
+	rtl.mutex.Lock()
+	rtl.messages = append(rtl.messages, message)
+	rtl.mutex.Unlock()
+
+	if message == "Outer message" {
+		TraceInformation("First inner message")
+		close(rtl.waiting)
+		TraceInformation("Second inner message")
+	}
+}
+
+func (rtl *reentrantTraceListener) snapshot() []string {
+	rtl.mutex.Lock()
+	defer rtl.mutex.Unlock()
+
+	return append([]string{}, rtl.messages...)
+}
+
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (tc *testClock) Now() time.Time {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	return tc.now
+}
+
+func (tc *testClock) advance(d time.Duration) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	tc.now = tc.now.Add(d)
+}
+
+// asyncTraceListener is a thread-safe ItemTraceListener which records the items and timed traces delivered to it
+type asyncTraceListener struct {
+	emptyTraceListener
+	mutex  sync.Mutex
+	block  chan struct{}
+	items  []Item
+	traces []*timedTrace
+}
+
+func newAsyncTraceListener() *asyncTraceListener {
+	return &asyncTraceListener{}
+}
+
+func (atl *asyncTraceListener) TraceItem(item *Item) {
+	if atl.block != nil {
+		<-atl.block
+	}
+
+	atl.mutex.Lock()
+	defer atl.mutex.Unlock()
+
+	atl.items = append(atl.items, *item)
+}
+
+func (atl *asyncTraceListener) TrackItem(item *Item) *DurationTrace {
+	atl.mutex.Lock()
+	defer atl.mutex.Unlock()
+
+	trace := &timedTrace{start: item.Timestamp, statusCode: "Incomplete"}
+	atl.items = append(atl.items, *item)
+	atl.traces = append(atl.traces, trace)
+
+	var dt DurationTrace = trace
+	return &dt
+}
+
+func (atl *asyncTraceListener) snapshot() []Item {
+	atl.mutex.Lock()
+	defer atl.mutex.Unlock()
+
+	return append([]Item{}, atl.items...)
+}
+
+type timedTrace struct {
+	start      time.Time
+	end        time.Time
+	dones      int
+	statusCode string
+	details    Item
+}
+
+func (tt *timedTrace) Complete() {
+	tt.statusCode = "OK"
+}
+
+func (tt *timedTrace) Fail(statusCode string) {
+	tt.statusCode = statusCode
+}
+
+func (tt *timedTrace) CompleteWithStatus(statusCode string) {
+	tt.statusCode = statusCode
+}
+
+func (tt *timedTrace) SetStatusCode(code int) {
+	tt.statusCode = strconv.Itoa(code)
+}
+
+func (tt *timedTrace) Done() {
+	tt.DoneAt(time.Now())
+}
+
+func (tt *timedTrace) DoneAt(end time.Time) {
+	tt.end = end
+	tt.dones++
+}
+
+func (tt *timedTrace) Finished() bool {
+	return !tt.end.IsZero()
+}
+
+func (tt *timedTrace) Duration() time.Duration {
+	return tt.end.Sub(tt.start)
+}
+
+func (tt *timedTrace) StartChild(name string) *DurationTrace {
+	return NoopDurationTrace()
+}
+
+func (tt *timedTrace) SetProperty(name string, value string) {
+	tt.details.SetProperty(name, value)
+}
+
+func (tt *timedTrace) SetMeasurement(name string, value float64) {
+	tt.details.SetMeasurement(name, value)
+}
+
+func (tt *timedTrace) SetSource(source string) {
+	tt.details.Source = source
+}
+
+func (tt *timedTrace) SetURL(url string) {
+	tt.details.URL = url
+}
+
+func (tt *timedTrace) SetData(data string) {
+	tt.details.Data = data
+}
+
+func (tt *timedTrace) SetRunLocation(location string) {
+	tt.details.RunLocation = location
+}
+
+// writingTraceListener formats each message and writes it to the writer under a lock
+type writingTraceListener struct {
+	emptyTraceListener
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (wtl *writingTraceListener) TraceMessage(message string, severity Severity) {
+	entry := fmt.Sprintf("%v [%v]: %v\n", time.Now().Format(time.StampMilli), severity.ToString(), message)
+
+	wtl.mutex.Lock()
+	defer wtl.mutex.Unlock()
+
+	_, _ = io.WriteString(wtl.writer, entry)
+}
@@ -1,34 +1,114 @@
 package appinsights
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/phbarton/Telemetry-Go/telemetry"
 )
 
 type applicationInsightsAvailabilityDurationTrace struct {
-	client     *appinsights.TelemetryClient
-	statusCode string
-	success    bool
-	startTime  time.Time
-	name       string
+	telemetry.TraceState
+	traceListener *appInsightsTraceListener
+	item          telemetry.Item
+	statusCode    string
+	success       bool
+	reported      bool
+	startTime     time.Time
 }
 
 func (aiadt *applicationInsightsAvailabilityDurationTrace) Complete() {
-	aiadt.success = true
-	aiadt.statusCode = "OK"
+	aiadt.Update("Complete", func() {
+		aiadt.reported = true
+		aiadt.success = true
+		aiadt.statusCode = "OK"
+	})
 }
 
 func (aiadt *applicationInsightsAvailabilityDurationTrace) Fail(statusCode string) {
-	aiadt.success = false
-	aiadt.statusCode = statusCode
+	aiadt.Update("Fail", func() {
+		aiadt.reported = true
+		aiadt.success = false
+		aiadt.statusCode = statusCode
+	})
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) CompleteWithStatus(statusCode string) {
+	aiadt.Update("CompleteWithStatus", func() {
+		aiadt.reported = true
+		aiadt.success = true
+		aiadt.statusCode = statusCode
+	})
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetStatusCode(code int) {
+	aiadt.Update("SetStatusCode", func() {
+		aiadt.reported = true
+		aiadt.success = telemetry.IsSuccessStatusCode(code)
+		aiadt.statusCode = strconv.Itoa(code)
+	})
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var child *telemetry.Item
+
+	started := aiadt.Update("StartChild", func() {
+		child = newChildItem(&aiadt.item, name)
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return aiadt.traceListener.TrackItem(child)
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetProperty(name string, value string) {
+	aiadt.Update("SetProperty", func() { aiadt.item.SetProperty(name, value) })
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetMeasurement(name string, value float64) {
+	aiadt.Update("SetMeasurement", func() { aiadt.item.SetMeasurement(name, value) })
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetSource(source string) {
+	aiadt.Update("SetSource", func() { aiadt.item.Source = source })
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetURL(url string) {
+	aiadt.Update("SetURL", func() { aiadt.item.URL = url })
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetData(data string) {
+	aiadt.Update("SetData", func() { aiadt.item.Data = data })
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) SetRunLocation(location string) {
+	aiadt.Update("SetRunLocation", func() { aiadt.item.RunLocation = location })
 }
 
 func (aiadt *applicationInsightsAvailabilityDurationTrace) Done() {
-	endTime := time.Now()
-	track := appinsights.NewAvailabilityTelemetry(aiadt.name, endTime.Sub(aiadt.startTime), aiadt.success)
+	aiadt.DoneAt(aiadt.traceListener.clock.Now())
+}
+
+func (aiadt *applicationInsightsAvailabilityDurationTrace) DoneAt(endTime time.Time) {
+	if !aiadt.Finish(endTime) {
+		return
+	}
+
+	track := appinsights.NewAvailabilityTelemetry(aiadt.item.Name, endTime.Sub(aiadt.startTime), aiadt.success)
 	track.Message = aiadt.statusCode
+	track.RunLocation = aiadt.item.RunLocation
 	track.MarkTime(aiadt.startTime, endTime)
 
-	(*aiadt.client).Track(track)
+	if aiadt.item.ID != "" {
+		track.Id = aiadt.item.ID
+	}
+
+	aiadt.traceListener.track(track, &aiadt.item)
+
+	if !aiadt.reported {
+		aiadt.traceListener.trackIncomplete(aiadt.item.Describe(), aiadt.startTime, endTime, &aiadt.item)
+	}
 }
@@ -0,0 +1,172 @@
+package appinsights
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	// DefaultEndpointURL is the ingestion endpoint of the Azure public cloud
+	DefaultEndpointURL = "https://dc.services.visualstudio.com/v2/track"
+
+	// DefaultMaxBatchSize is the number of items which are sent together unless the batch interval expires first
+	DefaultMaxBatchSize = 1024
+
+	// DefaultMaxBatchInterval is the longest time that items are held before they are sent
+	DefaultMaxBatchInterval = 10 * time.Second
+
+	trackPath = "/v2/track"
+)
+
+// ConnectionString holds the settings of an ApplicationInsights connection string, such as
+// "InstrumentationKey=00000000-0000-0000-0000-000000000000;IngestionEndpoint=https://westeurope-5.in.applicationinsights.azure.com/"
+type ConnectionString struct {
+	// InstrumentationKey identifies the ApplicationInsights instance.
+	InstrumentationKey string
+
+	// IngestionEndpoint is the base URL that telemetry is sent to. It takes precedence over the EndpointSuffix.
+	IngestionEndpoint string
+
+	// EndpointSuffix is the domain of a sovereign cloud, e.g. "applicationinsights.azure.cn", from which the ingestion endpoint is derived.
+	EndpointSuffix string
+}
+
+// ParseConnectionString reads the semicolon separated Key=Value settings of a connection string. Key names are not case sensitive and
+// settings which are not used by the listener, such as LiveEndpoint, are ignored. The InstrumentationKey is required.
+func ParseConnectionString(connectionString string) (ConnectionString, error) {
+	var result ConnectionString
+
+	for _, setting := range strings.Split(connectionString, ";") {
+		if strings.TrimSpace(setting) == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(setting, "=")
+		if !found {
+			return ConnectionString{}, fmt.Errorf("invalid connection string: %q is not Key=Value", setting)
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "instrumentationkey":
+			result.InstrumentationKey = value
+		case "ingestionendpoint":
+			if endpoint, err := url.Parse(value); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+				return ConnectionString{}, fmt.Errorf("invalid connection string: IngestionEndpoint %q is not an absolute URL", value)
+			}
+
+			result.IngestionEndpoint = value
+		case "endpointsuffix":
+			result.EndpointSuffix = strings.Trim(value, "./")
+		}
+	}
+
+	if result.InstrumentationKey == "" {
+		return ConnectionString{}, errors.New("invalid connection string: InstrumentationKey is required")
+	}
+
+	return result, nil
+}
+
+// EndpointURL returns the URL that telemetry is sent to: the IngestionEndpoint, or the endpoint in the cloud named by the EndpointSuffix,
+// or the Azure public cloud's endpoint if neither is set
+func (cs ConnectionString) EndpointURL() string {
+	switch {
+	case cs.IngestionEndpoint != "":
+		return strings.TrimSuffix(cs.IngestionEndpoint, "/") + trackPath
+	case cs.EndpointSuffix != "":
+		return "https://dc." + cs.EndpointSuffix + trackPath
+	default:
+		return DefaultEndpointURL
+	}
+}
+
+// TelemetryConfiguration holds the settings used to send telemetry to ApplicationInsights
+type TelemetryConfiguration struct {
+	// InstrumentationKey identifies the ApplicationInsights instance.
+	InstrumentationKey string
+
+	// EndpointURL is the full URL that batches of telemetry are posted to.
+	EndpointURL string
+
+	// MaxBatchSize is the number of items which are sent together unless the MaxBatchInterval expires first.
+	MaxBatchSize int
+
+	// MaxBatchInterval is the longest time that items are held before they are sent.
+	MaxBatchInterval time.Duration
+
+	// HTTPClient sends the batches. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Spool keeps the batches which cannot be sent on disk until they can be, across restarts. Batches are only kept in memory if it is nil.
+	Spool *SpoolConfiguration
+
+	// Initializers are run, in order, on every item before it is tracked, to set context tags and properties such as the user and session.
+	Initializers []TelemetryInitializer
+}
+
+// NewTelemetryConfiguration creates the configuration for a connection string, or for a bare instrumentation key, with the default batching
+func NewTelemetryConfiguration(connectionString string) (*TelemetryConfiguration, error) {
+	settings := ConnectionString{InstrumentationKey: strings.TrimSpace(connectionString)}
+
+	if strings.Contains(connectionString, "=") {
+		parsed, err := ParseConnectionString(connectionString)
+		if err != nil {
+			return nil, err
+		}
+
+		settings = parsed
+	} else if settings.InstrumentationKey == "" {
+		return nil, errors.New("invalid connection string: InstrumentationKey is required")
+	}
+
+	return &TelemetryConfiguration{
+		InstrumentationKey: settings.InstrumentationKey,
+		EndpointURL:        settings.EndpointURL(),
+		MaxBatchSize:       DefaultMaxBatchSize,
+		MaxBatchInterval:   DefaultMaxBatchInterval,
+	}, nil
+}
+
+// toClientConfiguration converts the configuration to the client's, using the defaults for the settings which are not set. If a spool is
+// configured, it is created and the client sends through it.
+func (tc *TelemetryConfiguration) toClientConfiguration(clock telemetry.Clock) (*appinsights.TelemetryConfiguration, *spool) {
+	configuration := appinsights.NewTelemetryConfiguration(tc.InstrumentationKey)
+	configuration.Client = tc.HTTPClient
+	var s *spool
+
+	if tc.EndpointURL != "" {
+		configuration.EndpointUrl = tc.EndpointURL
+	}
+
+	if tc.MaxBatchSize > 0 {
+		configuration.MaxBatchSize = tc.MaxBatchSize
+	}
+
+	if tc.MaxBatchInterval > 0 {
+		configuration.MaxBatchInterval = tc.MaxBatchInterval
+	}
+
+	if tc.Spool != nil {
+		client := http.Client{}
+		if tc.HTTPClient != nil {
+			client = *tc.HTTPClient
+		}
+
+		// The spool applies its own send timeout, so that a batch which times out is spooled rather than failed by the client
+		s = newSpool(*tc.Spool, configuration.EndpointUrl, client.Transport, clock)
+		client.Transport = s
+		client.Timeout = 0
+		configuration.Client = &client
+	}
+
+	return configuration, s
+}
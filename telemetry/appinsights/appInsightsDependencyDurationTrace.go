@@ -1,36 +1,114 @@
 package appinsights
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/phbarton/Telemetry-Go/telemetry"
 )
 
 type applicationInsightsDependencyDurationTrace struct {
-	client         *appinsights.TelemetryClient
-	statusCode     string
-	success        bool
-	startTime      time.Time
-	name           string
-	dependencyType string
-	target         string
+	telemetry.TraceState
+	traceListener *appInsightsTraceListener
+	item          telemetry.Item
+	statusCode    string
+	success       bool
+	reported      bool
+	startTime     time.Time
 }
 
 func (aiddt *applicationInsightsDependencyDurationTrace) Complete() {
-	aiddt.success = true
-	aiddt.statusCode = "OK"
+	aiddt.Update("Complete", func() {
+		aiddt.reported = true
+		aiddt.success = true
+		aiddt.statusCode = "OK"
+	})
 }
 
 func (aiddt *applicationInsightsDependencyDurationTrace) Fail(statusCode string) {
-	aiddt.success = false
-	aiddt.statusCode = statusCode
+	aiddt.Update("Fail", func() {
+		aiddt.reported = true
+		aiddt.success = false
+		aiddt.statusCode = statusCode
+	})
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) CompleteWithStatus(statusCode string) {
+	aiddt.Update("CompleteWithStatus", func() {
+		aiddt.reported = true
+		aiddt.success = true
+		aiddt.statusCode = statusCode
+	})
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetStatusCode(code int) {
+	aiddt.Update("SetStatusCode", func() {
+		aiddt.reported = true
+		aiddt.success = telemetry.IsSuccessStatusCode(code)
+		aiddt.statusCode = strconv.Itoa(code)
+	})
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var child *telemetry.Item
+
+	started := aiddt.Update("StartChild", func() {
+		child = newChildItem(&aiddt.item, name)
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return aiddt.traceListener.TrackItem(child)
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetProperty(name string, value string) {
+	aiddt.Update("SetProperty", func() { aiddt.item.SetProperty(name, value) })
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetMeasurement(name string, value float64) {
+	aiddt.Update("SetMeasurement", func() { aiddt.item.SetMeasurement(name, value) })
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetSource(source string) {
+	aiddt.Update("SetSource", func() { aiddt.item.Source = source })
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetURL(url string) {
+	aiddt.Update("SetURL", func() { aiddt.item.URL = url })
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetData(data string) {
+	aiddt.Update("SetData", func() { aiddt.item.Data = data })
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) SetRunLocation(location string) {
+	aiddt.Update("SetRunLocation", func() { aiddt.item.RunLocation = location })
 }
 
 func (aiddt *applicationInsightsDependencyDurationTrace) Done() {
-	endTime := time.Now()
-	track := appinsights.NewRemoteDependencyTelemetry(aiddt.name, aiddt.dependencyType, aiddt.target, aiddt.success)
+	aiddt.DoneAt(aiddt.traceListener.clock.Now())
+}
+
+func (aiddt *applicationInsightsDependencyDurationTrace) DoneAt(endTime time.Time) {
+	if !aiddt.Finish(endTime) {
+		return
+	}
+
+	track := appinsights.NewRemoteDependencyTelemetry(aiddt.item.Name, aiddt.item.DependencyType, aiddt.item.Target, aiddt.success)
 	track.ResultCode = aiddt.statusCode
+	track.Data = aiddt.item.Data
 	track.MarkTime(aiddt.startTime, endTime)
 
-	(*aiddt.client).Track(track)
+	if aiddt.item.ID != "" {
+		track.Id = aiddt.item.ID
+	}
+
+	aiddt.traceListener.track(track, &aiddt.item)
+
+	if !aiddt.reported {
+		aiddt.traceListener.trackIncomplete(aiddt.item.Describe(), aiddt.startTime, endTime, &aiddt.item)
+	}
 }
@@ -0,0 +1,60 @@
+package appinsights
+
+import (
+	"log"
+	"strings"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// envelop wraps the item in an envelope in the same way as the client's Track, which does not allow the envelope's sample rate to be set
+func envelop(client appinsights.TelemetryClient, item appinsights.Telemetry, sampleRate float64) *contracts.Envelope {
+	context := client.Context()
+
+	if properties := item.GetProperties(); properties != nil {
+		for k, v := range context.CommonProperties {
+			if _, ok := properties[k]; !ok {
+				properties[k] = v
+			}
+		}
+	}
+
+	telemetryData := item.TelemetryData()
+	data := contracts.NewData()
+	data.BaseType = telemetryData.BaseType()
+	data.BaseData = telemetryData
+
+	envelope := contracts.NewEnvelope()
+	envelope.Name = telemetryData.EnvelopeName(strings.Replace(client.InstrumentationKey(), "-", "", -1))
+	envelope.Data = data
+	envelope.IKey = client.InstrumentationKey()
+	envelope.Time = item.Time().UTC().Format("2006-01-02T15:04:05.999999Z")
+	envelope.SampleRate = sampleRate
+	envelope.Tags = item.ContextTags()
+
+	if envelope.Tags == nil {
+		envelope.Tags = make(contracts.ContextTags)
+	}
+
+	for k, v := range context.Tags {
+		if _, ok := envelope.Tags[k]; !ok {
+			envelope.Tags[k] = v
+		}
+	}
+
+	if _, ok := envelope.Tags[contracts.OperationId]; !ok {
+		envelope.Tags[contracts.OperationId] = telemetry.NewOperationID()
+	}
+
+	for _, warning := range telemetryData.Sanitize() {
+		log.Printf("ApplicationInsights telemetry data warning: %v", warning)
+	}
+
+	for _, warning := range contracts.SanitizeTags(envelope.Tags) {
+		log.Printf("ApplicationInsights telemetry tag warning: %v", warning)
+	}
+
+	return envelope
+}
@@ -0,0 +1,150 @@
+package appinsights
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+)
+
+// TelemetryInitializer sets the context tags and properties of an item before it is tracked, e.g. the user and session that it belongs to.
+// Initializers are run after the item's own properties and operation have been set, so they can promote or add to them.
+type TelemetryInitializer func(track appinsights.Telemetry)
+
+// kubernetesVariables maps the properties set by the KubernetesInitializer to the environment variables which may hold them, in order of
+// preference. The downward API does not fix their names, so both the common names and their KUBERNETES_ prefixed forms are read.
+var kubernetesVariables = []struct {
+	property  string
+	variables []string
+}{
+	{"Kubernetes.Pod.Name", []string{"KUBERNETES_POD_NAME", "POD_NAME"}},
+	{"Kubernetes.Pod.Namespace", []string{"KUBERNETES_NAMESPACE", "POD_NAMESPACE"}},
+	{"Kubernetes.Pod.ID", []string{"KUBERNETES_POD_UID", "POD_UID"}},
+	{"Kubernetes.Node.Name", []string{"KUBERNETES_NODE_NAME", "NODE_NAME"}},
+}
+
+// containerIDPattern matches the 64 hexadecimal digit IDs used by Docker, containerd and CRI-O in cgroup paths
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// CommonProperties returns an initializer which adds the properties, e.g. a build number or git SHA, to every item which does not already
+// have them
+func CommonProperties(properties map[string]string) TelemetryInitializer {
+	common := make(map[string]string, len(properties))
+	for k, v := range properties {
+		common[k] = v
+	}
+
+	return func(track appinsights.Telemetry) {
+		itemProperties := track.GetProperties()
+		if itemProperties == nil {
+			return
+		}
+
+		for k, v := range common {
+			if _, ok := itemProperties[k]; !ok {
+				itemProperties[k] = v
+			}
+		}
+	}
+}
+
+// ContextTags returns an initializer which sets the context tags, keyed by the contracts package's tag names such as contracts.DeviceType
+// or contracts.LocationIp, on every item which does not already have them
+func ContextTags(tags map[string]string) TelemetryInitializer {
+	common := make(map[string]string, len(tags))
+	for k, v := range tags {
+		common[k] = v
+	}
+
+	return func(track appinsights.Telemetry) {
+		itemTags := track.ContextTags()
+		if itemTags == nil {
+			return
+		}
+
+		for k, v := range common {
+			if _, ok := itemTags[k]; !ok {
+				itemTags[k] = v
+			}
+		}
+	}
+}
+
+// PropertyTags returns an initializer which moves the properties named by the mapping into the context tags it maps them to, e.g.
+// {"userId": contracts.UserId, "sessionId": contracts.SessionId}, so that values which vary by item can be given as ordinary properties
+func PropertyTags(mapping map[string]string) TelemetryInitializer {
+	tags := make(map[string]string, len(mapping))
+	for k, v := range mapping {
+		tags[k] = v
+	}
+
+	return func(track appinsights.Telemetry) {
+		itemProperties := track.GetProperties()
+		itemTags := track.ContextTags()
+		if itemProperties == nil || itemTags == nil {
+			return
+		}
+
+		for property, tag := range tags {
+			if value, ok := itemProperties[property]; ok {
+				itemTags[tag] = value
+				delete(itemProperties, property)
+			}
+		}
+	}
+}
+
+// KubernetesInitializer returns an initializer which adds the pod name, namespace and ID, and the node name, to every item as properties.
+// They are read once from the environment variables set by the downward API in the pod's specification; those which are not set are
+// omitted, so nothing is added outside Kubernetes.
+func KubernetesInitializer() TelemetryInitializer {
+	return CommonProperties(kubernetesProperties(os.LookupEnv))
+}
+
+// ContainerInitializer returns an initializer which adds the ID of the container that the process runs in to every item as the
+// "Container.ID" property. It is read once from /proc/self/cgroup, and nothing is added if it cannot be found there.
+func ContainerInitializer() TelemetryInitializer {
+	properties := map[string]string{}
+
+	if cgroup, err := os.Open("/proc/self/cgroup"); err == nil {
+		if id := containerID(cgroup); id != "" {
+			properties["Container.ID"] = id
+		}
+
+		_ = cgroup.Close()
+	}
+
+	return CommonProperties(properties)
+}
+
+// kubernetesProperties reads the Kubernetes properties from the environment
+func kubernetesProperties(lookup func(string) (string, bool)) map[string]string {
+	properties := map[string]string{}
+
+	for _, kv := range kubernetesVariables {
+		for _, variable := range kv.variables {
+			if value, ok := lookup(variable); ok && value != "" {
+				properties[kv.property] = value
+				break
+			}
+		}
+	}
+
+	return properties
+}
+
+// containerID finds the container ID in the lines of a /proc/self/cgroup file, such as
+// "0::/kubepods/besteffort/pod0a1b.../cri-containerd-<id>.scope", or returns an empty string if there is none
+func containerID(cgroup io.Reader) string {
+	scanner := bufio.NewScanner(cgroup)
+
+	for scanner.Scan() {
+		if id := containerIDPattern.FindString(scanner.Text()); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
@@ -1,35 +1,118 @@
 package appinsights
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/phbarton/Telemetry-Go/telemetry"
 )
 
 type applicationInsightsRequestDurationTrace struct {
-	client     *appinsights.TelemetryClient
-	statusCode string
-	success    bool
-	startTime  time.Time
-	method     string
-	uri        string
+	telemetry.TraceState
+	traceListener *appInsightsTraceListener
+	item          telemetry.Item
+	statusCode    string
+	success       bool
+	reported      bool
+	startTime     time.Time
 }
 
 func (airdt *applicationInsightsRequestDurationTrace) Complete() {
-	airdt.success = true
-	airdt.statusCode = "OK"
+	airdt.Update("Complete", func() {
+		airdt.reported = true
+		airdt.success = true
+		airdt.statusCode = "OK"
+	})
 }
 
 func (airdt *applicationInsightsRequestDurationTrace) Fail(statusCode string) {
-	airdt.success = false
-	airdt.statusCode = statusCode
+	airdt.Update("Fail", func() {
+		airdt.reported = true
+		airdt.success = false
+		airdt.statusCode = statusCode
+	})
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) CompleteWithStatus(statusCode string) {
+	airdt.Update("CompleteWithStatus", func() {
+		airdt.reported = true
+		airdt.success = true
+		airdt.statusCode = statusCode
+	})
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetStatusCode(code int) {
+	airdt.Update("SetStatusCode", func() {
+		airdt.reported = true
+		airdt.success = telemetry.IsSuccessStatusCode(code)
+		airdt.statusCode = strconv.Itoa(code)
+	})
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var child *telemetry.Item
+
+	started := airdt.Update("StartChild", func() {
+		child = newChildItem(&airdt.item, name)
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return airdt.traceListener.TrackItem(child)
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetProperty(name string, value string) {
+	airdt.Update("SetProperty", func() { airdt.item.SetProperty(name, value) })
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetMeasurement(name string, value float64) {
+	airdt.Update("SetMeasurement", func() { airdt.item.SetMeasurement(name, value) })
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetSource(source string) {
+	airdt.Update("SetSource", func() { airdt.item.Source = source })
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetURL(url string) {
+	airdt.Update("SetURL", func() { airdt.item.URL = url })
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetData(data string) {
+	airdt.Update("SetData", func() { airdt.item.Data = data })
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) SetRunLocation(location string) {
+	airdt.Update("SetRunLocation", func() { airdt.item.RunLocation = location })
 }
 
 func (airdt *applicationInsightsRequestDurationTrace) Done() {
-	endTime := time.Now()
-	track := appinsights.NewRequestTelemetry(airdt.method, airdt.uri, endTime.Sub(airdt.startTime), airdt.statusCode)
+	airdt.DoneAt(airdt.traceListener.clock.Now())
+}
+
+func (airdt *applicationInsightsRequestDurationTrace) DoneAt(endTime time.Time) {
+	if !airdt.Finish(endTime) {
+		return
+	}
+
+	track := appinsights.NewRequestTelemetry(airdt.item.Method, airdt.item.URI, endTime.Sub(airdt.startTime), airdt.statusCode)
 	track.Success = airdt.success
+	track.Source = airdt.item.Source
 	track.MarkTime(airdt.startTime, endTime)
 
-	(*airdt.client).Track(track)
+	if airdt.item.URL != "" {
+		track.Url = airdt.item.URL
+	}
+
+	if airdt.item.ID != "" {
+		track.Id = airdt.item.ID
+	}
+
+	airdt.traceListener.track(track, &airdt.item)
+
+	if !airdt.reported {
+		airdt.traceListener.trackIncomplete(airdt.item.Describe(), airdt.startTime, endTime, &airdt.item)
+	}
 }
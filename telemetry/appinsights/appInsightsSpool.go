@@ -0,0 +1,482 @@
+package appinsights
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	// DefaultSpoolMaxSize is the total size of the batches kept in a spool before the oldest are removed
+	DefaultSpoolMaxSize int64 = 50 * 1024 * 1024
+
+	// DefaultSpoolMaxAge is the age after which a spooled batch is removed, as ApplicationInsights does not accept older telemetry
+	DefaultSpoolMaxAge = 48 * time.Hour
+
+	// DefaultSpoolMinBackoff is the wait before the first retry of the spooled batches
+	DefaultSpoolMinBackoff = 5 * time.Second
+
+	// DefaultSpoolMaxBackoff is the longest wait between retries of the spooled batches
+	DefaultSpoolMaxBackoff = 5 * time.Minute
+
+	// DefaultSpoolSendTimeout is the time allowed to send a batch before it is spooled
+	DefaultSpoolSendTimeout = 10 * time.Second
+
+	spoolSuffix     = ".trn"
+	spoolTempSuffix = ".tmp"
+	spoolFileMode   = 0600
+)
+
+// SpoolConfiguration describes a local directory in which the batches of telemetry which cannot be sent are kept, so that they are sent
+// once ingestion succeeds again, including by the next process to use the directory. Zero values use the defaults.
+type SpoolConfiguration struct {
+	// Directory holds the spooled batches. It is created if needed, and should not be shared by processes running at the same time.
+	Directory string
+
+	// MaxSize is the total size in bytes of the spooled batches, beyond which the oldest are removed.
+	MaxSize int64
+
+	// MaxAge is the age after which a spooled batch is removed.
+	MaxAge time.Duration
+
+	// MinBackoff is the wait before the first retry of the spooled batches, which doubles after each failure up to the MaxBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the longest wait between retries of the spooled batches.
+	MaxBackoff time.Duration
+
+	// SendTimeout is the time allowed to send a batch before it is treated as failed and spooled.
+	SendTimeout time.Duration
+}
+
+// spool is an http.RoundTripper which persists the batches that fail to send with a retryable error, reporting them to the channel as
+// accepted so that it does not also retry them, and replays them in order in the background
+type spool struct {
+	configuration SpoolConfiguration
+	endpointURL   string
+	transport     http.RoundTripper
+	clock         telemetry.Clock
+	mutex         sync.Mutex
+	sequence      int
+	ingested      chan struct{}
+	persisted     chan struct{}
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// newSpool creates the spool and starts replaying any batches left in the directory by a previous process
+func newSpool(configuration SpoolConfiguration, endpointURL string, transport http.RoundTripper, clock telemetry.Clock) *spool {
+	if configuration.MaxSize <= 0 {
+		configuration.MaxSize = DefaultSpoolMaxSize
+	}
+
+	if configuration.MaxAge <= 0 {
+		configuration.MaxAge = DefaultSpoolMaxAge
+	}
+
+	if configuration.MinBackoff <= 0 {
+		configuration.MinBackoff = DefaultSpoolMinBackoff
+	}
+
+	if configuration.MaxBackoff < configuration.MinBackoff {
+		configuration.MaxBackoff = DefaultSpoolMaxBackoff
+	}
+
+	if configuration.SendTimeout <= 0 {
+		configuration.SendTimeout = DefaultSpoolSendTimeout
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	s := &spool{
+		configuration: configuration,
+		endpointURL:   endpointURL,
+		transport:     transport,
+		clock:         clock,
+		ingested:      make(chan struct{}, 1),
+		persisted:     make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	go s.replayLoop()
+
+	return s
+}
+
+// RoundTrip sends the batch, spooling it if it cannot be sent
+func (s *spool) RoundTrip(request *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.send(request.Context(), request.URL.String(), request.Header, body)
+	if err == nil && !isRetryable(response.StatusCode) {
+		if response.StatusCode == http.StatusOK {
+			signal(s.ingested)
+		}
+
+		return response, nil
+	}
+
+	if persistErr := s.persist(body); persistErr != nil {
+		log.Printf("ApplicationInsights spool error: %v", persistErr)
+
+		// The channel retries the batch in memory instead
+		return response, err
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader("{}")),
+		ContentLength: 2,
+		Request:       request,
+	}, nil
+}
+
+// close stops replaying the spooled batches. Those which remain are replayed by the next process to use the directory.
+func (s *spool) close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+
+	<-s.done
+}
+
+// send posts the batch, allowing it the send timeout
+func (s *spool) send(ctx context.Context, url string, header http.Header, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.configuration.SendTimeout)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	request.Header = header.Clone()
+
+	response, err := s.transport.RoundTrip(request)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The response body is read fully so that the timeout can be released before it is returned
+	responseBody, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	cancel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(responseBody))
+	return response, nil
+}
+
+// persist writes the batch to a new file in the spool, removing the oldest batches if the spool would exceed its maximum size
+func (s *spool) persist(body []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.configuration.Directory, 0700); err != nil {
+		return err
+	}
+
+	files, size := s.list()
+	for len(files) > 0 && size+int64(len(body)) > s.configuration.MaxSize {
+		size -= files[0].size
+		s.remove(files[0].path, "the spool is full")
+		files = files[1:]
+	}
+
+	s.sequence++
+	name := fmt.Sprintf("%020d-%06d", s.clock.Now().UnixNano(), s.sequence%1000000)
+	path := filepath.Join(s.configuration.Directory, name+spoolSuffix)
+
+	if err := os.WriteFile(path+spoolTempSuffix, body, spoolFileMode); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path+spoolTempSuffix, path); err != nil {
+		return err
+	}
+
+	signal(s.persisted)
+	return nil
+}
+
+// partialResponse is the body of a 206 Partial Content response, which lists the items of the batch that were not accepted by their index
+type partialResponse struct {
+	Errors []struct {
+		Index      int    `json:"index"`
+		StatusCode int    `json:"statusCode"`
+		Message    string `json:"message"`
+	} `json:"errors"`
+}
+
+// spooledBatch is a batch in the spool directory
+type spooledBatch struct {
+	path string
+	size int64
+}
+
+// list finds the spooled batches, oldest first, removing those which have expired. It is called with the mutex held.
+func (s *spool) list() ([]spooledBatch, int64) {
+	entries, err := os.ReadDir(s.configuration.Directory)
+	if err != nil {
+		return nil, 0
+	}
+
+	var batches []spooledBatch
+	var size int64
+
+	expiry := s.clock.Now().Add(-s.configuration.MaxAge).UnixNano()
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSuffix) {
+			continue
+		}
+
+		path := filepath.Join(s.configuration.Directory, name)
+
+		if created, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64); err != nil || created < expiry {
+			s.remove(path, "it has expired")
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		batches = append(batches, spooledBatch{path: path, size: info.Size()})
+		size += info.Size()
+	}
+
+	sort.Slice(batches, func(i, j int) bool { return batches[i].path < batches[j].path })
+
+	return batches, size
+}
+
+func (s *spool) remove(path string, reason string) {
+	if err := os.Remove(path); err == nil {
+		log.Printf("ApplicationInsights spool removed %v as %v", filepath.Base(path), reason)
+	}
+}
+
+// replayLoop sends the spooled batches, waiting with exponential backoff while they cannot be sent. A successful send by the channel ends
+// the wait early, as ingestion has recovered.
+func (s *spool) replayLoop() {
+	defer close(s.done)
+
+	var backoff time.Duration
+
+	for {
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-s.ingested:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+
+		if !s.replay() {
+			backoff = s.nextBackoff(backoff)
+			continue
+		}
+
+		// Everything has been sent, so wait for a batch to be spooled, which has only just failed to send
+		select {
+		case <-s.stop:
+			return
+		case <-s.persisted:
+			backoff = s.configuration.MinBackoff
+		}
+	}
+}
+
+// nextBackoff doubles the backoff, within the minimum and maximum
+func (s *spool) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+
+	if backoff < s.configuration.MinBackoff {
+		return s.configuration.MinBackoff
+	}
+
+	if backoff > s.configuration.MaxBackoff {
+		return s.configuration.MaxBackoff
+	}
+
+	return backoff
+}
+
+// replay sends the spooled batches in order, returning false if it stopped because a batch could not be sent
+func (s *spool) replay() bool {
+	for {
+		s.mutex.Lock()
+		batches, _ := s.list()
+		s.mutex.Unlock()
+
+		if len(batches) == 0 {
+			return true
+		}
+
+		select {
+		case <-s.stop:
+			return false
+		default:
+		}
+
+		body, err := os.ReadFile(batches[0].path)
+		if err != nil {
+			s.mutex.Lock()
+			s.remove(batches[0].path, "it cannot be read")
+			s.mutex.Unlock()
+			continue
+		}
+
+		header := http.Header{}
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Content-Type", "application/x-json-stream")
+
+		response, err := s.send(context.Background(), s.endpointURL, header, body)
+		if err != nil || isRetryable(response.StatusCode) {
+			return false
+		}
+
+		respooled := response.StatusCode == http.StatusPartialContent && s.respool(body, response)
+
+		s.mutex.Lock()
+		if response.StatusCode == http.StatusOK || response.StatusCode == http.StatusPartialContent {
+			_ = os.Remove(batches[0].path)
+		} else {
+			s.remove(batches[0].path, fmt.Sprintf("it was rejected with status %v", response.StatusCode))
+		}
+		s.mutex.Unlock()
+
+		// The items spooled again have only just failed, so they are retried after the backoff
+		if respooled {
+			return false
+		}
+	}
+}
+
+// respool spools the items of a partially accepted batch which failed with a retryable status again, returning whether there were any. The
+// items which were rejected outright are lost, which is reported to the diagnostics handler.
+func (s *spool) respool(body []byte, response *http.Response) bool {
+	var partial partialResponse
+	if err := json.NewDecoder(response.Body).Decode(&partial); err != nil {
+		telemetry.ReportDiagnostic(fmt.Errorf("ApplicationInsights partially accepted a spooled batch, but its response cannot be read: %w", err))
+		return false
+	}
+
+	items, err := decompress(body)
+	if err != nil {
+		telemetry.ReportDiagnostic(fmt.Errorf("ApplicationInsights partially accepted a spooled batch, which cannot be read: %w", err))
+		return false
+	}
+
+	var retry [][]byte
+	var rejected []string
+
+	for _, failure := range partial.Errors {
+		if failure.Index >= 0 && failure.Index < len(items) && isRetryable(failure.StatusCode) {
+			retry = append(retry, items[failure.Index])
+		} else {
+			rejected = append(rejected, fmt.Sprintf("%v (%v)", failure.StatusCode, failure.Message))
+		}
+	}
+
+	if len(rejected) > 0 {
+		telemetry.ReportDiagnostic(fmt.Errorf("ApplicationInsights rejected %v items of a spooled batch: %v", len(rejected),
+			strings.Join(rejected, ", ")))
+	}
+
+	if len(retry) == 0 {
+		return false
+	}
+
+	if err := s.persist(compress(bytes.Join(retry, []byte("\n")))); err != nil {
+		telemetry.ReportDiagnostic(fmt.Errorf("unable to spool %v items of a partially accepted batch again: %w", len(retry), err))
+		return false
+	}
+
+	return true
+}
+
+// decompress splits a gzipped batch into its items, one per line
+func decompress(body []byte) ([][]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.Split(bytes.TrimRight(content, "\n"), []byte("\n")), nil
+}
+
+// compress gzips the content as a batch
+func compress(content []byte) []byte {
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	_, _ = writer.Write(content)
+	_ = writer.Close()
+
+	return buffer.Bytes()
+}
+
+// isRetryable indicates whether the whole batch failed with a status which ApplicationInsights expects to be retried
+func isRetryable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, 439, http.StatusInternalServerError, http.StatusServiceUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// signal notifies the channel without blocking, if it has not already been notified
+func signal(channel chan struct{}) {
+	select {
+	case channel <- struct{}{}:
+	default:
+	}
+}
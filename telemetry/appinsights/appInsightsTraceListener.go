@@ -1,6 +1,8 @@
 package appinsights
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
@@ -10,36 +12,90 @@ import (
 )
 
 type appInsightsTraceListener struct {
-	client appinsights.TelemetryClient
+	client       appinsights.TelemetryClient
+	clock        telemetry.Clock
+	spool        *spool
+	initializers []TelemetryInitializer
+}
+
+// appInsightsSettings are the settings of an "appinsights" listener in a configuration file
+type appInsightsSettings struct {
+	Service            string `json:"service"`
+	Version            string `json:"version"`
+	InstrumentationKey string `json:"instrumentationKey"`
+	ConnectionString   string `json:"connectionString"`
+}
+
+func init() {
+	telemetry.RegisterListenerFactory("appinsights", newApplicationInsightsTraceListenerFromSettings)
 }
 
 // NewApplicationInsightsTraceListener creates a trace listener which outputs to the Azure ApplicationInsights instance specified by the provided
-// instrumentation key. It limits output based on the logging level supplied
-func NewApplicationInsightsTraceListener(service, version string, instrumentationKey string) telemetry.TraceListener {
-	client := appinsights.NewTelemetryClient(instrumentationKey)
+// instrumentation key. Item timestamps and durations are taken from the Clock in the options (the system clock by default)
+func NewApplicationInsightsTraceListener(service, version string, instrumentationKey string, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	configuration := &TelemetryConfiguration{InstrumentationKey: instrumentationKey}
+
+	return NewApplicationInsightsTraceListenerWithConfiguration(service, version, configuration, options...)
+}
+
+// NewApplicationInsightsTraceListenerFromConnectionString creates a trace listener which outputs to the ApplicationInsights instance and
+// ingestion endpoint specified by the connection string, as issued by the Azure portal
+func NewApplicationInsightsTraceListenerFromConnectionString(service, version string, connectionString string, options ...telemetry.ListenerOption) (telemetry.TraceListener, error) {
+	configuration, err := NewTelemetryConfiguration(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewApplicationInsightsTraceListenerWithConfiguration(service, version, configuration, options...), nil
+}
+
+// NewApplicationInsightsTraceListenerWithConfiguration creates a trace listener which outputs to ApplicationInsights as described by the
+// configuration, e.g. to a stand-in server in integration tests. Settings which are not set use the defaults. If the configuration has a
+// spool, the batches left in it by a previous process are sent in the background.
+func NewApplicationInsightsTraceListenerWithConfiguration(service, version string, configuration *TelemetryConfiguration, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	settings := telemetry.NewListenerOptions(options...)
+	clientConfiguration, spool := configuration.toClientConfiguration(settings.Clock)
+	client := appinsights.NewTelemetryClientFromConfig(clientConfiguration)
 	host, _ := os.Hostname()
 
 	client.Context().Tags.Cloud().SetRole(service)
 	client.Context().Tags.Cloud().SetRoleInstance(host)
 	client.Context().Tags.Application().SetVer(version)
 
-	traceListener := &appInsightsTraceListener{client: client}
+	traceListener := &appInsightsTraceListener{
+		client:       client,
+		clock:        settings.Clock,
+		spool:        spool,
+		initializers: append([]TelemetryInitializer(nil), configuration.Initializers...),
+	}
+
 	return traceListener
 }
 
-func (aitl *appInsightsTraceListener) TraceMessage(message string, severity telemetry.Severity) {
-	track := appinsights.NewTraceTelemetry(message, toAppInsightsSeverity(severity))
-	track.Timestamp = time.Now()
+// newApplicationInsightsTraceListenerFromSettings creates an ApplicationInsights trace listener from its settings, which require either the
+// "connectionString" or the "instrumentationKey"
+func newApplicationInsightsTraceListenerFromSettings(settings map[string]any) (telemetry.TraceListener, error) {
+	var ais appInsightsSettings
+	if err := telemetry.DecodeSettings(settings, &ais); err != nil {
+		return nil, err
+	}
 
-	aitl.client.Track(track)
+	switch {
+	case ais.ConnectionString != "":
+		return NewApplicationInsightsTraceListenerFromConnectionString(ais.Service, ais.Version, ais.ConnectionString)
+	case ais.InstrumentationKey != "":
+		return NewApplicationInsightsTraceListener(ais.Service, ais.Version, ais.InstrumentationKey), nil
+	default:
+		return nil, errors.New("connectionString or instrumentationKey is required")
+	}
 }
 
-func (aitl *appInsightsTraceListener) TraceException(err error) {
-	track := appinsights.NewExceptionTelemetry(err)
-	track.SeverityLevel = contracts.Error
-	track.Frames = appinsights.GetCallstack(0)
+func (aitl *appInsightsTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	aitl.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
 
-	aitl.client.Track(track)
+func (aitl *appInsightsTraceListener) TraceException(err error) {
+	aitl.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
 }
 
 func (aitl *appInsightsTraceListener) TracePanic(rethrow bool) {
@@ -47,33 +103,68 @@ func (aitl *appInsightsTraceListener) TracePanic(rethrow bool) {
 }
 
 func (aitl *appInsightsTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
-	trace := newAvailabilityDurationTrace(aitl, name)
-
-	return &trace
+	return aitl.TrackItem(&telemetry.Item{Kind: telemetry.AvailabilityItem, Name: name})
 }
 
 func (aitl *appInsightsTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
-	trace := newRequestDurationTrace(aitl, method, uri)
-
-	return &trace
+	return aitl.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: method, URI: uri})
 }
 
 func (aitl *appInsightsTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
-	trace := newDependencyDurationTrace(aitl, name, dependencyType, target)
-
-	return &trace
+	return aitl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
 }
 
 func (aitl *appInsightsTraceListener) TraceMetric(name string, value float64) {
-	track := appinsights.NewMetricTelemetry(name, value)
-
-	aitl.client.Track(track)
+	aitl.TraceItem(&telemetry.Item{Kind: telemetry.MetricItem, Name: name, Value: value})
 }
 
 func (aitl *appInsightsTraceListener) TraceEvent(name string) {
-	track := appinsights.NewEventTelemetry(name)
+	aitl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: name})
+}
+
+func (aitl *appInsightsTraceListener) TraceItem(item *telemetry.Item) {
+	var track appinsights.Telemetry
 
-	aitl.client.Track(track)
+	switch item.Kind {
+	case telemetry.MessageItem:
+		track = appinsights.NewTraceTelemetry(item.Message, toAppInsightsSeverity(item.Severity))
+	case telemetry.ExceptionItem:
+		exception := appinsights.NewExceptionTelemetry(item.Err)
+		exception.SeverityLevel = contracts.Error
+		exception.Frames = appinsights.GetCallstack(0)
+		track = exception
+	case telemetry.MetricItem:
+		track = appinsights.NewMetricTelemetry(item.Name, item.Value)
+	case telemetry.EventItem:
+		track = appinsights.NewEventTelemetry(item.Name)
+	default:
+		return
+	}
+
+	track.SetTime(item.Time(aitl.clock))
+	aitl.track(track, item)
+}
+
+func (aitl *appInsightsTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	var trace telemetry.DurationTrace
+
+	switch item.Kind {
+	case telemetry.AvailabilityItem:
+		trace = &applicationInsightsAvailabilityDurationTrace{TraceState: aitl.newTraceState(item), traceListener: aitl, item: *item.Clone(), startTime: item.Time(aitl.clock), statusCode: "Incomplete"}
+	case telemetry.RequestItem:
+		trace = &applicationInsightsRequestDurationTrace{TraceState: aitl.newTraceState(item), traceListener: aitl, item: *item.Clone(), startTime: item.Time(aitl.clock), statusCode: "Incomplete"}
+	case telemetry.DependencyItem:
+		trace = &applicationInsightsDependencyDurationTrace{TraceState: aitl.newTraceState(item), traceListener: aitl, item: *item.Clone(), startTime: item.Time(aitl.clock), statusCode: "Incomplete"}
+	default:
+		return telemetry.NoopDurationTrace()
+	}
+
+	return &trace
+}
+
+// newTraceState creates the state of the trace of a tracked item, which starts at the item's time
+func (aitl *appInsightsTraceListener) newTraceState(item *telemetry.Item) telemetry.TraceState {
+	return telemetry.NewTraceState(item.Describe(), aitl.clock, item.Time(aitl.clock))
 }
 
 func (aitl *appInsightsTraceListener) Flush() {
@@ -89,39 +180,72 @@ func (aitl *appInsightsTraceListener) Close() {
 	}
 
 	aitl.client.SetIsEnabled(false)
-}
 
-func newAvailabilityDurationTrace(aitl *appInsightsTraceListener, name string) telemetry.DurationTrace {
-	return &applicationInsightsAvailabilityDurationTrace{
-		client:     &aitl.client,
-		name:       name,
-		startTime:  time.Now(),
-		success:    false,
-		statusCode: "Incomplete",
+	if aitl.spool != nil {
+		aitl.spool.close()
 	}
 }
 
-func newRequestDurationTrace(aitl *appInsightsTraceListener, method, uri string) telemetry.DurationTrace {
-	return &applicationInsightsRequestDurationTrace{
-		client:     &aitl.client,
-		method:     method,
-		uri:        uri,
-		startTime:  time.Now(),
-		success:    false,
-		statusCode: "Incomplete",
+// track sends the item, with its custom properties and measurements, as part of the operation it belongs to and linked to its parent, after running the initializers on it. Sampled items are enveloped here, as the client cannot set their sample rate.
+func (aitl *appInsightsTraceListener) track(track appinsights.Telemetry, item *telemetry.Item) {
+	if item.OperationID != "" && track.ContextTags() != nil {
+		track.ContextTags()[contracts.OperationId] = item.OperationID
+	}
+
+	if item.ParentID != "" && track.ContextTags() != nil {
+		track.ContextTags()[contracts.OperationParentId] = item.ParentID
+	}
+
+	if properties := track.GetProperties(); properties != nil {
+		for k, v := range item.Properties {
+			properties[k] = v
+		}
+	}
+
+	if measurements := track.GetMeasurements(); measurements != nil {
+		for k, v := range item.Measurements {
+			measurements[k] = v
+		}
+	}
+
+	for _, initialize := range aitl.initializers {
+		initialize(track)
+	}
+
+	if item.SampleRate <= 0 || item.SampleRate >= 100 {
+		aitl.client.Track(track)
+		return
+	}
+
+	if aitl.client.IsEnabled() {
+		aitl.client.Channel().Send(envelop(aitl.client, track, item.SampleRate))
 	}
 }
 
-func newDependencyDurationTrace(aitl *appInsightsTraceListener, name, dependencyType, target string) telemetry.DurationTrace {
-	return &applicationInsightsDependencyDurationTrace{
-		client:         &aitl.client,
-		name:           name,
-		dependencyType: dependencyType,
-		target:         target,
-		startTime:      time.Now(),
-		success:        false,
-		statusCode:     "Incomplete",
+// newChildItem creates the item of a child trace of the tracked item, giving the parent an ID if it has none. When the parent is not part of
+// an operation, its ID becomes the operation ID of both, so that the child is sent in the same operation as its parent.
+func newChildItem(parent *telemetry.Item, name string) *telemetry.Item {
+	if parent.ID == "" {
+		parent.ID = telemetry.NewSpanID()
+	}
+
+	if parent.OperationID == "" {
+		parent.OperationID = parent.ID
 	}
+
+	return telemetry.NewChildItem(parent, name)
+}
+
+// trackIncomplete reports a trace which was done without being completed or failed as a warning, with its properties and measurements, in
+// the same operation and beneath the same parent. The trace itself is tracked as failed with the result code "Incomplete", and the warning
+// explains that the activity may well have succeeded.
+func (aitl *appInsightsTraceListener) trackIncomplete(description string, startTime time.Time, endTime time.Time, item *telemetry.Item) {
+	message := fmt.Sprintf("The %v was done without being completed or failed, after %vms", description, endTime.Sub(startTime).Milliseconds())
+	warning := appinsights.NewTraceTelemetry(message, contracts.Warning)
+	warning.SetTime(endTime)
+
+	aitl.track(warning, &telemetry.Item{OperationID: item.OperationID, ParentID: item.ParentID, SampleRate: item.SampleRate,
+		Properties: item.Properties, Measurements: item.Measurements})
 }
 
 func toAppInsightsSeverity(severity telemetry.Severity) contracts.SeverityLevel {
@@ -0,0 +1,865 @@
+package appinsights
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+// recordingTelemetryClient is an appinsights.TelemetryClient which records the tracked items instead of sending them
+type recordingTelemetryClient struct {
+	appinsights.TelemetryClient
+	context *appinsights.TelemetryContext
+	channel *recordingTelemetryChannel
+	items   []appinsights.Telemetry
+}
+
+func (rtc *recordingTelemetryClient) Track(item appinsights.Telemetry) {
+	rtc.items = append(rtc.items, item)
+}
+
+func (rtc *recordingTelemetryClient) Context() *appinsights.TelemetryContext {
+	return rtc.context
+}
+
+func (rtc *recordingTelemetryClient) InstrumentationKey() string {
+	return rtc.context.InstrumentationKey()
+}
+
+func (rtc *recordingTelemetryClient) Channel() appinsights.TelemetryChannel {
+	return rtc.channel
+}
+
+func (rtc *recordingTelemetryClient) IsEnabled() bool {
+	return true
+}
+
+// recordingTelemetryChannel is an appinsights.TelemetryChannel which records the envelopes sent directly to it
+type recordingTelemetryChannel struct {
+	appinsights.TelemetryChannel
+	envelopes []*contracts.Envelope
+}
+
+func (rtc *recordingTelemetryChannel) Send(envelope *contracts.Envelope) {
+	rtc.envelopes = append(rtc.envelopes, envelope)
+}
+
+func newTestTraceListener(clock telemetry.Clock) (*appInsightsTraceListener, *recordingTelemetryClient) {
+	client := &recordingTelemetryClient{
+		context: appinsights.NewTelemetryContext("0000-1111"),
+		channel: &recordingTelemetryChannel{},
+	}
+	client.context.Tags.Cloud().SetRole("Test")
+
+	return &appInsightsTraceListener{client: client, clock: clock}, client
+}
+
+func TestItemsHaveExactTimestampsAndDurations(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+
+	t.Log("Given an ApplicationInsights trace listener using a manual clock")
+	{
+		clock := telemetrytest.NewManualClock(start)
+		tl, client := newTestTraceListener(clock)
+
+		t.Log("\tWhen a message is traced")
+		{
+			tl.TraceMessage("Test message", telemetry.Warning)
+			item := client.items[0].(*appinsights.TraceTelemetry)
+
+			if item.Timestamp.Equal(start) {
+				t.Logf("\t\t[%v] The item is timestamped by the clock.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The item is timestamped by the clock. Expected: %v, Actual: %v", ballotX, start, item.Timestamp)
+			}
+		}
+
+		t.Log("\tWhen a request is completed after 250ms")
+		{
+			dt := tl.TrackRequest("GET", "/orders")
+			clock.Advance(250 * time.Millisecond)
+			(*dt).Complete()
+			(*dt).Done()
+
+			item := client.items[1].(*appinsights.RequestTelemetry)
+
+			if item.Duration == 250*time.Millisecond && item.Timestamp.Equal(start) && item.Success {
+				t.Logf("\t\t[%v] The request has the exact duration and start time.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request has the exact duration and start time. Actual: %v at %v", ballotX, item.Duration, item.Timestamp)
+			}
+		}
+
+		t.Log("\tWhen a dependency is failed after 1.5s")
+		{
+			dt := tl.TrackDependency("db", "SQL", "server")
+			clock.Advance(1500 * time.Millisecond)
+			(*dt).Fail("500")
+			(*dt).Done()
+
+			item := client.items[2].(*appinsights.RemoteDependencyTelemetry)
+
+			if item.Duration == 1500*time.Millisecond && item.ResultCode == "500" && !item.Success {
+				t.Logf("\t\t[%v] The dependency has the exact duration and result.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency has the exact duration and result. Actual: %v %v %v", ballotX, item.Duration, item.ResultCode, item.Success)
+			}
+		}
+
+		t.Log("\tWhen an availability test is completed after 2s")
+		{
+			dt := tl.TrackAvailability("health")
+			clock.Advance(2 * time.Second)
+			(*dt).Complete()
+			(*dt).Done()
+
+			item := client.items[3].(*appinsights.AvailabilityTelemetry)
+
+			if item.Duration == 2*time.Second && item.Success {
+				t.Logf("\t\t[%v] The availability result has the exact duration.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The availability result has the exact duration. Actual: %v", ballotX, item.Duration)
+			}
+		}
+	}
+}
+
+func TestSampledItemsCarryTheirSampleRateAndOperation(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+
+	t.Log("Given an ApplicationInsights trace listener")
+	{
+		tl, client := newTestTraceListener(telemetrytest.NewManualClock(start))
+
+		t.Log("\tWhen an item sampled at 25% is traced")
+		{
+			tl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: "Test", OperationID: "op-1", SampleRate: 25})
+
+			if len(client.channel.envelopes) == 1 && len(client.items) == 0 {
+				envelope := client.channel.envelopes[0]
+
+				if envelope.SampleRate == 25 {
+					t.Logf("\t\t[%v] The envelope carries the sample rate.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The envelope carries the sample rate. Actual: %v", ballotX, envelope.SampleRate)
+				}
+
+				if envelope.Tags[contracts.OperationId] == "op-1" && envelope.Tags[contracts.CloudRole] == "Test" {
+					t.Logf("\t\t[%v] The envelope carries the operation and the client's tags.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The envelope carries the operation and the client's tags. Actual: %v", ballotX, envelope.Tags)
+				}
+
+				if envelope.Time == "2020-03-04T09:30:15Z" && envelope.Name == "Microsoft.ApplicationInsights.00001111.Event" {
+					t.Logf("\t\t[%v] The envelope is named and timestamped as the client would.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The envelope is named and timestamped as the client would. Actual: %v at %v", ballotX, envelope.Name, envelope.Time)
+				}
+			} else {
+				t.Errorf("\t\t[%v] The item is sent directly to the channel. Actual: %v envelopes, %v items", ballotX, len(client.channel.envelopes), len(client.items))
+			}
+		}
+
+		t.Log("\tWhen an unsampled dependency in an operation is tracked")
+		{
+			dt := tl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: "db", OperationID: "op-2"})
+			(*dt).Complete()
+			(*dt).Done()
+
+			if len(client.items) == 1 && client.items[0].ContextTags()[contracts.OperationId] == "op-2" {
+				t.Logf("\t\t[%v] The dependency is tracked by the client as part of the operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency is tracked by the client as part of the operation.", ballotX)
+			}
+		}
+	}
+}
+
+func TestDurationTraceDetailsAreTracked(t *testing.T) {
+	t.Log("Given a listener")
+	{
+		tl, client := newTestTraceListener(telemetrytest.NewManualClock(time.Now()))
+
+		t.Log("\tWhen details are set on a request, a dependency and an availability test")
+		{
+			properties := map[string]string{"tenant": "contoso"}
+			request := tl.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: "GET", URI: "/orders/id", Properties: properties})
+			(*request).SetSource("checkout")
+			(*request).SetURL("https://example.com/orders/42")
+			(*request).SetProperty("region", "west")
+			(*request).SetMeasurement("items", 3)
+			(*request).Complete()
+			(*request).Done()
+
+			dependency := tl.TrackDependency("db", "SQL", "server")
+			(*dependency).SetData("SELECT * FROM orders")
+			(*dependency).Complete()
+			(*dependency).Done()
+
+			availability := tl.TrackAvailability("ping")
+			(*availability).SetRunLocation("westeurope")
+			(*availability).Complete()
+			(*availability).Done()
+
+			if len(client.items) != 3 {
+				t.Fatalf("\t\t[%v] The three traces should be tracked. Actual: %v items", ballotX, len(client.items))
+			}
+
+			requestTelemetry := client.items[0].(*appinsights.RequestTelemetry)
+			if requestTelemetry.Source == "checkout" && requestTelemetry.Url == "https://example.com/orders/42" && requestTelemetry.Name == "GET /orders/id" {
+				t.Logf("\t\t[%v] The request has its source and URL, and is named by its URI.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request has its source and URL, and is named by its URI. Actual: %+v", ballotX, requestTelemetry)
+			}
+
+			if requestTelemetry.Properties["tenant"] == "contoso" && requestTelemetry.Properties["region"] == "west" && requestTelemetry.Measurements["items"] == 3 {
+				t.Logf("\t\t[%v] The request has the item's properties, and those and the measurements set on the trace.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request has the item's properties, and those and the measurements set on the trace. Actual: %v %v", ballotX, requestTelemetry.Properties, requestTelemetry.Measurements)
+			}
+
+			if _, shared := properties["region"]; !shared {
+				t.Logf("\t\t[%v] The item's properties are not modified.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The item's properties are not modified. Actual: %v", ballotX, properties)
+			}
+
+			dependencyData := client.items[1].(*appinsights.RemoteDependencyTelemetry).Data
+			runLocation := client.items[2].(*appinsights.AvailabilityTelemetry).RunLocation
+
+			if dependencyData == "SELECT * FROM orders" && runLocation == "westeurope" {
+				t.Logf("\t\t[%v] The dependency has its data and the availability test its run location.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency has its data and the availability test its run location. Actual: %q %q", ballotX, dependencyData, runLocation)
+			}
+		}
+	}
+}
+
+func TestStatusCodesAreClassifiedAndIncompleteTracesReported(t *testing.T) {
+	t.Log("Given a listener")
+	{
+		tl, client := newTestTraceListener(telemetrytest.NewManualClock(time.Now()))
+
+		t.Log("\tWhen requests end with numeric and custom status codes")
+		{
+			for _, code := range []int{200, 302, 404, 503} {
+				request := tl.TrackRequest("GET", "/orders")
+				(*request).SetStatusCode(code)
+				(*request).Done()
+			}
+
+			request := tl.TrackRequest("DELETE", "/orders")
+			(*request).CompleteWithStatus("204")
+			(*request).Done()
+
+			var results []string
+			for _, item := range client.items {
+				request := item.(*appinsights.RequestTelemetry)
+				results = append(results, fmt.Sprintf("%v:%v", request.ResponseCode, request.Success))
+			}
+
+			if fmt.Sprint(results) == "[200:true 302:true 404:false 503:false 204:true]" {
+				t.Logf("\t\t[%v] The codes are the result codes, and those below 400 are successful.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The codes are the result codes, and those below 400 are successful. Actual: %v", ballotX, results)
+			}
+		}
+
+		t.Log("\tWhen a dependency in an operation is done without being completed or failed")
+		{
+			client.items = nil
+
+			dependency := tl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: "db", OperationID: "op-1", ParentID: "request-1"})
+			(*dependency).SetProperty("tenant", "contoso")
+			(*dependency).Done()
+
+			if len(client.items) != 2 {
+				t.Fatalf("\t\t[%v] The dependency and a warning should be tracked. Actual: %v items", ballotX, len(client.items))
+			}
+
+			dependencyTelemetry, ok := client.items[0].(*appinsights.RemoteDependencyTelemetry)
+			if ok && dependencyTelemetry.ResultCode == telemetry.IncompleteStatusCode && !dependencyTelemetry.Success {
+				t.Logf("\t\t[%v] The dependency is tracked as failed with the result code Incomplete.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency is tracked as failed with the result code Incomplete. Actual: %+v", ballotX, client.items[0])
+			}
+
+			warning, ok := client.items[1].(*appinsights.TraceTelemetry)
+			if ok && warning.SeverityLevel == contracts.Warning && strings.Contains(warning.Message, "dependency db") {
+				t.Logf("\t\t[%v] A warning naming the dependency is tracked as well.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] A warning naming the dependency is tracked as well. Actual: %+v", ballotX, client.items[1])
+			}
+
+			if ok && warning.ContextTags()[contracts.OperationId] == "op-1" && warning.ContextTags()[contracts.OperationParentId] == "request-1" &&
+				warning.Properties["tenant"] == "contoso" {
+				t.Logf("\t\t[%v] The warning is in the dependency's operation, beneath its parent, with its properties.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The warning is in the dependency's operation, beneath its parent, with its properties. Actual: %+v", ballotX, warning)
+			}
+		}
+	}
+}
+
+func TestInitializersSetTagsAndProperties(t *testing.T) {
+	t.Log("Given a listener with initializers for common properties, device and location tags, and user and session properties")
+	{
+		tl, client := newTestTraceListener(telemetrytest.NewManualClock(time.Now()))
+		tl.initializers = []TelemetryInitializer{
+			CommonProperties(map[string]string{"Build": "1234", "Commit": "abc123"}),
+			ContextTags(map[string]string{contracts.DeviceType: "Server", contracts.LocationIp: "10.0.0.1"}),
+			PropertyTags(map[string]string{"userId": contracts.UserId, "sessionId": contracts.SessionId}),
+		}
+
+		t.Log("\tWhen an event with a user, session and its own commit is traced")
+		{
+			properties := map[string]string{"userId": "user-1", "sessionId": "session-1", "Commit": "def456"}
+			tl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: "Test", Properties: properties})
+
+			if len(client.items) != 1 {
+				t.Fatalf("\t\t[%v] The event should be tracked. Actual: %v items", ballotX, len(client.items))
+			}
+
+			tags := client.items[0].ContextTags()
+			itemProperties := client.items[0].GetProperties()
+
+			if itemProperties["Build"] == "1234" && itemProperties["Commit"] == "def456" {
+				t.Logf("\t\t[%v] The common properties are added without replacing the item's own.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The common properties are added without replacing the item's own. Actual: %v", ballotX, itemProperties)
+			}
+
+			if tags[contracts.DeviceType] == "Server" && tags[contracts.LocationIp] == "10.0.0.1" {
+				t.Logf("\t\t[%v] The device and location tags are set.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The device and location tags are set. Actual: %v", ballotX, tags)
+			}
+
+			_, hasUser := itemProperties["userId"]
+			if tags[contracts.UserId] == "user-1" && tags[contracts.SessionId] == "session-1" && !hasUser {
+				t.Logf("\t\t[%v] The user and session properties are moved to their tags.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The user and session properties are moved to their tags. Actual: %v %v", ballotX, tags, itemProperties)
+			}
+		}
+	}
+
+	t.Log("Given the environment and cgroup file of a container in a Kubernetes pod")
+	{
+		environment := map[string]string{"POD_NAME": "orders-5d8f7", "KUBERNETES_NAMESPACE": "shop", "POD_NAMESPACE": "default", "NODE_NAME": ""}
+		cgroup := "12:memory:/kubepods/besteffort/pod0a1b2c3d\n" +
+			"0::/kubepods/besteffort/pod0a1b2c3d/cri-containerd-" + strings.Repeat("3f", 32) + ".scope\n"
+
+		t.Log("\tWhen the Kubernetes properties and container ID are read")
+		{
+			properties := kubernetesProperties(func(name string) (string, bool) {
+				value, ok := environment[name]
+				return value, ok
+			})
+
+			expected := map[string]string{"Kubernetes.Pod.Name": "orders-5d8f7", "Kubernetes.Pod.Namespace": "shop"}
+			if fmt.Sprint(properties) == fmt.Sprint(expected) {
+				t.Logf("\t\t[%v] The set variables are read, preferring the KUBERNETES_ prefixed names.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The set variables are read, preferring the KUBERNETES_ prefixed names. Actual: %v", ballotX, properties)
+			}
+
+			if id := containerID(strings.NewReader(cgroup)); id == strings.Repeat("3f", 32) {
+				t.Logf("\t\t[%v] The container ID is found in the cgroup path.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The container ID is found in the cgroup path. Actual: %q", ballotX, id)
+			}
+
+			if id := containerID(strings.NewReader("0::/\n")); id == "" {
+				t.Logf("\t\t[%v] No container ID is found outside a container.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] No container ID is found outside a container. Actual: %q", ballotX, id)
+			}
+		}
+	}
+}
+
+// ingestionServer is a stand-in for the ApplicationInsights ingestion endpoint which records the batches posted to it
+type ingestionServer struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	paths       []string
+	batches     []string
+	unavailable bool
+}
+
+func newIngestionServer() *ingestionServer {
+	is := &ingestionServer{}
+	is.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		body, _ := io.ReadAll(reader)
+		count := strings.Count(strings.TrimSpace(string(body)), "\n") + 1
+
+		is.mutex.Lock()
+		if is.unavailable {
+			is.mutex.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		is.paths = append(is.paths, r.URL.Path)
+		is.batches = append(is.batches, string(body))
+		is.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, fmt.Sprintf(`{"itemsReceived":%v,"itemsAccepted":%v,"errors":[]}`, count, count))
+	}))
+
+	return is
+}
+
+func (is *ingestionServer) received() ([]string, []string) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	return append([]string{}, is.paths...), append([]string{}, is.batches...)
+}
+
+// setAvailable makes the server accept batches, or reject them all with 503 Service Unavailable
+func (is *ingestionServer) setAvailable(available bool) {
+	is.mutex.Lock()
+	is.unavailable = !available
+	is.mutex.Unlock()
+}
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	mutex    sync.Mutex
+	requests int
+}
+
+func (ct *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ct.mutex.Lock()
+	ct.requests++
+	ct.mutex.Unlock()
+
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestConnectionStringsAreParsed(t *testing.T) {
+	tests := []struct {
+		connectionString string
+		key              string
+		endpointURL      string
+		fails            bool
+	}{
+		{"InstrumentationKey=0000-1111", "0000-1111", DefaultEndpointURL, false},
+		{"InstrumentationKey=0000-1111;IngestionEndpoint=https://westeurope-5.in.applicationinsights.azure.com/;LiveEndpoint=https://live/",
+			"0000-1111", "https://westeurope-5.in.applicationinsights.azure.com/v2/track", false},
+		{"instrumentationkey=0000-1111; EndpointSuffix=applicationinsights.azure.cn;", "0000-1111", "https://dc.applicationinsights.azure.cn/v2/track", false},
+		{"0000-1111", "0000-1111", DefaultEndpointURL, false},
+		{"IngestionEndpoint=https://example.com/", "", "", true},
+		{"InstrumentationKey=0000-1111;IngestionEndpoint=example.com", "", "", true},
+		{"InstrumentationKey=0000-1111;Endpoint", "", "", true},
+		{"", "", "", true},
+	}
+
+	t.Log("Given a set of connection strings")
+	{
+		for _, test := range tests {
+			t.Logf("\tWhen the configuration is created from \"%v\"", test.connectionString)
+			{
+				configuration, err := NewTelemetryConfiguration(test.connectionString)
+
+				switch {
+				case test.fails && err != nil:
+					t.Logf("\t\t[%v] The connection string is rejected: %v", checkMark, err)
+				case test.fails:
+					t.Errorf("\t\t[%v] The connection string is rejected. Actual: %+v", ballotX, configuration)
+				case err != nil:
+					t.Errorf("\t\t[%v] The connection string is accepted. Error: %v", ballotX, err)
+				case configuration.InstrumentationKey == test.key && configuration.EndpointURL == test.endpointURL &&
+					configuration.MaxBatchSize == DefaultMaxBatchSize && configuration.MaxBatchInterval == DefaultMaxBatchInterval:
+					t.Logf("\t\t[%v] The key and endpoint are read, with the default batching.", checkMark)
+				default:
+					t.Errorf("\t\t[%v] The key and endpoint are read, with the default batching. Actual: %+v", ballotX, configuration)
+				}
+			}
+		}
+	}
+}
+
+func TestTelemetryIsSentToTheConfiguredEndpoint(t *testing.T) {
+	server := newIngestionServer()
+	defer server.Close()
+
+	t.Log("Given a listener created from a connection string with the ingestion endpoint of a stand-in server")
+	{
+		tl, err := NewApplicationInsightsTraceListenerFromConnectionString("Test", "1.0", "InstrumentationKey=0000-1111;IngestionEndpoint="+server.URL)
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should be created. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen a message is traced and the listener is closed")
+		{
+			tl.TraceMessage("Sent to the stand-in", telemetry.Warning)
+			tl.Close()
+
+			paths, batches := server.received()
+
+			if len(batches) == 1 && paths[0] == "/v2/track" && strings.Contains(batches[0], "Sent to the stand-in") &&
+				strings.Contains(batches[0], `"iKey":"0000-1111"`) {
+				t.Logf("\t\t[%v] The message is posted to the ingestion endpoint with the instrumentation key.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message is posted to the ingestion endpoint with the instrumentation key. Actual: %v %v", ballotX, paths, batches)
+			}
+		}
+	}
+
+	t.Log("Given a listener configured with a custom HTTP client and a batch size of 2")
+	{
+		transport := &countingTransport{}
+		configuration := &TelemetryConfiguration{
+			InstrumentationKey: "0000-1111",
+			EndpointURL:        server.URL + "/custom/track",
+			MaxBatchSize:       2,
+			MaxBatchInterval:   time.Hour,
+			HTTPClient:         &http.Client{Transport: transport},
+		}
+
+		tl := NewApplicationInsightsTraceListenerWithConfiguration("Test", "1.0", configuration)
+
+		t.Log("\tWhen four events are traced and the listener is closed")
+		{
+			for i := 0; i < 4; i++ {
+				tl.TraceEvent("Batched")
+			}
+
+			tl.Close()
+
+			paths, batches := server.received()
+			paths, batches = paths[1:], batches[1:]
+
+			if len(batches) == 2 && paths[0] == "/custom/track" && strings.Count(batches[0]+batches[1], "Batched") == 4 {
+				t.Logf("\t\t[%v] The events are posted to the endpoint URL in batches of 2.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The events are posted to the endpoint URL in batches of 2. Actual: %v %v", ballotX, paths, batches)
+			}
+
+			if transport.requests == 2 {
+				t.Logf("\t\t[%v] The batches are sent by the configured HTTP client.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The batches are sent by the configured HTTP client. Actual: %v requests", ballotX, transport.requests)
+			}
+		}
+	}
+}
+
+// failingTransport fails every request, as if the network is down
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("the network is down")
+}
+
+// spooledFiles returns the names of the batches in the spool directory
+func spooledFiles(t *testing.T, directory string) []string {
+	matches, err := filepath.Glob(filepath.Join(directory, "*"+spoolSuffix))
+	if err != nil {
+		t.Fatalf("\t[%v] The spool directory should be listed. Error: %v", ballotX, err)
+	}
+
+	return matches
+}
+
+// waitFor polls the condition until it holds or the timeout expires, returning whether it held
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return true
+}
+
+func TestFailedBatchesAreSpooledAndReplayed(t *testing.T) {
+	server := newIngestionServer()
+	defer server.Close()
+
+	directory := t.TempDir()
+	configuration := &TelemetryConfiguration{
+		InstrumentationKey: "0000-1111",
+		EndpointURL:        server.URL + "/v2/track",
+		MaxBatchInterval:   time.Hour,
+		Spool:              &SpoolConfiguration{Directory: directory, MinBackoff: time.Hour},
+	}
+
+	t.Log("Given a spooling listener whose ingestion endpoint is unavailable")
+	{
+		server.setAvailable(false)
+		tl := NewApplicationInsightsTraceListenerWithConfiguration("Test", "1.0", configuration)
+
+		t.Log("\tWhen an event is traced and the listener is closed")
+		{
+			tl.TraceEvent("Spooled")
+			tl.Close()
+
+			if files := spooledFiles(t, directory); len(files) == 1 {
+				t.Logf("\t\t[%v] The batch is written to the spool directory.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The batch is written to the spool directory. Actual: %v", ballotX, files)
+			}
+
+			if _, batches := server.received(); len(batches) == 0 {
+				t.Logf("\t\t[%v] Nothing is ingested.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Nothing is ingested. Actual: %v", ballotX, batches)
+			}
+		}
+	}
+
+	t.Log("Given a new spooling listener on the same directory once the ingestion endpoint is available")
+	{
+		server.setAvailable(true)
+		tl := NewApplicationInsightsTraceListenerWithConfiguration("Test", "1.0", configuration)
+
+		t.Log("\tWhen it starts")
+		{
+			replayed := waitFor(5*time.Second, func() bool {
+				_, batches := server.received()
+				return len(batches) == 1 && len(spooledFiles(t, directory)) == 0
+			})
+
+			tl.Close()
+
+			if _, batches := server.received(); replayed && strings.Contains(batches[0], "Spooled") {
+				t.Logf("\t\t[%v] The spooled batch is sent and removed from the directory.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The spooled batch is sent and removed from the directory. Actual: %v %v", ballotX, batches, spooledFiles(t, directory))
+			}
+		}
+	}
+}
+
+func TestSpoolIsLimitedBySizeAndAge(t *testing.T) {
+	clock := telemetrytest.NewManualClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	directory := t.TempDir()
+	configuration := SpoolConfiguration{Directory: directory, MaxSize: 25, MaxAge: time.Hour, MinBackoff: time.Hour}
+
+	s := newSpool(configuration, "http://localhost/v2/track", failingTransport{}, clock)
+	defer s.close()
+
+	t.Log("Given a spool with a maximum size of 25 bytes which cannot send")
+	{
+		t.Log("\tWhen three batches of 10 bytes are spooled")
+		{
+			for _, body := range []string{"0123456789", "abcdefghij", "ABCDEFGHIJ"} {
+				clock.Advance(time.Minute)
+
+				if err := s.persist([]byte(body)); err != nil {
+					t.Fatalf("\t\t[%v] The batch should be spooled. Error: %v", ballotX, err)
+				}
+			}
+
+			files := spooledFiles(t, directory)
+			var contents []string
+			for _, file := range files {
+				data, _ := os.ReadFile(file)
+				contents = append(contents, string(data))
+			}
+
+			if len(contents) == 2 && contents[0] == "abcdefghij" && contents[1] == "ABCDEFGHIJ" {
+				t.Logf("\t\t[%v] The oldest batch is removed to make room.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The oldest batch is removed to make room. Actual: %v", ballotX, contents)
+			}
+		}
+
+		t.Log("\tWhen an hour passes, leaving only the newest batch within the maximum age")
+		{
+			clock.Advance(time.Hour)
+
+			s.mutex.Lock()
+			batches, size := s.list()
+			s.mutex.Unlock()
+
+			if len(batches) == 1 && size == 10 && len(spooledFiles(t, directory)) == 1 {
+				t.Logf("\t\t[%v] The expired batches are removed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The expired batches are removed. Actual: %v", ballotX, batches)
+			}
+		}
+	}
+}
+
+func TestPartiallyAcceptedBatchesAreRetriedOrReported(t *testing.T) {
+	var mutex sync.Mutex
+	var batches []string
+	var diagnostics []error
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, _ := gzip.NewReader(r.Body)
+		body, _ := io.ReadAll(reader)
+
+		mutex.Lock()
+		batches = append(batches, string(body))
+		first := len(batches) == 1
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if first {
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = io.WriteString(w, `{"itemsReceived":3,"itemsAccepted":1,"errors":[{"index":1,"statusCode":503,"message":"Busy"},`+
+				`{"index":2,"statusCode":400,"message":"Invalid"}]}`)
+			return
+		}
+
+		_, _ = io.WriteString(w, `{"itemsReceived":1,"itemsAccepted":1,"errors":[]}`)
+	}))
+	defer server.Close()
+
+	telemetry.SetDiagnosticsHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		diagnostics = append(diagnostics, err)
+	})
+
+	defer telemetry.SetDiagnosticsHandler(nil)
+
+	directory := t.TempDir()
+	configuration := SpoolConfiguration{Directory: directory, MinBackoff: 10 * time.Millisecond}
+
+	s := newSpool(configuration, server.URL+"/v2/track", nil, telemetry.SystemClock())
+	defer s.close()
+
+	t.Log("Given a spool whose first batch of 3 items is partially accepted, with one retryable and one rejected item")
+	{
+		t.Log("\tWhen the batch is replayed")
+		{
+			if err := s.persist(compress([]byte("accepted\nretryable\nrejected\n"))); err != nil {
+				t.Fatalf("\t\t[%v] The batch should be spooled. Error: %v", ballotX, err)
+			}
+
+			resent := waitFor(5*time.Second, func() bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				return len(batches) == 2 && len(spooledFiles(t, directory)) == 0
+			})
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if resent && batches[1] == "retryable" {
+				t.Logf("\t\t[%v] Only the retryable item is sent again.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the retryable item is sent again. Actual: %q", ballotX, batches)
+			}
+
+			if len(diagnostics) == 1 && strings.Contains(diagnostics[0].Error(), "rejected 1 items") &&
+				strings.Contains(diagnostics[0].Error(), "400 (Invalid)") {
+				t.Logf("\t\t[%v] The rejected item is reported to the diagnostics handler.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The rejected item is reported to the diagnostics handler. Actual: %v", ballotX, diagnostics)
+			}
+		}
+	}
+}
+
+func TestChildTracesAreLinkedToTheirParent(t *testing.T) {
+	server := newIngestionServer()
+	defer server.Close()
+
+	t.Log("Given a listener which sends to a stand-in server")
+	{
+		tl := NewApplicationInsightsTraceListenerWithConfiguration("Test", "1.0", &TelemetryConfiguration{InstrumentationKey: "0000-1111", EndpointURL: server.URL})
+
+		t.Log("\tWhen a child trace is started within a request of an operation")
+		{
+			request := telemetry.TrackItemTo(tl, &telemetry.Item{Kind: telemetry.RequestItem, OperationID: "op-1", ID: "request-1", Method: "GET", URI: "/orders"})
+			child := (*request).StartChild("validate")
+
+			(*child).Complete()
+			(*child).Done()
+			(*request).Complete()
+			(*request).Done()
+
+			tl.Close()
+
+			_, batches := server.received()
+			sent := strings.Join(batches, "\n")
+
+			if strings.Contains(sent, `"ai.operation.parentId":"request-1"`) && strings.Contains(sent, `"type":"InProc"`) &&
+				strings.Contains(sent, `"name":"validate"`) && strings.Contains(sent, `"id":"request-1"`) {
+				t.Logf("\t\t[%v] The child is an in-process dependency whose parent is the request.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The child is an in-process dependency whose parent is the request. Actual: %v", ballotX, sent)
+			}
+
+			if strings.Count(sent, `"ai.operation.id":"op-1"`) == 2 {
+				t.Logf("\t\t[%v] The child is part of the request's operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The child is part of the request's operation. Actual: %v", ballotX, sent)
+			}
+		}
+	}
+}
+
+func TestChildTracesShareTheOperationOfAParentWithoutOne(t *testing.T) {
+	server := newIngestionServer()
+	defer server.Close()
+
+	t.Log("Given a listener which sends to a stand-in server")
+	{
+		tl := NewApplicationInsightsTraceListenerWithConfiguration("Test", "1.0", &TelemetryConfiguration{InstrumentationKey: "0000-1111", EndpointURL: server.URL})
+
+		t.Log("\tWhen a child trace is started within a request which is not part of an operation")
+		{
+			request := telemetry.TrackItemTo(tl, &telemetry.Item{Kind: telemetry.RequestItem, ID: "request-1", Method: "GET", URI: "/orders"})
+			child := (*request).StartChild("validate")
+
+			(*child).Complete()
+			(*child).Done()
+			(*request).Complete()
+			(*request).Done()
+
+			tl.Close()
+
+			_, batches := server.received()
+			sent := strings.Join(batches, "\n")
+
+			if strings.Count(sent, `"ai.operation.id":"request-1"`) == 2 && strings.Contains(sent, `"ai.operation.parentId":"request-1"`) {
+				t.Logf("\t\t[%v] The request and child are sent in an operation identified by the request.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request and child are sent in an operation identified by the request. Actual: %v", ballotX, sent)
+			}
+		}
+	}
+}
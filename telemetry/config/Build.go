@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/appinsights"
+	"github.com/phbarton/Telemetry-Go/telemetry/console"
+	"github.com/phbarton/Telemetry-Go/telemetry/file"
+	"github.com/phbarton/Telemetry-Go/telemetry/guard"
+	"github.com/phbarton/Telemetry-Go/telemetry/sampling"
+	"github.com/phbarton/Telemetry-Go/telemetry/slogbridge"
+	"github.com/phbarton/Telemetry-Go/telemetry/syslog"
+)
+
+// Build validates the configuration and creates the configured listeners, in the order console, file, syslog, ApplicationInsights and then
+// the named listeners. The options, such as the Clock, are passed to every built-in listener. Listeners whose section sets Guard are wrapped
+// in a guard.GuardedTraceListener. If a listener cannot be created, those already created are closed.
+func (c *Config) Build(options ...telemetry.ListenerOption) ([]telemetry.TraceListener, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var listeners []telemetry.TraceListener
+
+	fail := func(name string, err error) ([]telemetry.TraceListener, error) {
+		for _, created := range listeners {
+			created.Close()
+		}
+
+		return nil, fmt.Errorf("creating the %v listener: %w", name, err)
+	}
+
+	for _, section := range c.sections() {
+		listener, err := c.build(section.name, options)
+		if err != nil {
+			return fail(section.name, err)
+		}
+
+		listeners = append(listeners, withGuard(section.name, withSampling(listener, section.settings.Sampling, options), section.settings.Guard, options))
+	}
+
+	for i, named := range c.Listeners {
+		listener, err := telemetry.NewListener(named.Type, named.Settings)
+		if err != nil {
+			return fail(fmt.Sprintf("listeners[%v] %v", i, named.Type), err)
+		}
+
+		listener = withSampling(withLevel(listener, c.levelOf(named.Level)), named.Sampling, options)
+		listeners = append(listeners, withGuard(fmt.Sprintf("listeners[%v]", i), listener, named.Guard, options))
+	}
+
+	return listeners, nil
+}
+
+// Register builds the configured listeners and adds them to the telemetry package listeners
+func (c *Config) Register(options ...telemetry.ListenerOption) error {
+	listeners, err := c.Build(options...)
+	if err != nil {
+		return err
+	}
+
+	for _, listener := range listeners {
+		tl := listener
+		telemetry.AddListener(&tl)
+	}
+
+	return nil
+}
+
+func (c *Config) build(name string, options []telemetry.ListenerOption) (telemetry.TraceListener, error) {
+	switch name {
+	case "console":
+		level := c.levelOf(c.Console.Level)
+
+		if strings.EqualFold(c.Console.Format, "json") {
+			handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+			return withLevel(slogbridge.NewSlogTraceListener(handler, options...), level), nil
+		}
+
+		var settings console.Settings
+
+		if strings.EqualFold(c.Console.Format, "pretty") {
+			settings.Mode = console.Pretty
+		}
+
+		if c.Console.ErrorLevel != "" {
+			errorLevel, _ := telemetry.ParseSeverity(c.Console.ErrorLevel)
+			settings.SplitOutput = true
+			settings.ErrorLevel = &errorLevel
+		}
+
+		return console.NewConsoleTraceListenerWithSettings(level, settings, options...), nil
+	case "file":
+		rotation := file.Rotation{
+			MaxSize:    c.File.MaxSize,
+			Interval:   time.Duration(c.File.Interval),
+			MaxBackups: c.File.MaxBackups,
+			MaxAge:     time.Duration(c.File.MaxAge),
+			Compress:   c.File.Compress,
+		}
+
+		return file.NewFileTraceListener(c.levelOf(c.File.Level), c.File.Path, rotation, options...)
+	case "syslog":
+		facility := syslog.User
+		if c.Syslog.Facility != "" {
+			facility = facilities[strings.ToLower(c.Syslog.Facility)]
+		}
+
+		network := strings.ToLower(c.Syslog.Network)
+
+		return syslog.NewSyslogTraceListener(c.levelOf(c.Syslog.Level), network, c.Syslog.Address, facility, c.Syslog.AppName, options...)
+	case "appInsights":
+		connectionString := c.AppInsights.ConnectionString
+		if connectionString == "" {
+			connectionString = c.AppInsights.InstrumentationKey
+		}
+
+		configuration, err := appinsights.NewTelemetryConfiguration(connectionString)
+		if err != nil {
+			return nil, err
+		}
+
+		configuration.MaxBatchSize = c.AppInsights.MaxBatchSize
+		configuration.MaxBatchInterval = time.Duration(c.AppInsights.MaxBatchInterval)
+
+		if spool := c.AppInsights.Spool; spool != nil {
+			configuration.Spool = &appinsights.SpoolConfiguration{Directory: spool.Directory, MaxSize: spool.MaxSize, MaxAge: time.Duration(spool.MaxAge)}
+		}
+
+		if len(c.AppInsights.Properties) > 0 {
+			configuration.Initializers = append(configuration.Initializers, appinsights.CommonProperties(c.AppInsights.Properties))
+		}
+
+		if c.AppInsights.Kubernetes {
+			configuration.Initializers = append(configuration.Initializers, appinsights.KubernetesInitializer(), appinsights.ContainerInitializer())
+		}
+
+		listener := appinsights.NewApplicationInsightsTraceListenerWithConfiguration(c.AppInsights.Service, c.AppInsights.Version, configuration, options...)
+		return withLevel(listener, c.levelOf(c.AppInsights.Level)), nil
+	default:
+		return nil, fmt.Errorf("unknown listener %q", name)
+	}
+}
+
+// levelOf returns the listener's level, or the configuration's level if the listener does not set one. Both have been validated.
+func (c *Config) levelOf(level string) telemetry.Severity {
+	if severity, err := telemetry.ParseSeverity(level); err == nil {
+		return severity
+	}
+
+	if severity, err := telemetry.ParseSeverity(c.Level); err == nil {
+		return severity
+	}
+
+	return telemetry.Information
+}
+
+// withLevel drops the messages below the level, for listeners which do not limit their output themselves
+func withLevel(listener telemetry.TraceListener, level telemetry.Severity) telemetry.TraceListener {
+	return telemetry.NewProcessingTraceListener(listener, telemetry.Filter(func(item *telemetry.Item) bool {
+		return item.Kind != telemetry.MessageItem || item.Severity >= level
+	}))
+}
+
+// withSampling wraps the listener in a sampling listener if the settings limit how much is kept. An adaptive sampler measures the rate with
+// the Clock in the options.
+func withSampling(listener telemetry.TraceListener, settings *SamplingConfig, options []telemetry.ListenerOption) telemetry.TraceListener {
+	if sampler := settings.sampler(options); sampler != nil {
+		return sampling.NewSamplingTraceListener(listener, sampler)
+	}
+
+	return listener
+}
+
+// withGuard wraps the listener in a guard, named for its path in the configuration, if the settings ask for one
+func withGuard(name string, listener telemetry.TraceListener, settings *GuardConfig, options []telemetry.ListenerOption) telemetry.TraceListener {
+	if settings == nil {
+		return listener
+	}
+
+	return guard.NewGuardedTraceListener(name, listener, guard.Settings{
+		Timeout:          time.Duration(settings.Timeout),
+		FailureThreshold: settings.FailureThreshold,
+		OpenDuration:     time.Duration(settings.OpenDuration),
+	}, options...)
+}
+
+// sampler creates the Sampler described by the settings, or nil if everything is kept
+func (sc *SamplingConfig) sampler(options []telemetry.ListenerOption) sampling.Sampler {
+	if sc == nil {
+		return nil
+	}
+
+	var fallback sampling.Sampler
+
+	if sc.Percentage != nil {
+		fallback = sampling.FixedRate(*sc.Percentage)
+	} else if sc.Adaptive > 0 {
+		fallback = sampling.NewAdaptiveSampler(sc.Adaptive, options...)
+	}
+
+	if len(sc.Kinds) == 0 {
+		return fallback
+	}
+
+	samplers := make(map[telemetry.ItemKind]sampling.Sampler, len(sc.Kinds))
+	for kind, percentage := range sc.Kinds {
+		samplers[itemKinds[strings.ToLower(kind)]] = sampling.FixedRate(percentage)
+	}
+
+	return sampling.PerKind(samplers, fallback)
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes the trace listeners used by a service. It is usually loaded from a YAML or JSON file with Load, overridden by environment
+// variables with ApplyEnvironment, and turned into listeners with Build or Register. Only the listeners with a section are created.
+type Config struct {
+	// Level is the minimum severity of the messages written by every listener which does not set its own, e.g. "warning". Defaults to
+	// "information".
+	Level string `yaml:"level" json:"level"`
+
+	// Console writes to standard output.
+	Console *ConsoleConfig `yaml:"console" json:"console"`
+
+	// File writes to a rotated file.
+	File *FileConfig `yaml:"file" json:"file"`
+
+	// Syslog writes to a syslog daemon.
+	Syslog *SyslogConfig `yaml:"syslog" json:"syslog"`
+
+	// AppInsights sends the telemetry to Azure ApplicationInsights.
+	AppInsights *AppInsightsConfig `yaml:"appInsights" json:"appInsights"`
+
+	// Listeners are created by the factories registered with telemetry.RegisterListenerFactory, such as those of third-party listeners.
+	Listeners []NamedListenerConfig `yaml:"listeners" json:"listeners"`
+}
+
+// ListenerConfig holds the settings which are common to every listener section
+type ListenerConfig struct {
+	// Level is the minimum severity of the messages written by the listener. Defaults to the Config's Level.
+	Level string `yaml:"level" json:"level"`
+
+	// Sampling limits how much of the telemetry is kept by the listener. Everything is kept when it is not set.
+	Sampling *SamplingConfig `yaml:"sampling" json:"sampling"`
+
+	// Guard isolates the service from the listener misbehaving, recovering its panics, limiting how long its calls take and dropping its
+	// calls while it keeps failing. The guarded listener is included in guard.HealthReport under its path in the configuration, e.g.
+	// "file". The listener is called directly when it is not set.
+	Guard *GuardConfig `yaml:"guard" json:"guard"`
+}
+
+// ConsoleConfig describes a listener which writes to standard output
+type ConsoleConfig struct {
+	ListenerConfig `yaml:",inline"`
+
+	// Format is "text" for the console listener's single line format, "pretty" for its coloured format for local development, or "json"
+	// for a JSON object per line. Defaults to "text".
+	Format string `yaml:"format" json:"format"`
+
+	// ErrorLevel, if set, is the minimum severity of the lines written to standard error rather than standard output, e.g. "error". It is
+	// not supported by the "json" format.
+	ErrorLevel string `yaml:"errorLevel" json:"errorLevel"`
+}
+
+// FileConfig describes a listener which writes to a rotated file
+type FileConfig struct {
+	ListenerConfig `yaml:",inline"`
+
+	// Path is the file written to. It is required.
+	Path string `yaml:"path" json:"path"`
+
+	// MaxSize is the size in bytes at which the file is rotated. Zero disables size-based rotation.
+	MaxSize int64 `yaml:"maxSize" json:"maxSize"`
+
+	// Interval is the period after which the file is rotated, e.g. "24h". Zero disables time-based rotation.
+	Interval Duration `yaml:"interval" json:"interval"`
+
+	// MaxBackups is the maximum number of rotated files to retain. Zero retains all backups.
+	MaxBackups int `yaml:"maxBackups" json:"maxBackups"`
+
+	// MaxAge is the maximum age of a rotated file before it is removed, e.g. "168h". Zero retains all backups.
+	MaxAge Duration `yaml:"maxAge" json:"maxAge"`
+
+	// Compress indicates whether rotated files are compressed with gzip.
+	Compress bool `yaml:"compress" json:"compress"`
+}
+
+// SyslogConfig describes a listener which writes to a syslog daemon
+type SyslogConfig struct {
+	ListenerConfig `yaml:",inline"`
+
+	// Network is "unix", "unixgram", "udp" or "tcp". Leave both the network and address empty to use the local daemon socket.
+	Network string `yaml:"network" json:"network"`
+
+	// Address is the address of the daemon, e.g. "logs.example.com:514".
+	Address string `yaml:"address" json:"address"`
+
+	// Facility is the name of the facility the messages are logged under, e.g. "local0". Defaults to "user".
+	Facility string `yaml:"facility" json:"facility"`
+
+	// AppName identifies the service in each message. Defaults to the name of the executable.
+	AppName string `yaml:"appName" json:"appName"`
+}
+
+// AppInsightsConfig describes a listener which sends the telemetry to Azure ApplicationInsights
+type AppInsightsConfig struct {
+	ListenerConfig `yaml:",inline"`
+
+	// ConnectionString identifies the ApplicationInsights instance and its ingestion endpoint. It takes precedence over the InstrumentationKey.
+	ConnectionString string `yaml:"connectionString" json:"connectionString"`
+
+	// InstrumentationKey identifies the ApplicationInsights instance. Either it or the ConnectionString is required.
+	InstrumentationKey string `yaml:"instrumentationKey" json:"instrumentationKey"`
+
+	// Service is the cloud role name of the service.
+	Service string `yaml:"service" json:"service"`
+
+	// Version is the application version of the service.
+	Version string `yaml:"version" json:"version"`
+
+	// MaxBatchSize is the number of items which are sent together unless the MaxBatchInterval expires first. Defaults to 1024.
+	MaxBatchSize int `yaml:"maxBatchSize" json:"maxBatchSize"`
+
+	// MaxBatchInterval is the longest time that items are held before they are sent, e.g. "5s". Defaults to 10 seconds.
+	MaxBatchInterval Duration `yaml:"maxBatchInterval" json:"maxBatchInterval"`
+
+	// Spool keeps the batches which cannot be sent on disk until they can be, across restarts. Batches are only kept in memory if it is not set.
+	Spool *SpoolConfig `yaml:"spool" json:"spool"`
+
+	// Properties are added to every item which does not already have them, e.g. a build number or git SHA.
+	Properties map[string]string `yaml:"properties" json:"properties"`
+
+	// Kubernetes adds the pod, node and container IDs, read from the downward API's environment variables and /proc/self/cgroup, to every item.
+	Kubernetes bool `yaml:"kubernetes" json:"kubernetes"`
+}
+
+// SpoolConfig describes the directory in which ApplicationInsights batches that cannot be sent are kept
+type SpoolConfig struct {
+	// Directory holds the spooled batches. It should not be shared by processes running at the same time.
+	Directory string `yaml:"directory" json:"directory"`
+
+	// MaxSize is the total size in bytes of the spooled batches, beyond which the oldest are removed. Defaults to 50MB.
+	MaxSize int64 `yaml:"maxSize" json:"maxSize"`
+
+	// MaxAge is the age after which a spooled batch is removed, e.g. "24h". Defaults to 48 hours.
+	MaxAge Duration `yaml:"maxAge" json:"maxAge"`
+}
+
+// NamedListenerConfig describes a listener created by the factory registered under its type with telemetry.RegisterListenerFactory. The
+// package which registers the factory must be imported, e.g. import _ "example.com/telemetry/kafka".
+type NamedListenerConfig struct {
+	ListenerConfig `yaml:",inline"`
+
+	// Type is the name of the listener's factory, e.g. "kafka". It is required.
+	Type string `yaml:"type" json:"type"`
+
+	// Settings are passed to the factory. Their meaning depends on the type of listener.
+	Settings map[string]any `yaml:"settings" json:"settings"`
+}
+
+// SamplingConfig describes how much of the telemetry is kept by a listener. Percentage and Adaptive are alternatives for the kinds which
+// are not listed in Kinds.
+type SamplingConfig struct {
+	// Percentage is the fixed percentage (0-100) of the telemetry to keep.
+	Percentage *float64 `yaml:"percentage" json:"percentage"`
+
+	// Adaptive is the number of items per second to keep, adjusting the percentage as the volume changes.
+	Adaptive float64 `yaml:"adaptive" json:"adaptive"`
+
+	// Kinds is the fixed percentage to keep of particular kinds of item, by name, e.g. "request": 100.
+	Kinds map[string]float64 `yaml:"kinds" json:"kinds"`
+}
+
+// GuardConfig describes how a listener is isolated from the service, as in guard.Settings
+type GuardConfig struct {
+	// Timeout limits how long each call to the listener may take, e.g. "2s". Zero calls the listener without a timeout.
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+
+	// FailureThreshold is the number of consecutive failures which opens the circuit breaker. Defaults to 5.
+	FailureThreshold int `yaml:"failureThreshold" json:"failureThreshold"`
+
+	// OpenDuration is how long the circuit breaker drops calls before trying the listener again, e.g. "30s". Defaults to 30 seconds.
+	OpenDuration Duration `yaml:"openDuration" json:"openDuration"`
+}
+
+// section is the common settings of a configured listener, with the listener's name in the configuration
+type section struct {
+	name     string
+	settings *ListenerConfig
+}
+
+// sections returns the common settings of each configured listener, in the order the listeners are created
+func (c *Config) sections() []section {
+	var sections []section
+
+	if c.Console != nil {
+		sections = append(sections, section{"console", &c.Console.ListenerConfig})
+	}
+
+	if c.File != nil {
+		sections = append(sections, section{"file", &c.File.ListenerConfig})
+	}
+
+	if c.Syslog != nil {
+		sections = append(sections, section{"syslog", &c.Syslog.ListenerConfig})
+	}
+
+	if c.AppInsights != nil {
+		sections = append(sections, section{"appInsights", &c.AppInsights.ListenerConfig})
+	}
+
+	return sections
+}
+
+// Duration is a time.Duration which is written in configuration files as a string such as "90s" or "1h30m"
+type Duration time.Duration
+
+// UnmarshalText parses the duration
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalText formats the duration
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Load reads the configuration from a YAML or JSON file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading telemetry configuration: %w", err)
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Parse reads the configuration from YAML or JSON. Unknown settings are reported as errors, so that misspelt settings are not ignored.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing telemetry configuration: %v", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+
+	return config, nil
+}
@@ -0,0 +1,412 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/guard"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+const yamlConfig = `
+level: warning
+console:
+  format: json
+  level: error
+file:
+  path: /var/log/service.log
+  maxSize: 1048576
+  interval: 24h
+  maxAge: 168h
+  compress: true
+appInsights:
+  instrumentationKey: 0000-1111
+  service: orders
+  version: 1.2.3
+  sampling:
+    percentage: 25
+    kinds:
+      request: 100
+`
+
+const jsonConfig = `{
+  "level": "warning",
+  "console": { "format": "json", "level": "error" },
+  "file": { "path": "/var/log/service.log", "maxSize": 1048576, "interval": "24h", "maxAge": "168h", "compress": true },
+  "appInsights": {
+    "instrumentationKey": "0000-1111", "service": "orders", "version": "1.2.3",
+    "sampling": { "percentage": 25, "kinds": { "request": 100 } }
+  }
+}`
+
+var recorders []*telemetrytest.Recorder
+
+func init() {
+	telemetry.RegisterListenerFactory("test-recorder", func(settings map[string]any) (telemetry.TraceListener, error) {
+		var rs struct {
+			Name string `json:"name"`
+		}
+
+		if err := telemetry.DecodeSettings(settings, &rs); err != nil {
+			return nil, err
+		}
+
+		recorder := telemetrytest.NewRecorder()
+		recorder.TraceEvent(rs.Name)
+		recorders = append(recorders, recorder)
+
+		return recorder, nil
+	})
+}
+
+func lookupIn(variables map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+}
+
+func TestConfigurationIsParsedFromYamlAndJson(t *testing.T) {
+	for format, data := range map[string]string{"YAML": yamlConfig, "JSON": jsonConfig} {
+		t.Logf("Given a %v configuration with console, file and ApplicationInsights listeners", format)
+		{
+			t.Log("\tWhen the configuration is parsed")
+			{
+				config, err := Parse([]byte(data))
+				if err != nil {
+					t.Fatalf("\t\t[%v] The configuration should be parsed. Error: %v", ballotX, err)
+				}
+
+				if config.Level == "warning" && config.Console.Format == "json" && config.Console.Level == "error" && config.Syslog == nil {
+					t.Logf("\t\t[%v] The default level and the console settings are read.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The default level and the console settings are read. Actual: %+v", ballotX, config)
+				}
+
+				if file := config.File; file.Path == "/var/log/service.log" && file.MaxSize == 1048576 && time.Duration(file.Interval) == 24*time.Hour &&
+					time.Duration(file.MaxAge) == 168*time.Hour && file.Compress {
+					t.Logf("\t\t[%v] The file settings, including durations, are read.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The file settings, including durations, are read. Actual: %+v", ballotX, file)
+				}
+
+				if ai := config.AppInsights; ai.InstrumentationKey == "0000-1111" && ai.Service == "orders" && ai.Version == "1.2.3" &&
+					*ai.Sampling.Percentage == 25 && ai.Sampling.Kinds["request"] == 100 {
+					t.Logf("\t\t[%v] The ApplicationInsights settings, including sampling, are read.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The ApplicationInsights settings, including sampling, are read. Actual: %+v", ballotX, ai)
+				}
+
+				if err := config.Validate(); err == nil {
+					t.Logf("\t\t[%v] The configuration is valid.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] The configuration is valid. Error: %v", ballotX, err)
+				}
+			}
+		}
+	}
+}
+
+func TestUnknownSettingsAreReported(t *testing.T) {
+	t.Log("Given a configuration with a misspelt setting")
+	{
+		t.Log("\tWhen the configuration is parsed")
+		{
+			_, err := Parse([]byte("console:\n  formt: json\n"))
+
+			if err != nil && strings.Contains(err.Error(), "line 2") && strings.Contains(err.Error(), "formt") {
+				t.Logf("\t\t[%v] The setting and its line are reported.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The setting and its line are reported. Error: %v", ballotX, err)
+			}
+		}
+	}
+}
+
+func TestValidationReportsEveryProblem(t *testing.T) {
+	t.Log("Given a configuration with several invalid settings")
+	{
+		percentage := 150.0
+		config := &Config{
+			Level:       "loud",
+			Console:     &ConsoleConfig{Format: "xml", ErrorLevel: "urgent"},
+			File:        &FileConfig{ListenerConfig: ListenerConfig{Sampling: &SamplingConfig{Percentage: &percentage, Kinds: map[string]float64{"requests": 50}}}},
+			Syslog:      &SyslogConfig{Network: "udp", Facility: "local9", ListenerConfig: ListenerConfig{Guard: &GuardConfig{Timeout: Duration(-time.Second)}}},
+			AppInsights: &AppInsightsConfig{Spool: &SpoolConfig{MaxSize: 1024}},
+		}
+
+		t.Log("\tWhen the configuration is validated")
+		{
+			err := config.Validate()
+			var validationError *ValidationError
+
+			if !errors.As(err, &validationError) {
+				t.Fatalf("\t\t[%v] A ValidationError should be returned. Actual: %v", ballotX, err)
+			}
+
+			expected := []string{
+				"level: unknown severity \"loud\"",
+				"console.format: unknown format \"xml\"",
+				"console.errorLevel: unknown severity \"urgent\"",
+				"file.sampling.percentage: 150 is not between 0 and 100",
+				"file.sampling.kinds: unknown kind \"requests\"",
+				"file.path: is required",
+				"syslog.guard.timeout: -1s cannot be negative",
+				"syslog.facility: unknown facility \"local9\"",
+				"syslog.address: is required with a network",
+				"appInsights.instrumentationKey: is required without a connectionString",
+				"appInsights.spool.directory: is required",
+			}
+
+			if len(validationError.Problems) != len(expected) {
+				t.Errorf("\t\t[%v] Every problem is reported. Actual: %v", ballotX, validationError.Problems)
+			} else {
+				for i, problem := range validationError.Problems {
+					if strings.HasPrefix(problem, expected[i]) {
+						t.Logf("\t\t[%v] The problem is reported: %v", checkMark, problem)
+					} else {
+						t.Errorf("\t\t[%v] The problem is reported. Expected: %v, Actual: %v", ballotX, expected[i], problem)
+					}
+				}
+			}
+
+			if strings.Contains(err.Error(), "expected verbose, information, warning, error or critical") {
+				t.Logf("\t\t[%v] The error lists the valid values.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The error lists the valid values. Actual: %v", ballotX, err)
+			}
+		}
+	}
+}
+
+func TestEnvironmentOverridesTheConfiguration(t *testing.T) {
+	t.Log("Given a configuration file with a console and a file listener")
+	{
+		config, err := Parse([]byte("level: error\nconsole:\n  format: text\nfile:\n  path: service.log\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Log("\tWhen the environment sets the level, the console format, an instrumentation key and disables the file")
+		{
+			err := config.ApplyEnvironment(lookupIn(map[string]string{
+				"TELEMETRY_LEVEL":                "verbose",
+				"TELEMETRY_CONSOLE":              "json",
+				"TELEMETRY_FILE":                 "off",
+				"APPINSIGHTS_INSTRUMENTATIONKEY": "2222-3333",
+				"TELEMETRY_SERVICE":              "orders",
+				"TELEMETRY_APPINSIGHTS_LEVEL":    "warning",
+				"TELEMETRY_APPINSIGHTS_SAMPLING": "10%",
+			}))
+			if err != nil {
+				t.Fatalf("\t\t[%v] The environment should be applied. Error: %v", ballotX, err)
+			}
+
+			if config.Level == "verbose" && config.Console.Format == "json" && config.File == nil {
+				t.Logf("\t\t[%v] The level and console are overridden and the file is disabled.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The level and console are overridden and the file is disabled. Actual: %+v", ballotX, config)
+			}
+
+			if ai := config.AppInsights; ai != nil && ai.InstrumentationKey == "2222-3333" && ai.Service == "orders" && ai.Level == "warning" &&
+				*ai.Sampling.Percentage == 10 {
+				t.Logf("\t\t[%v] The ApplicationInsights listener is enabled with its level and sampling.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The ApplicationInsights listener is enabled with its level and sampling. Actual: %+v", ballotX, ai)
+			}
+		}
+
+		t.Log("\tWhen the environment sets a connection string without an instrumentation key")
+		{
+			config := &Config{}
+			err := config.ApplyEnvironment(lookupIn(map[string]string{"APPLICATIONINSIGHTS_CONNECTION_STRING": "IngestionEndpoint=https://example.com/"}))
+
+			if err == nil && config.AppInsights != nil && config.AppInsights.ConnectionString == "IngestionEndpoint=https://example.com/" {
+				t.Logf("\t\t[%v] The ApplicationInsights listener is enabled with the connection string.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The ApplicationInsights listener is enabled with the connection string. Actual: %+v, Error: %v", ballotX, config.AppInsights, err)
+			}
+
+			if err := config.Validate(); err != nil && strings.Contains(err.Error(), "appInsights.connectionString: invalid connection string: InstrumentationKey is required") {
+				t.Logf("\t\t[%v] The connection string is reported as invalid.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The connection string is reported as invalid. Error: %v", ballotX, err)
+			}
+		}
+
+		t.Log("\tWhen the environment sets an invalid sampling percentage")
+		{
+			err := config.ApplyEnvironment(lookupIn(map[string]string{"TELEMETRY_CONSOLE_SAMPLING": "most"}))
+
+			if err != nil && strings.HasPrefix(err.Error(), "TELEMETRY_CONSOLE_SAMPLING") {
+				t.Logf("\t\t[%v] The variable is reported.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The variable is reported. Error: %v", ballotX, err)
+			}
+		}
+	}
+}
+
+func TestListenersAreBuiltFromTheConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+
+	t.Log("Given a configuration with a file listener at the warning level, which keeps no metrics")
+	{
+		config := &Config{
+			Level: "warning",
+			File:  &FileConfig{Path: path, ListenerConfig: ListenerConfig{Sampling: &SamplingConfig{Kinds: map[string]float64{"metric": 0}}}},
+		}
+
+		t.Log("\tWhen the listeners are built and used")
+		{
+			listeners, err := config.Build()
+			if err != nil || len(listeners) != 1 {
+				t.Fatalf("\t\t[%v] A single listener should be built. Actual: %v, Error: %v", ballotX, listeners, err)
+			}
+
+			tl := listeners[0]
+			tl.TraceMessage("Below the level", telemetry.Information)
+			tl.TraceMessage("At the level", telemetry.Warning)
+			tl.TraceMetric("Sampled out", 1)
+			tl.TraceException(errors.New("Kept"))
+			tl.Close()
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := string(content)
+
+			if strings.Contains(output, "At the level") && !strings.Contains(output, "Below the level") {
+				t.Logf("\t\t[%v] Messages are limited to the level.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Messages are limited to the level. Actual: \"%v\"", ballotX, output)
+			}
+
+			if strings.Contains(output, "Kept") && !strings.Contains(output, "Sampled out") {
+				t.Logf("\t\t[%v] The sampling settings are applied.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The sampling settings are applied. Actual: \"%v\"", ballotX, output)
+			}
+		}
+	}
+
+	t.Log("Given a configuration with a guarded file listener")
+	{
+		config := &Config{File: &FileConfig{Path: path, ListenerConfig: ListenerConfig{Guard: &GuardConfig{Timeout: Duration(time.Second)}}}}
+
+		t.Log("\tWhen the listeners are built")
+		{
+			listeners, err := config.Build()
+			if err != nil || len(listeners) != 1 {
+				t.Fatalf("\t\t[%v] A single listener should be built. Actual: %v, Error: %v", ballotX, listeners, err)
+			}
+
+			_, guarded := listeners[0].(*guard.GuardedTraceListener)
+			report := guard.HealthReport()
+
+			if guarded && len(report) == 1 && report[0].Name == "file" {
+				t.Logf("\t\t[%v] The listener is guarded, and reported under its section's name.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The listener is guarded, and reported under its section's name. Actual: %T, %+v", ballotX, listeners[0], report)
+			}
+
+			listeners[0].Close()
+		}
+	}
+
+	t.Log("Given an invalid configuration")
+	{
+		config := &Config{File: &FileConfig{}}
+
+		t.Log("\tWhen the listeners are built")
+		{
+			listeners, err := config.Build()
+
+			if listeners == nil && err != nil && strings.Contains(err.Error(), "file.path") {
+				t.Logf("\t\t[%v] No listeners are built and the problem is reported.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] No listeners are built and the problem is reported. Actual: %v, Error: %v", ballotX, listeners, err)
+			}
+		}
+	}
+}
+
+func TestNamedListenersAreCreatedByTheirFactories(t *testing.T) {
+	t.Log("Given a configuration with a listener of a registered type")
+	{
+		config, err := Parse([]byte("level: error\nlisteners:\n  - type: test-recorder\n    settings:\n      name: audit\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Log("\tWhen the listeners are built and used")
+		{
+			recorders = nil
+
+			listeners, err := config.Build()
+			if err != nil || len(listeners) != 1 || len(recorders) != 1 {
+				t.Fatalf("\t\t[%v] The listener should be created by its factory. Actual: %v, Error: %v", ballotX, listeners, err)
+			}
+
+			listeners[0].TraceMessage("Below the level", telemetry.Warning)
+			listeners[0].TraceMessage("At the level", telemetry.Error)
+
+			if events := recorders[0].Events(); len(events) == 1 && events[0].Name == "audit" {
+				t.Logf("\t\t[%v] The settings are passed to the factory.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The settings are passed to the factory. Actual: %v", ballotX, events)
+			}
+
+			if messages := recorders[0].Messages(); len(messages) == 1 && messages[0].Message == "At the level" {
+				t.Logf("\t\t[%v] Messages are limited to the configured level.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Messages are limited to the configured level. Actual: %v", ballotX, messages)
+			}
+		}
+	}
+
+	t.Log("Given a configuration with a listener of an unregistered type")
+	{
+		config := &Config{Listeners: []NamedListenerConfig{{Type: "kafka"}}}
+
+		t.Log("\tWhen the configuration is validated")
+		{
+			err := config.Validate()
+
+			if err != nil && strings.Contains(err.Error(), "listeners[0].type: unknown listener type \"kafka\"") &&
+				strings.Contains(err.Error(), "appinsights, console, stream, test-recorder") {
+				t.Logf("\t\t[%v] The type is reported with the registered types.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The type is reported with the registered types. Error: %v", ballotX, err)
+			}
+		}
+	}
+
+	t.Log("Given a configuration with a built-in listener which has a misspelt setting")
+	{
+		config := &Config{Listeners: []NamedListenerConfig{{Type: "stream", Settings: map[string]any{"output": "stderr", "levl": "error"}}}}
+
+		t.Log("\tWhen the listeners are built")
+		{
+			_, err := config.Build()
+
+			if err != nil && strings.Contains(err.Error(), "listeners[0] stream") && strings.Contains(err.Error(), "levl") {
+				t.Logf("\t\t[%v] The setting and the listener are reported.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The setting and the listener are reported. Error: %v", ballotX, err)
+			}
+		}
+	}
+}
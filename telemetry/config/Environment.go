@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ConfigEnv is the environment variable holding the path of the configuration file read by FromEnvironment
+	ConfigEnv = "TELEMETRY_CONFIG"
+
+	// LevelEnv is the environment variable overriding the default level of every listener
+	LevelEnv = "TELEMETRY_LEVEL"
+
+	// ConsoleEnv is the environment variable enabling the console listener with the format, "text" or "json", or disabling it with "off"
+	ConsoleEnv = "TELEMETRY_CONSOLE"
+
+	// FileEnv is the environment variable enabling the file listener with the path of the file, or disabling it with "off"
+	FileEnv = "TELEMETRY_FILE"
+
+	// SyslogEnv is the environment variable enabling the syslog listener with the daemon's address as network://address, e.g.
+	// udp://logs.example.com:514, or "local" for the local daemon socket. It is disabled with "off"
+	SyslogEnv = "TELEMETRY_SYSLOG"
+
+	// ConnectionStringEnv is the environment variable enabling the ApplicationInsights listener with the connection string
+	ConnectionStringEnv = "APPLICATIONINSIGHTS_CONNECTION_STRING"
+
+	// InstrumentationKeyEnv is the environment variable enabling the ApplicationInsights listener with the instrumentation key
+	InstrumentationKeyEnv = "APPINSIGHTS_INSTRUMENTATIONKEY"
+
+	// ServiceEnv is the environment variable holding the service name, used as the ApplicationInsights role and the syslog app name
+	ServiceEnv = "TELEMETRY_SERVICE"
+
+	// VersionEnv is the environment variable holding the service version reported to ApplicationInsights
+	VersionEnv = "TELEMETRY_VERSION"
+
+	offValue = "off"
+)
+
+// FromEnvironment loads the configuration file named by TELEMETRY_CONFIG, if it is set, and then applies the environment variables over it
+func FromEnvironment() (*Config, error) {
+	config := &Config{}
+
+	if path, ok := os.LookupEnv(ConfigEnv); ok && path != "" {
+		loaded, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		config = loaded
+	}
+
+	if err := config.ApplyEnvironment(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ApplyEnvironment overrides the configuration with the environment variables found by the lookup, which is usually os.LookupEnv. Setting
+// TELEMETRY_CONSOLE, TELEMETRY_FILE, TELEMETRY_SYSLOG, APPINSIGHTS_INSTRUMENTATIONKEY or APPLICATIONINSIGHTS_CONNECTION_STRING enables the
+// listener if it is not already configured.
+// The level and fixed sampling percentage of each listener are set by TELEMETRY_<LISTENER>_LEVEL and TELEMETRY_<LISTENER>_SAMPLING, e.g.
+// TELEMETRY_APPINSIGHTS_SAMPLING=25.
+func (c *Config) ApplyEnvironment(lookup func(name string) (string, bool)) error {
+	get := func(name string) (string, bool) {
+		value, ok := lookup(name)
+		value = strings.TrimSpace(value)
+
+		return value, ok && value != ""
+	}
+
+	if level, ok := get(LevelEnv); ok {
+		c.Level = level
+	}
+
+	if format, ok := get(ConsoleEnv); ok {
+		if isOff(format) {
+			c.Console = nil
+		} else {
+			if c.Console == nil {
+				c.Console = &ConsoleConfig{}
+			}
+
+			c.Console.Format = format
+		}
+	}
+
+	if path, ok := get(FileEnv); ok {
+		if isOff(path) {
+			c.File = nil
+		} else {
+			if c.File == nil {
+				c.File = &FileConfig{}
+			}
+
+			c.File.Path = path
+		}
+	}
+
+	if address, ok := get(SyslogEnv); ok {
+		if isOff(address) {
+			c.Syslog = nil
+		} else {
+			if c.Syslog == nil {
+				c.Syslog = &SyslogConfig{}
+			}
+
+			c.Syslog.Network, c.Syslog.Address = "", ""
+
+			if network, address, found := strings.Cut(address, "://"); found {
+				c.Syslog.Network, c.Syslog.Address = network, address
+			} else if !strings.EqualFold(address, "local") {
+				return fmt.Errorf("%v: %q is not network://address or local", SyslogEnv, address)
+			}
+		}
+	}
+
+	if key, ok := get(InstrumentationKeyEnv); ok {
+		if c.AppInsights == nil {
+			c.AppInsights = &AppInsightsConfig{}
+		}
+
+		c.AppInsights.InstrumentationKey = key
+	}
+
+	if connectionString, ok := get(ConnectionStringEnv); ok {
+		if c.AppInsights == nil {
+			c.AppInsights = &AppInsightsConfig{}
+		}
+
+		c.AppInsights.ConnectionString = connectionString
+	}
+
+	if service, ok := get(ServiceEnv); ok {
+		if c.AppInsights != nil {
+			c.AppInsights.Service = service
+		}
+
+		if c.Syslog != nil {
+			c.Syslog.AppName = service
+		}
+	}
+
+	if version, ok := get(VersionEnv); ok && c.AppInsights != nil {
+		c.AppInsights.Version = version
+	}
+
+	for _, section := range c.sections() {
+		prefix := "TELEMETRY_" + strings.ToUpper(section.name)
+
+		if level, ok := get(prefix + "_LEVEL"); ok {
+			section.settings.Level = level
+		}
+
+		if value, ok := get(prefix + "_SAMPLING"); ok {
+			percentage, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil {
+				return fmt.Errorf("%v_SAMPLING: %q is not a percentage", prefix, value)
+			}
+
+			if section.settings.Sampling == nil {
+				section.settings.Sampling = &SamplingConfig{}
+			}
+
+			section.settings.Sampling.Percentage = &percentage
+			section.settings.Sampling.Adaptive = 0
+		}
+	}
+
+	return nil
+}
+
+func isOff(value string) bool {
+	return strings.EqualFold(value, offValue) || strings.EqualFold(value, "false") || value == "0"
+}
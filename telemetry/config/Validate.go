@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/appinsights"
+	"github.com/phbarton/Telemetry-Go/telemetry/syslog"
+)
+
+// ValidationError lists every problem found in a configuration, so that they can all be corrected at once
+type ValidationError struct {
+	// Problems describes each invalid setting, prefixed by its path in the configuration, e.g. "console.level: ..."
+	Problems []string
+}
+
+func (ve *ValidationError) Error() string {
+	return "invalid telemetry configuration: " + strings.Join(ve.Problems, "; ")
+}
+
+var facilities = map[string]syslog.Facility{
+	"kern":   syslog.Kern,
+	"user":   syslog.User,
+	"mail":   syslog.Mail,
+	"daemon": syslog.Daemon,
+	"auth":   syslog.Auth,
+	"syslog": syslog.Syslog,
+	"local0": syslog.Local0,
+	"local1": syslog.Local1,
+	"local2": syslog.Local2,
+	"local3": syslog.Local3,
+	"local4": syslog.Local4,
+	"local5": syslog.Local5,
+	"local6": syslog.Local6,
+	"local7": syslog.Local7,
+}
+
+var itemKinds = map[string]telemetry.ItemKind{
+	"message":      telemetry.MessageItem,
+	"exception":    telemetry.ExceptionItem,
+	"metric":       telemetry.MetricItem,
+	"event":        telemetry.EventItem,
+	"request":      telemetry.RequestItem,
+	"dependency":   telemetry.DependencyItem,
+	"availability": telemetry.AvailabilityItem,
+}
+
+// Validate checks every setting, returning a *ValidationError which lists all of the problems found
+func (c *Config) Validate() error {
+	var problems []string
+
+	report := func(path string, format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if c.Level != "" {
+		if _, err := telemetry.ParseSeverity(c.Level); err != nil {
+			report("level", "%v", err)
+		}
+	}
+
+	if c.Console != nil {
+		c.Console.validate("console", report)
+
+		if format := strings.ToLower(c.Console.Format); format != "" && format != "text" && format != "pretty" && format != "json" {
+			report("console.format", "unknown format %q, expected text, pretty or json", c.Console.Format)
+		}
+
+		if c.Console.ErrorLevel != "" {
+			if _, err := telemetry.ParseSeverity(c.Console.ErrorLevel); err != nil {
+				report("console.errorLevel", "%v", err)
+			} else if strings.EqualFold(c.Console.Format, "json") {
+				report("console.errorLevel", "is not supported by the json format")
+			}
+		}
+	}
+
+	if c.File != nil {
+		c.File.validate("file", report)
+
+		if c.File.Path == "" {
+			report("file.path", "is required")
+		}
+
+		if c.File.MaxSize < 0 || c.File.Interval < 0 || c.File.MaxBackups < 0 || c.File.MaxAge < 0 {
+			report("file", "maxSize, interval, maxBackups and maxAge cannot be negative")
+		}
+	}
+
+	if c.Syslog != nil {
+		c.Syslog.validate("syslog", report)
+
+		if c.Syslog.Facility != "" {
+			if _, ok := facilities[strings.ToLower(c.Syslog.Facility)]; !ok {
+				report("syslog.facility", "unknown facility %q, expected one of %v", c.Syslog.Facility, names(facilities))
+			}
+		}
+
+		switch strings.ToLower(c.Syslog.Network) {
+		case "":
+			if c.Syslog.Address != "" {
+				report("syslog.network", "is required with an address")
+			}
+		case "unix", "unixgram", "udp", "tcp":
+			if c.Syslog.Address == "" {
+				report("syslog.address", "is required with a network")
+			}
+		default:
+			report("syslog.network", "unknown network %q, expected unix, unixgram, udp or tcp", c.Syslog.Network)
+		}
+	}
+
+	if c.AppInsights != nil {
+		c.AppInsights.validate("appInsights", report)
+
+		if c.AppInsights.ConnectionString != "" {
+			if _, err := appinsights.ParseConnectionString(c.AppInsights.ConnectionString); err != nil {
+				report("appInsights.connectionString", "%v", err)
+			}
+		} else if c.AppInsights.InstrumentationKey == "" {
+			report("appInsights.instrumentationKey", "is required without a connectionString")
+		}
+
+		if c.AppInsights.MaxBatchSize < 0 || c.AppInsights.MaxBatchInterval < 0 {
+			report("appInsights", "maxBatchSize and maxBatchInterval cannot be negative")
+		}
+
+		if spool := c.AppInsights.Spool; spool != nil {
+			if spool.Directory == "" {
+				report("appInsights.spool.directory", "is required")
+			}
+
+			if spool.MaxSize < 0 || spool.MaxAge < 0 {
+				report("appInsights.spool", "maxSize and maxAge cannot be negative")
+			}
+		}
+	}
+
+	registered := telemetry.ListenerFactories()
+
+	for i, listener := range c.Listeners {
+		path := fmt.Sprintf("listeners[%v]", i)
+		listener.validate(path, report)
+
+		if listener.Type == "" {
+			report(path+".type", "is required")
+		} else if !slices.Contains(registered, listener.Type) {
+			report(path+".type", "unknown listener type %q (forgotten import?), expected one of %v", listener.Type, strings.Join(registered, ", "))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+func (lc *ListenerConfig) validate(path string, report func(path string, format string, args ...interface{})) {
+	if lc.Level != "" {
+		if _, err := telemetry.ParseSeverity(lc.Level); err != nil {
+			report(path+".level", "%v", err)
+		}
+	}
+
+	if guard := lc.Guard; guard != nil {
+		if guard.Timeout < 0 {
+			report(path+".guard.timeout", "%v cannot be negative", time.Duration(guard.Timeout))
+		}
+
+		if guard.FailureThreshold < 0 {
+			report(path+".guard.failureThreshold", "%v cannot be negative", guard.FailureThreshold)
+		}
+
+		if guard.OpenDuration < 0 {
+			report(path+".guard.openDuration", "%v cannot be negative", time.Duration(guard.OpenDuration))
+		}
+	}
+
+	sampling := lc.Sampling
+	if sampling == nil {
+		return
+	}
+
+	if sampling.Percentage != nil && (*sampling.Percentage < 0 || *sampling.Percentage > 100) {
+		report(path+".sampling.percentage", "%v is not between 0 and 100", *sampling.Percentage)
+	}
+
+	if sampling.Adaptive < 0 {
+		report(path+".sampling.adaptive", "%v items per second cannot be negative", sampling.Adaptive)
+	}
+
+	if sampling.Percentage != nil && sampling.Adaptive != 0 {
+		report(path+".sampling", "percentage and adaptive cannot both be set")
+	}
+
+	for _, kind := range sortedKeys(sampling.Kinds) {
+		percentage := sampling.Kinds[kind]
+
+		if _, ok := itemKinds[strings.ToLower(kind)]; !ok {
+			report(path+".sampling.kinds", "unknown kind %q, expected one of %v", kind, names(itemKinds))
+		} else if percentage < 0 || percentage > 100 {
+			report(path+".sampling.kinds."+kind, "%v is not between 0 and 100", percentage)
+		}
+	}
+}
+
+// names lists the keys of the map in order, for error messages
+func names[T any](values map[string]T) string {
+	return strings.Join(sortedKeys(values), ", ")
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
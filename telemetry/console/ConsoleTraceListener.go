@@ -1,27 +1,168 @@
 package console
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/phbarton/Telemetry-Go/telemetry"
 	"github.com/phbarton/Telemetry-Go/telemetry/stream"
 )
 
+// DefaultSlowThreshold is the duration past which the durations of tracked activities are highlighted in the Pretty mode, when the Settings
+// do not specify one
+const DefaultSlowThreshold time.Duration = time.Second
+
+// Mode selects how a console listener renders its output
+type Mode int
+
+const (
+	// Text writes the single line format of the stream listener, with the date and time of each line
+	Text Mode = iota
+
+	// Pretty writes aligned columns for reading while developing locally: the time since the listener was created, the severity in colour,
+	// durations past the slow threshold in red and properties as dimmed key=value pairs
+	Pretty
+)
+
+// ColorMode selects whether the Pretty mode writes ANSI colours
+type ColorMode int
+
+const (
+	// ColorAuto writes colours when standard output is a terminal and the NO_COLOR environment variable is not set
+	ColorAuto ColorMode = iota
+
+	// ColorAlways writes colours regardless of the output
+	ColorAlways
+
+	// ColorNever writes no colours
+	ColorNever
+)
+
+// Settings configures a console listener
+type Settings struct {
+	// Mode selects how the output is rendered. Defaults to Text.
+	Mode Mode
+
+	// Color selects whether the Pretty mode writes colours. Defaults to ColorAuto.
+	Color ColorMode
+
+	// SlowThreshold is the duration past which the durations of tracked activities are highlighted in red in the Pretty mode. Defaults to
+	// DefaultSlowThreshold; a negative threshold highlights none.
+	SlowThreshold time.Duration
+
+	// SplitOutput writes the lines with a severity of at least the ErrorLevel to standard error, and the others to standard output, as
+	// expected by container platforms. The lines are written in the order they are traced, across both outputs.
+	SplitOutput bool
+
+	// ErrorLevel is the minimum severity of the lines written to standard error when the output is split. Defaults to telemetry.Error.
+	ErrorLevel *telemetry.Severity
+}
+
 type consoleTraceListener struct {
 	inner *telemetry.TraceListener
 }
 
+// consoleSettings are the settings of a "console" listener in a configuration file
+type consoleSettings struct {
+	Level      telemetry.Severity  `json:"level"`
+	Mode       Mode                `json:"mode"`
+	ErrorLevel *telemetry.Severity `json:"errorLevel"`
+}
+
+func init() {
+	telemetry.RegisterListenerFactory("console", newConsoleTraceListenerFromSettings)
+}
+
 // NewConsoleTraceListener creates a trace listener which outputs to the console. It limits output based on the logging level supplied
-func NewConsoleTraceListener(loggingLevel telemetry.Severity) telemetry.TraceListener {
-	var console io.Writer = os.Stdout
+func NewConsoleTraceListener(loggingLevel telemetry.Severity, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	return NewConsoleTraceListenerWithSettings(loggingLevel, Settings{}, options...)
+}
 
-	inner := stream.NewStreamTraceListener(loggingLevel, &console)
+// NewConsoleTraceListenerWithSettings creates a trace listener which outputs to the console, rendered as configured by the settings. It
+// limits output based on the logging level supplied.
+func NewConsoleTraceListenerWithSettings(loggingLevel telemetry.Severity, settings Settings, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	return newConsoleTraceListener(loggingLevel, os.Stdout, os.Stderr, settings, options...)
+}
+
+// newConsoleTraceListener creates a console trace listener which writes to the writers given in place of standard output and standard error
+func newConsoleTraceListener(loggingLevel telemetry.Severity, console io.Writer, errors io.Writer, settings Settings, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	var streamSettings stream.Settings
+
+	if settings.SplitOutput {
+		streamSettings.ErrorWriter = &errors
+		streamSettings.ErrorLevel = telemetry.Error
+
+		if settings.ErrorLevel != nil {
+			streamSettings.ErrorLevel = *settings.ErrorLevel
+		}
+	}
+
+	if settings.Mode == Pretty {
+		if settings.SlowThreshold == 0 {
+			settings.SlowThreshold = DefaultSlowThreshold
+		}
+
+		color := settings.Color == ColorAlways
+		if settings.Color == ColorAuto {
+			// Colour is only written when every output it reaches is a terminal
+			color = colorSupported(console) && (!settings.SplitOutput || colorSupported(errors))
+		}
+
+		formatter := &prettyFormatter{
+			start:         telemetry.NewListenerOptions(options...).Clock.Now(),
+			slowThreshold: settings.SlowThreshold,
+			color:         color,
+		}
+
+		streamSettings.Formatter = formatter.format
+	}
+
+	inner := stream.NewStreamTraceListenerWithSettings(loggingLevel, &console, streamSettings, options...)
 	traceListener := consoleTraceListener{inner: &inner}
 
 	return &traceListener
 }
 
+// newConsoleTraceListenerFromSettings creates a console trace listener from its settings, limiting output to the "level", which defaults to
+// Information, and rendered in the "mode", "text" or "pretty", which defaults to "text". If an "errorLevel" is set, the output is split at it
+// between standard output and standard error.
+func newConsoleTraceListenerFromSettings(settings map[string]any) (telemetry.TraceListener, error) {
+	cs := consoleSettings{Level: telemetry.Information}
+	if err := telemetry.DecodeSettings(settings, &cs); err != nil {
+		return nil, err
+	}
+
+	listenerSettings := Settings{Mode: cs.Mode, SplitOutput: cs.ErrorLevel != nil, ErrorLevel: cs.ErrorLevel}
+
+	return NewConsoleTraceListenerWithSettings(cs.Level, listenerSettings), nil
+}
+
+// ParseMode finds the Mode by its name, "text" or "pretty", ignoring case
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "text":
+		return Text, nil
+	case "pretty":
+		return Pretty, nil
+	default:
+		return Text, fmt.Errorf("unknown mode %q, expected text or pretty", name)
+	}
+}
+
+// UnmarshalText sets the Mode from its name, as accepted by ParseMode
+func (m *Mode) UnmarshalText(text []byte) error {
+	mode, err := ParseMode(string(text))
+	if err != nil {
+		return err
+	}
+
+	*m = mode
+	return nil
+}
+
 func (ctl *consoleTraceListener) TraceMessage(message string, severity telemetry.Severity) {
 	(*ctl.inner).TraceMessage(message, severity)
 }
@@ -54,6 +195,14 @@ func (ctl *consoleTraceListener) TraceEvent(name string) {
 	(*ctl.inner).TraceEvent(name)
 }
 
+func (ctl *consoleTraceListener) TraceItem(item *telemetry.Item) {
+	telemetry.TraceItemTo(*ctl.inner, item)
+}
+
+func (ctl *consoleTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	return telemetry.TrackItemTo(*ctl.inner, item)
+}
+
 func (ctl *consoleTraceListener) Flush() {
 	(*ctl.inner).Flush()
 }
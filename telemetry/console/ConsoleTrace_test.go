@@ -0,0 +1,286 @@
+package console
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+// outputWriter records the lines written to it, and tags them with its name in a log shared by the writers of a listener, so that the
+// order of the writes across the writers can be checked
+type outputWriter struct {
+	name   string
+	lines  []string
+	shared *[]string
+}
+
+func (ow *outputWriter) Write(p []byte) (n int, err error) {
+	ow.lines = append(ow.lines, string(p))
+	*ow.shared = append(*ow.shared, ow.name+": "+string(p))
+
+	return len(p), nil
+}
+
+// writePrettyOutput traces a message, a request, a message with properties and a slow failing dependency to a Pretty console listener,
+// and returns the bytes written
+func writePrettyOutput(color ColorMode) string {
+	var buffer bytes.Buffer
+
+	clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC))
+	tl := newConsoleTraceListener(telemetry.Verbose, &buffer, &buffer, Settings{Mode: Pretty, Color: color}, telemetry.WithClock(clock))
+
+	tl.TraceMessage("Starting", telemetry.Information)
+
+	request := tl.TrackRequest("GET", "/orders")
+	clock.Advance(250 * time.Millisecond)
+	(*request).SetSource("web")
+	(*request).Complete()
+	(*request).Done()
+
+	telemetry.TraceItemTo(tl, &telemetry.Item{Kind: telemetry.MessageItem, Message: "Disk nearly full", Severity: telemetry.Warning,
+		Properties: map[string]string{"disk": "C", "free": "5%"}})
+
+	dependency := tl.TrackDependency("db", "SQL", "server")
+	clock.Advance(1500 * time.Millisecond)
+	(*dependency).Fail("500")
+	(*dependency).Done()
+
+	tl.Close()
+
+	return buffer.String()
+}
+
+func TestPrettyModeWritesAlignedColumnsWithRelativeTimestamps(t *testing.T) {
+	expectedOutput := "   +0.000s INF Starting\n" +
+		"   +0.000s INF REQUEST: GET /orders\n" +
+		"   +0.250s INF REQUEST: GET /orders                        250ms Success source=web\n" +
+		"   +0.250s WRN Disk nearly full                         disk=C free=5%\n" +
+		"   +0.250s INF DEPENDENCY: db (SQL) server\n" +
+		"   +1.750s ERR DEPENDENCY: db (SQL) server                1500ms Failed: 500\n"
+
+	t.Log("Given a console listener in the Pretty mode without colour, using a manual clock")
+	{
+		t.Log("\tWhen messages and traces are written")
+		{
+			actualOutput := writePrettyOutput(ColorNever)
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The output has times since the creation of the listener and aligned durations and properties.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The output has times since the creation of the listener and aligned durations and properties. Expected: %q, Actual: %q",
+					ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestPrettyModeColorsSeveritiesSlowDurationsAndProperties(t *testing.T) {
+	expectedOutput := "\x1b[2m   +0.000s\x1b[0m \x1b[36mINF\x1b[0m Starting\n" +
+		"\x1b[2m   +0.000s\x1b[0m \x1b[36mINF\x1b[0m REQUEST: GET /orders\n" +
+		"\x1b[2m   +0.250s\x1b[0m \x1b[36mINF\x1b[0m REQUEST: GET /orders                        250ms \x1b[32mSuccess\x1b[0m \x1b[2msource=web\x1b[0m\n" +
+		"\x1b[2m   +0.250s\x1b[0m \x1b[33mWRN\x1b[0m Disk nearly full                         \x1b[2mdisk=C free=5%\x1b[0m\n" +
+		"\x1b[2m   +0.250s\x1b[0m \x1b[36mINF\x1b[0m DEPENDENCY: db (SQL) server\n" +
+		"\x1b[2m   +1.750s\x1b[0m \x1b[31mERR\x1b[0m DEPENDENCY: db (SQL) server              \x1b[31m  1500ms\x1b[0m \x1b[31mFailed: 500\x1b[0m\n"
+
+	t.Log("Given a console listener in the Pretty mode which always writes colour, with the default slow threshold of a second")
+	{
+		t.Log("\tWhen messages and traces are written")
+		{
+			actualOutput := writePrettyOutput(ColorAlways)
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The severities and outcomes are coloured, the slow duration is red and the properties are dimmed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The severities and outcomes are coloured, the slow duration is red and the properties are dimmed. Expected: %q, Actual: %q",
+					ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestColorIsOnlyWrittenToTerminalsWithoutNoColor(t *testing.T) {
+	t.Log("Given writers which are not terminals")
+	{
+		file, err := os.Create(filepath.Join(t.TempDir(), "console.log"))
+		if err != nil {
+			t.Fatalf("\t\t[%v] The file is created. Error: %v", ballotX, err)
+		}
+
+		defer file.Close()
+
+		t.Log("\tWhen colour support is detected")
+		{
+			if !colorSupported(file) && !colorSupported(&bytes.Buffer{}) {
+				t.Logf("\t\t[%v] Colour is disabled.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Colour is disabled.", ballotX)
+			}
+		}
+
+		t.Log("\tWhen a console listener in the Pretty mode detects colour support")
+		{
+			if output := writePrettyOutput(ColorAuto); !strings.Contains(output, "\x1b[") {
+				t.Logf("\t\t[%v] No escape codes are written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] No escape codes are written. Actual: %q", ballotX, output)
+			}
+		}
+	}
+
+	t.Log("Given the NO_COLOR environment variable is set")
+	{
+		t.Setenv("NO_COLOR", "1")
+
+		t.Log("\tWhen colour support is detected for standard output")
+		{
+			if !colorSupported(os.Stdout) {
+				t.Logf("\t\t[%v] Colour is disabled.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Colour is disabled.", ballotX)
+			}
+		}
+	}
+}
+
+func TestConsoleFactoryAcceptsTheMode(t *testing.T) {
+	t.Log("Given the settings of a console listener in a configuration file")
+	{
+		t.Log("\tWhen the mode is \"pretty\"")
+		{
+			listener, err := newConsoleTraceListenerFromSettings(map[string]any{"level": "warning", "mode": "pretty"})
+
+			if err == nil && listener != nil {
+				t.Logf("\t\t[%v] The listener is created.", checkMark)
+				listener.Close()
+			} else {
+				t.Errorf("\t\t[%v] The listener is created. Error: %v", ballotX, err)
+			}
+		}
+
+		t.Log("\tWhen the mode is unknown")
+		{
+			_, err := newConsoleTraceListenerFromSettings(map[string]any{"mode": "loud"})
+
+			if err != nil && strings.Contains(err.Error(), "expected text or pretty") {
+				t.Logf("\t\t[%v] The mode is reported as invalid.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The mode is reported as invalid. Error: %v", ballotX, err)
+			}
+		}
+	}
+}
+
+func TestSplitOutputWritesErrorsToStandardErrorInOrder(t *testing.T) {
+	var shared []string
+
+	stdout := &outputWriter{name: "stdout", shared: &shared}
+	stderr := &outputWriter{name: "stderr", shared: &shared}
+	expectedOrder := []string{
+		"stdout: Mar  4 09:30:15.000 [INF]: Starting\n",
+		"stderr: Mar  4 09:30:15.000 [ERR]: Disk full\n",
+		"stdout: Mar  4 09:30:15.000 [WRN]: Retrying\n",
+		"stdout: Mar  4 09:30:15.000 [INF]: DEPENDENCY: db (SQL) server\n",
+		"stderr: Mar  4 09:30:15.000 [ERR]: DEPENDENCY: db (SQL) server, Duration: 0ms, Failed: 500\n",
+		"stderr: Mar  4 09:30:15.000 [CRT]: Out of memory\n",
+		"stdout: Mar  4 09:30:15.000 [VRB]: Stopping\n",
+	}
+
+	t.Log("Given a console listener whose output is split at the Error severity, writing to injected writers")
+	{
+		clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC))
+		errorLevel := telemetry.Error
+		tl := newConsoleTraceListener(telemetry.Verbose, stdout, stderr, Settings{SplitOutput: true, ErrorLevel: &errorLevel},
+			telemetry.WithClock(clock))
+
+		t.Log("\tWhen messages of every severity and a failing dependency are traced")
+		{
+			tl.TraceMessage("Starting", telemetry.Information)
+			tl.TraceMessage("Disk full", telemetry.Error)
+			tl.TraceMessage("Retrying", telemetry.Warning)
+
+			dependency := tl.TrackDependency("db", "SQL", "server")
+			(*dependency).Fail("500")
+			(*dependency).Done()
+
+			tl.TraceMessage("Out of memory", telemetry.Critical)
+			tl.TraceMessage("Stopping", telemetry.Verbose)
+			tl.Close()
+
+			if len(stdout.lines) == 4 && len(stderr.lines) == 3 {
+				t.Logf("\t\t[%v] The errors are written to standard error and the other lines to standard output.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The errors are written to standard error and the other lines to standard output. Actual: %q, %q", ballotX,
+					stdout.lines, stderr.lines)
+			}
+
+			if strings.Join(shared, "") == strings.Join(expectedOrder, "") {
+				t.Logf("\t\t[%v] The lines are written in the order they are traced, across both outputs.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The lines are written in the order they are traced, across both outputs. Expected: %q, Actual: %q", ballotX,
+					expectedOrder, shared)
+			}
+		}
+	}
+}
+
+func TestSplitOutputDefaultsToTheErrorLevel(t *testing.T) {
+	var shared []string
+
+	stdout := &outputWriter{name: "stdout", shared: &shared}
+	stderr := &outputWriter{name: "stderr", shared: &shared}
+
+	t.Log("Given a console listener whose output is split without an error level, writing to injected writers")
+	{
+		tl := newConsoleTraceListener(telemetry.Verbose, stdout, stderr, Settings{SplitOutput: true})
+
+		t.Log("\tWhen a warning and an error are traced")
+		{
+			tl.TraceMessage("Retrying", telemetry.Warning)
+			tl.TraceMessage("Disk full", telemetry.Error)
+			tl.Close()
+
+			if len(stdout.lines) == 1 && strings.Contains(stdout.lines[0], "Retrying") && len(stderr.lines) == 1 &&
+				strings.Contains(stderr.lines[0], "Disk full") {
+				t.Logf("\t\t[%v] The output is split at the Error severity.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The output is split at the Error severity. Actual: %q, %q", ballotX, stdout.lines, stderr.lines)
+			}
+		}
+	}
+}
+
+func TestOutputIsNotSplitByDefault(t *testing.T) {
+	var shared []string
+
+	stdout := &outputWriter{name: "stdout", shared: &shared}
+	stderr := &outputWriter{name: "stderr", shared: &shared}
+
+	t.Log("Given a console listener with the default settings, writing to injected writers")
+	{
+		tl := newConsoleTraceListener(telemetry.Verbose, stdout, stderr, Settings{})
+
+		t.Log("\tWhen an error and a critical message are traced")
+		{
+			tl.TraceMessage("Disk full", telemetry.Error)
+			tl.TraceMessage("Out of memory", telemetry.Critical)
+			tl.Close()
+
+			if len(stdout.lines) == 2 && len(stderr.lines) == 0 {
+				t.Logf("\t\t[%v] Everything is written to standard output.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Everything is written to standard output. Actual: %q, %q", ballotX, stdout.lines, stderr.lines)
+			}
+		}
+	}
+}
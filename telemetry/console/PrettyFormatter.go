@@ -0,0 +1,119 @@
+package console
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/stream"
+)
+
+// ANSI escape codes of the colours of the Pretty mode
+const (
+	reset   = "\x1b[0m"
+	dim     = "\x1b[2m"
+	red     = "\x1b[31m"
+	green   = "\x1b[32m"
+	yellow  = "\x1b[33m"
+	cyan    = "\x1b[36m"
+	gray    = "\x1b[90m"
+	boldRed = "\x1b[1;31m"
+)
+
+// textWidth is the width of the column of the text, so that the durations and properties which follow it are aligned
+const textWidth int = 40
+
+var severityColors = map[telemetry.Severity]string{
+	telemetry.Verbose:     gray,
+	telemetry.Information: cyan,
+	telemetry.Warning:     yellow,
+	telemetry.Error:       red,
+	telemetry.Critical:    boldRed,
+}
+
+// outcomeColors are the colours of the outcomes of tracked activities, by the severity of their end
+var outcomeColors = map[telemetry.Severity]string{
+	telemetry.Information: green,
+	telemetry.Warning:     yellow,
+	telemetry.Error:       red,
+}
+
+// prettyFormatter renders the entries of the Pretty mode
+type prettyFormatter struct {
+	start         time.Time
+	slowThreshold time.Duration
+	color         bool
+}
+
+// format renders the entry in aligned columns: the time since the listener was created, the severity tag, the indented text and, at the
+// end of a tracked activity, its duration and outcome, followed by the dimmed properties, e.g.
+//
+//	+0.250s INF REQUEST: GET /orders                        250ms Success source=web
+func (pf *prettyFormatter) format(entry *stream.Entry) string {
+	var builder strings.Builder
+
+	builder.WriteString(pf.paint(dim, fmt.Sprintf("%+9.3fs", entry.Timestamp.Sub(pf.start).Seconds())))
+	builder.WriteString(" ")
+	builder.WriteString(pf.paint(severityColors[entry.Severity], stream.SeverityTag(entry.Severity)))
+	builder.WriteString(" ")
+
+	text := strings.Repeat("  ", entry.Depth) + entry.Text
+
+	if entry.Done || len(entry.Properties) > 0 {
+		text = fmt.Sprintf("%-*s", textWidth, text)
+	}
+
+	builder.WriteString(text)
+
+	if entry.Done {
+		duration := fmt.Sprintf("%8v", fmt.Sprintf("%vms", entry.Duration.Milliseconds()))
+		if pf.slowThreshold >= 0 && entry.Duration >= pf.slowThreshold {
+			duration = pf.paint(red, duration)
+		}
+
+		builder.WriteString(" ")
+		builder.WriteString(duration)
+		builder.WriteString(" ")
+		builder.WriteString(pf.paint(outcomeColors[entry.Severity], entry.Outcome))
+	}
+
+	for _, properties := range []map[string]string{entry.Properties, entry.Details} {
+		if len(properties) > 0 {
+			builder.WriteString(" ")
+			builder.WriteString(pf.paint(dim, strings.TrimPrefix(stream.FormatProperties(properties), " ")))
+		}
+	}
+
+	builder.WriteString("\n")
+
+	return builder.String()
+}
+
+// paint surrounds the text with the colour, if colour is enabled
+func (pf *prettyFormatter) paint(color string, text string) string {
+	if !pf.color || color == "" {
+		return text
+	}
+
+	return color + text + reset
+}
+
+// colorSupported indicates whether colour is written to the writer by default: it must be a terminal, the NO_COLOR environment variable
+// must not be set and TERM must not be "dumb"
+func colorSupported(writer io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
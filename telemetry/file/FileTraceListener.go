@@ -0,0 +1,127 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/stream"
+)
+
+type fileTraceListener struct {
+	inner   *telemetry.TraceListener
+	writer  *rotatingFileWriter
+	signals chan os.Signal
+	closing sync.Once
+}
+
+// NewFileTraceListener creates a trace listener which outputs to the file at the specified path, rotating it according to the supplied policy.
+// Writes, and therefore rotation, happen asynchronously to the caller. A write which fails, e.g. because the disk is full, loses its line and
+// is reported through the diagnostics handler of the telemetry package. The file is reopened when the process receives SIGHUP so that external
+// tools such as logrotate may also be used. It limits output based on the logging level supplied, and the Clock in the options is used for
+// both the timestamps and the rotation schedule
+func NewFileTraceListener(loggingLevel telemetry.Severity, path string, rotation Rotation, options ...telemetry.ListenerOption) (telemetry.TraceListener, error) {
+	settings := telemetry.NewListenerOptions(options...)
+
+	writer, err := newRotatingFileWriter(path, rotation, settings.Clock)
+	if err != nil {
+		return nil, err
+	}
+
+	var target io.Writer = diagnosticWriter{writer: writer}
+
+	inner := stream.NewStreamTraceListener(loggingLevel, &target, options...)
+	traceListener := fileTraceListener{inner: &inner, writer: writer, signals: make(chan os.Signal, 1)}
+
+	signal.Notify(traceListener.signals, syscall.SIGHUP)
+	go traceListener.reopenLoop()
+
+	return &traceListener, nil
+}
+
+func (ftl *fileTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	(*ftl.inner).TraceMessage(message, severity)
+}
+
+func (ftl *fileTraceListener) TraceException(err error) {
+	(*ftl.inner).TraceException(err)
+}
+
+func (ftl *fileTraceListener) TracePanic(rethrow bool) {
+	(*ftl.inner).TracePanic(rethrow)
+}
+
+func (ftl *fileTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return (*ftl.inner).TrackAvailability(name)
+}
+
+func (ftl *fileTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return (*ftl.inner).TrackRequest(method, uri)
+}
+
+func (ftl *fileTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return (*ftl.inner).TrackDependency(name, dependencyType, target)
+}
+
+func (ftl *fileTraceListener) TraceMetric(name string, value float64) {
+	(*ftl.inner).TraceMetric(name, value)
+}
+
+func (ftl *fileTraceListener) TraceEvent(name string) {
+	(*ftl.inner).TraceEvent(name)
+}
+
+func (ftl *fileTraceListener) TraceItem(item *telemetry.Item) {
+	telemetry.TraceItemTo(*ftl.inner, item)
+}
+
+func (ftl *fileTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	return telemetry.TrackItemTo(*ftl.inner, item)
+}
+
+func (ftl *fileTraceListener) Flush() {
+	(*ftl.inner).Flush()
+}
+
+// Close writes the queued messages to the file and closes it. Only the first call has an effect.
+func (ftl *fileTraceListener) Close() {
+	ftl.closing.Do(func() {
+		// Drain the queued messages into the file before closing it
+		(*ftl.inner).Close()
+
+		signal.Stop(ftl.signals)
+		close(ftl.signals)
+
+		if err := ftl.writer.Close(); err != nil {
+			log.Printf("Unexpected error when closing log file: %v", err.Error())
+		}
+	})
+}
+
+// reopenLoop reopens the file each time SIGHUP is received, until the listener is closed
+func (ftl *fileTraceListener) reopenLoop() {
+	for range ftl.signals {
+		if err := ftl.writer.Reopen(); err != nil {
+			log.Printf("Unexpected error when reopening log file: %v", err.Error())
+		}
+	}
+}
+
+// diagnosticWriter reports the errors of the writer through the diagnostics handler rather than returning them, as the stream listener
+// stops the process when a write fails
+type diagnosticWriter struct {
+	writer io.Writer
+}
+
+func (dw diagnosticWriter) Write(p []byte) (int, error) {
+	if _, err := dw.writer.Write(p); err != nil {
+		telemetry.ReportDiagnostic(fmt.Errorf("unable to write to the log file: %w", err))
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,384 @@
+package file
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+func listFiles(t *testing.T, directory string) []string {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestFileIsRotatedBySize(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+
+	t.Log("Given a FileTraceListener with a maximum size of 100 bytes")
+	{
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{MaxSize: 100})
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen several messages exceeding the maximum size are traced")
+		{
+			for i := 0; i < 5; i++ {
+				tl.TraceMessage("A message which is long enough to need rotation", telemetry.Information)
+			}
+
+			tl.Close()
+			files := listFiles(t, directory)
+
+			if len(files) == 5 {
+				t.Logf("\t\t[%v] Each message beyond the maximum size is written to a new file.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Each message beyond the maximum size is written to a new file. Expected: 5 files, Actual: %v", ballotX, files)
+			}
+
+			if content := readFile(t, path); strings.Count(content, "\n") == 1 {
+				t.Logf("\t\t[%v] The current file contains only the latest message.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The current file contains only the latest message. Actual: \"%v\"", ballotX, content)
+			}
+		}
+	}
+}
+
+func TestBackupsBeyondMaximumAreRemoved(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+
+	t.Log("Given a FileTraceListener with a maximum size of 100 bytes and a maximum of 2 backups")
+	{
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{MaxSize: 100, MaxBackups: 2})
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen enough messages are traced to cause several rotations")
+		{
+			for i := 0; i < 6; i++ {
+				tl.TraceMessage("A message which is long enough to need rotation", telemetry.Information)
+			}
+
+			tl.Close()
+			files := listFiles(t, directory)
+
+			if len(files) == 3 {
+				t.Logf("\t\t[%v] Only the current file and 2 backups remain.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the current file and 2 backups remain. Actual: %v", ballotX, files)
+			}
+		}
+	}
+}
+
+func TestBackupsBeyondMaximumAgeAreRemoved(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+	stale := filepath.Join(directory, "app-"+time.Now().UTC().Add(-48*time.Hour).Format(backupTimeFormat)+".log")
+	recent := filepath.Join(directory, "app-"+time.Now().UTC().Add(-1*time.Hour).Format(backupTimeFormat)+".log")
+
+	t.Log("Given backups from a previous run which are 1 and 48 hours old")
+	{
+		for _, backup := range []string{stale, recent} {
+			if err := os.WriteFile(backup, []byte("backup\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		t.Log("\tWhen a FileTraceListener with a maximum age of 24 hours is opened and closed")
+		{
+			tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{MaxAge: 24 * time.Hour})
+			if err != nil {
+				t.Fatalf("\t\t[%v] The listener should open the file. Error: %v", ballotX, err)
+			}
+
+			tl.Close()
+
+			_, staleErr := os.Stat(stale)
+			_, recentErr := os.Stat(recent)
+
+			if os.IsNotExist(staleErr) && recentErr == nil {
+				t.Logf("\t\t[%v] Only the backup older than the maximum age is removed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the backup older than the maximum age is removed. Actual: %v", ballotX, listFiles(t, directory))
+			}
+		}
+	}
+}
+
+func TestBackupsAreCompressed(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+
+	t.Log("Given a FileTraceListener with a maximum size of 100 bytes and compression enabled")
+	{
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{MaxSize: 100, Compress: true})
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen two messages are traced")
+		{
+			tl.TraceMessage("First message which is long enough to need rotation", telemetry.Information)
+			tl.TraceMessage("Second message which is long enough to need rotation", telemetry.Information)
+			tl.Close()
+
+			matches, _ := filepath.Glob(filepath.Join(directory, "app-*.log.gz"))
+			if len(matches) != 1 {
+				t.Fatalf("\t\t[%v] The backup is compressed. Actual: %v", ballotX, listFiles(t, directory))
+			}
+
+			compressed, err := os.Open(matches[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer compressed.Close()
+
+			reader, err := gzip.NewReader(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, _ := io.ReadAll(reader)
+
+			if strings.Contains(string(content), "First message") {
+				t.Logf("\t\t[%v] The backup is compressed and holds the rotated content.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The backup is compressed and holds the rotated content. Actual: \"%v\"", ballotX, string(content))
+			}
+		}
+	}
+}
+
+func TestFileIsRotatedByInterval(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+
+	t.Log("Given a FileTraceListener with a rotation interval of 1 hour")
+	{
+		clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 9, 30, 0, 0, time.UTC))
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{Interval: time.Hour}, telemetry.WithClock(clock))
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen messages are traced either side of the interval")
+		{
+			tl.TraceMessage("First message", telemetry.Information)
+			tl.Flush()
+			time.Sleep(100 * time.Millisecond) // Since the write is asynchronous, wait a bit for it to be handled
+
+			clock.Advance(30 * time.Minute)
+			tl.TraceMessage("Second message", telemetry.Information)
+			tl.Close()
+
+			backup := filepath.Join(directory, "app-2020-03-04T10-00-00.000.log")
+			if files := listFiles(t, directory); len(files) == 2 && strings.Contains(readFile(t, backup), "First message") {
+				t.Logf("\t\t[%v] The second message is written to a new file.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The second message is written to a new file. Actual: %v", ballotX, files)
+			}
+		}
+	}
+}
+
+func TestBackupsAreNamedInUTC(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+
+	t.Log("Given a FileTraceListener with a maximum size of 10 bytes and a maximum age of 1 hour, whose clock is 10 hours behind UTC")
+	{
+		clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 9, 30, 0, 0, time.FixedZone("UTC-10", -10*60*60)))
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{MaxSize: 10, MaxAge: time.Hour}, telemetry.WithClock(clock))
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen two messages are traced, rotating the file")
+		{
+			tl.TraceMessage("First message", telemetry.Information)
+			tl.TraceMessage("Second message", telemetry.Information)
+			tl.Close()
+
+			backup := filepath.Join(directory, "app-2020-03-04T19-30-00.000.log")
+			if files := listFiles(t, directory); len(files) == 2 && strings.Contains(readFile(t, backup), "First message") {
+				t.Logf("\t\t[%v] The backup is named with the time in UTC, and is not mistaken for an expired one.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The backup is named with the time in UTC, and is not mistaken for an expired one. Actual: %v", ballotX, files)
+			}
+		}
+	}
+}
+
+func TestFileIsReopenedOnHangup(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+	moved := filepath.Join(directory, "app.log.1")
+
+	t.Log("Given a FileTraceListener whose file has been moved by an external tool")
+	{
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{})
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		tl.TraceMessage("First message", telemetry.Information)
+		tl.Flush()
+		time.Sleep(100 * time.Millisecond) // Since the write is asynchronous, wait a bit for it to be handled
+
+		if err := os.Rename(path, moved); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Log("\tWhen SIGHUP is received")
+		{
+			tl.(*fileTraceListener).signals <- syscall.SIGHUP
+			time.Sleep(100 * time.Millisecond) // Since the reopen is asynchronous, wait a bit for it to be handled
+
+			tl.TraceMessage("Second message", telemetry.Information)
+			tl.Close()
+
+			if content := readFile(t, path); strings.Contains(content, "Second message") && !strings.Contains(content, "First message") {
+				t.Logf("\t\t[%v] Later messages are written to a new file at the original path.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Later messages are written to a new file at the original path. Actual: \"%v\"", ballotX, content)
+			}
+		}
+	}
+}
+
+func TestFailedWritesAreReportedAndTheFileIsReopened(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "app.log")
+
+	var mutex sync.Mutex
+	var diagnostics []error
+
+	telemetry.SetDiagnosticsHandler(func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		diagnostics = append(diagnostics, err)
+	})
+
+	defer telemetry.SetDiagnosticsHandler(nil)
+
+	t.Log("Given a FileTraceListener whose file cannot be reopened, as a directory has taken its place")
+	{
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{})
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Mkdir(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tl.(*fileTraceListener).writer.Reopen(); err == nil {
+			t.Fatalf("\t[%v] The file should not be reopened.", ballotX)
+		}
+
+		t.Log("\tWhen a message is traced")
+		{
+			tl.TraceMessage("Lost message", telemetry.Information)
+
+			reported := 0
+			for deadline := time.Now().Add(5 * time.Second); reported == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				mutex.Lock()
+				reported = len(diagnostics)
+				mutex.Unlock()
+			}
+
+			if reported == 1 {
+				t.Logf("\t\t[%v] The failed write is reported to the diagnostics handler.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The failed write is reported to the diagnostics handler. Actual: %v", ballotX, reported)
+			}
+		}
+
+		t.Log("\tWhen a message is traced once the file can be opened again")
+		{
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+
+			tl.TraceMessage("Kept message", telemetry.Information)
+			tl.Close()
+
+			if content := readFile(t, path); strings.Contains(content, "Kept message") && !strings.Contains(content, "Lost message") {
+				t.Logf("\t\t[%v] The file is opened again and written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The file is opened again and written. Actual: \"%v\"", ballotX, content)
+			}
+		}
+	}
+}
+
+func TestCloseCanBeCalledTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	t.Log("Given a FileTraceListener")
+	{
+		tl, err := NewFileTraceListener(telemetry.Verbose, path, Rotation{})
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should open the file. Error: %v", ballotX, err)
+		}
+
+		t.Log("\tWhen it is closed twice")
+		{
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("\t\t[%v] The second call does nothing. Panic: %v", ballotX, r)
+					}
+				}()
+
+				tl.Close()
+				tl.Close()
+
+				t.Logf("\t\t[%v] The second call does nothing.", checkMark)
+			}()
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	backupTimeFormat string      = "2006-01-02T15-04-05.000"
+	compressSuffix   string      = ".gz"
+	fileMode         os.FileMode = 0600
+)
+
+// Rotation describes when the log file is rotated, and how the rotated backups are retained.
+type Rotation struct {
+	// MaxSize is the size in bytes at which the file is rotated. Zero disables size-based rotation.
+	MaxSize int64
+
+	// Interval is the period after which the file is rotated. Zero disables time-based rotation.
+	Interval time.Duration
+
+	// MaxBackups is the maximum number of rotated files to retain. Zero retains all backups.
+	MaxBackups int
+
+	// MaxAge is the maximum age of a rotated file before it is removed. Zero retains all backups.
+	MaxAge time.Duration
+
+	// Compress indicates whether rotated files are compressed with gzip.
+	Compress bool
+}
+
+// rotatingFileWriter is an io.Writer to a file which is rotated according to the Rotation policy.
+type rotatingFileWriter struct {
+	mutex        sync.Mutex
+	path         string
+	rotation     Rotation
+	clock        telemetry.Clock
+	file         *os.File
+	closed       bool
+	size         int64
+	nextRotation time.Time
+	millChannel  chan struct{}
+	millDone     chan struct{}
+}
+
+// newRotatingFileWriter creates a new instance of the rotatingFileWriter, opening (or creating) the file at the specified path for append
+func newRotatingFileWriter(path string, rotation Rotation, clock telemetry.Clock) (*rotatingFileWriter, error) {
+	writer := &rotatingFileWriter{
+		path:        path,
+		rotation:    rotation,
+		clock:       clock,
+		millChannel: make(chan struct{}, 1),
+		millDone:    make(chan struct{}),
+	}
+
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+
+	// Start the loop which compresses and removes backups, and tidy anything left behind by a previous run
+	go writer.millLoop()
+	writer.mill()
+
+	return writer, nil
+}
+
+// Write writes the content to the file, rotating it beforehand if the rotation policy requires it. If the file could not be reopened after
+// an earlier rotation or Reopen, opening it is tried again first.
+func (rfw *rotatingFileWriter) Write(p []byte) (int, error) {
+	rfw.mutex.Lock()
+	defer rfw.mutex.Unlock()
+
+	if rfw.closed {
+		return 0, os.ErrClosed
+	}
+
+	if rfw.file == nil {
+		if err := rfw.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if rfw.shouldRotate(int64(len(p))) {
+		if err := rfw.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rfw.file.Write(p)
+	rfw.size += int64(n)
+
+	return n, err
+}
+
+// Reopen closes and reopens the file at the same path. It is used when the file has been moved by an external tool such as logrotate. If
+// the file cannot be reopened, opening it is tried again by the next Write.
+func (rfw *rotatingFileWriter) Reopen() error {
+	rfw.mutex.Lock()
+	defer rfw.mutex.Unlock()
+
+	if rfw.closed {
+		return os.ErrClosed
+	}
+
+	if err := rfw.closeFile(); err != nil {
+		return err
+	}
+
+	return rfw.open()
+}
+
+// Close closes the file, and waits for any outstanding compression or removal of backups
+func (rfw *rotatingFileWriter) Close() error {
+	rfw.mutex.Lock()
+	defer rfw.mutex.Unlock()
+
+	if rfw.closed {
+		return nil
+	}
+
+	rfw.closed = true
+	err := rfw.closeFile()
+
+	close(rfw.millChannel)
+	<-rfw.millDone
+
+	return err
+}
+
+// closeFile closes the file, if it is open. Callers must hold the mutex.
+func (rfw *rotatingFileWriter) closeFile() error {
+	if rfw.file == nil {
+		return nil
+	}
+
+	err := rfw.file.Close()
+	rfw.file = nil
+
+	return err
+}
+
+// open opens the file for append and resets the rotation state from it. Callers must hold the mutex, or own the writer exclusively.
+func (rfw *rotatingFileWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(rfw.path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(rfw.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fileMode)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	rfw.file = file
+	rfw.size = info.Size()
+
+	if rfw.rotation.Interval > 0 {
+		rfw.nextRotation = rfw.clock.Now().Truncate(rfw.rotation.Interval).Add(rfw.rotation.Interval)
+	}
+
+	return nil
+}
+
+// shouldRotate determines whether writing the number of bytes requires the file to be rotated first
+func (rfw *rotatingFileWriter) shouldRotate(length int64) bool {
+	if rfw.rotation.MaxSize > 0 && rfw.size > 0 && rfw.size+length > rfw.rotation.MaxSize {
+		return true
+	}
+
+	return rfw.rotation.Interval > 0 && !rfw.clock.Now().Before(rfw.nextRotation)
+}
+
+// rotate moves the current file to a timestamped backup and opens a new file in its place. If the file cannot be moved, the failure is
+// reported through the diagnostics handler and writing continues to the same file. If the file cannot be reopened, it is left closed, to
+// be opened by the next Write. Callers must hold the mutex.
+func (rfw *rotatingFileWriter) rotate() error {
+	if err := rfw.closeFile(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(rfw.path, rfw.uniqueBackupPath(rfw.clock.Now())); err != nil {
+		telemetry.ReportDiagnostic(fmt.Errorf("unable to rotate the log file: %w", err))
+	} else {
+		rfw.mill()
+	}
+
+	return rfw.open()
+}
+
+// uniqueBackupPath creates the name of the backup for a file rotated at the specified time, moving the time on if a backup already exists with that name
+func (rfw *rotatingFileWriter) uniqueBackupPath(timestamp time.Time) string {
+	for {
+		path := rfw.backupPath(timestamp)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if _, err := os.Stat(path + compressSuffix); os.IsNotExist(err) {
+				return path
+			}
+		}
+
+		timestamp = timestamp.Add(time.Millisecond)
+	}
+}
+
+// backupPath creates the name of the backup for a file rotated at the specified time, e.g. "app.log" becomes "app-2006-01-02T15-04-05.000.log".
+// The time is written in UTC, so that the names sort in order and are read back as the same time wherever the clock's location is.
+func (rfw *rotatingFileWriter) backupPath(timestamp time.Time) string {
+	directory, prefix, extension := rfw.nameParts()
+
+	return filepath.Join(directory, fmt.Sprintf("%v%v%v", prefix, timestamp.UTC().Format(backupTimeFormat), extension))
+}
+
+// nameParts splits the path into the directory, the backup prefix and the extension
+func (rfw *rotatingFileWriter) nameParts() (string, string, string) {
+	directory := filepath.Dir(rfw.path)
+	name := filepath.Base(rfw.path)
+	extension := filepath.Ext(name)
+
+	return directory, strings.TrimSuffix(name, extension) + "-", extension
+}
+
+// mill signals the mill loop that the backups should be processed, without blocking the writer
+func (rfw *rotatingFileWriter) mill() {
+	select {
+	case rfw.millChannel <- struct{}{}:
+	default:
+		// Already pending
+	}
+}
+
+// millLoop processes the backups each time it is signalled, until the writer is closed
+func (rfw *rotatingFileWriter) millLoop() {
+	defer close(rfw.millDone)
+
+	for range rfw.millChannel {
+		if err := rfw.millBackups(); err != nil {
+			log.Printf("Unexpected error when processing rotated log files: %v", err.Error())
+		}
+	}
+}
+
+// backup represents a rotated file and the time at which it was rotated
+type backup struct {
+	path      string
+	timestamp time.Time
+}
+
+// millBackups compresses and removes the backups according to the rotation policy
+func (rfw *rotatingFileWriter) millBackups() error {
+	backups, err := rfw.listBackups()
+	if err != nil {
+		return err
+	}
+
+	// Newest first, so that the oldest are beyond the retention count
+	sort.Slice(backups, func(i, j int) bool { return backups[i].timestamp.After(backups[j].timestamp) })
+
+	retained := make([]backup, 0, len(backups))
+	cutoff := rfw.clock.Now().Add(-rfw.rotation.MaxAge)
+
+	for i, b := range backups {
+		if (rfw.rotation.MaxBackups > 0 && i >= rfw.rotation.MaxBackups) || (rfw.rotation.MaxAge > 0 && b.timestamp.Before(cutoff)) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		} else {
+			retained = append(retained, b)
+		}
+	}
+
+	if rfw.rotation.Compress {
+		for _, b := range retained {
+			if !strings.HasSuffix(b.path, compressSuffix) {
+				if err := compressFile(b.path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// listBackups finds the rotated files which belong to the writer
+func (rfw *rotatingFileWriter) listBackups() ([]backup, error) {
+	directory, prefix, extension := rfw.nameParts()
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]backup, 0)
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressSuffix), extension)
+
+		if timestamp, err := time.ParseInLocation(backupTimeFormat, stamp, time.UTC); err == nil {
+			backups = append(backups, backup{path: filepath.Join(directory, name), timestamp: timestamp})
+		}
+	}
+
+	return backups, nil
+}
+
+// compressFile writes a gzip compressed copy of the file, removing the original once complete
+func compressFile(path string) (err error) {
+	source, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+
+	defer source.Close()
+
+	target, err := os.OpenFile(path+compressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = target.Close()
+			_ = os.Remove(path + compressSuffix)
+		}
+	}()
+
+	compressor := gzip.NewWriter(target)
+
+	if _, err = io.Copy(compressor, source); err != nil {
+		return err
+	}
+
+	if err = compressor.Close(); err != nil {
+		return err
+	}
+
+	if err = target.Close(); err != nil {
+		return err
+	}
+
+	_ = source.Close()
+
+	return os.Remove(path)
+}
@@ -0,0 +1,375 @@
+package guard
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/stdlog"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+// faultyTraceListener is a recorder whose messages panic or hang while it is faulty
+type faultyTraceListener struct {
+	*telemetrytest.Recorder
+	panics  atomic.Bool
+	hang    chan struct{}
+	delay   time.Duration
+	started atomic.Int32
+}
+
+func newFaultyTraceListener() *faultyTraceListener {
+	return &faultyTraceListener{Recorder: telemetrytest.NewRecorder()}
+}
+
+func (ftl *faultyTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	ftl.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
+
+func (ftl *faultyTraceListener) TraceItem(item *telemetry.Item) {
+	ftl.started.Add(1)
+
+	if ftl.panics.Load() {
+		panic("listener is broken")
+	}
+
+	if ftl.hang != nil {
+		<-ftl.hang
+	}
+
+	time.Sleep(ftl.delay)
+
+	ftl.Recorder.TraceItem(item)
+}
+
+func TestPanickingListenerDoesNotAffectTheOthers(t *testing.T) {
+	defer telemetry.Close()
+
+	t.Log("Given a guarded listener which panics and a healthy listener")
+	{
+		faulty := newFaultyTraceListener()
+		faulty.panics.Store(true)
+
+		var guarded telemetry.TraceListener = NewGuardedTraceListener("faulty", faulty, Settings{})
+		recorder := telemetrytest.NewRecorder()
+		var healthy telemetry.TraceListener = recorder
+
+		telemetry.AddListener(&guarded)
+		telemetry.AddListener(&healthy)
+
+		t.Log("\tWhen a message is traced")
+		{
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("\t\t[%v] The panic does not reach the caller. Panic: %v", ballotX, r)
+					}
+				}()
+
+				telemetry.TraceInformation("Test message")
+			}()
+
+			if len(recorder.Messages()) == 1 {
+				t.Logf("\t\t[%v] The healthy listener receives the message.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The healthy listener receives the message.", ballotX)
+			}
+
+			health := guarded.(*GuardedTraceListener).Health()
+
+			if health.TotalFailures == 1 && health.LastError == "panic: listener is broken" {
+				t.Logf("\t\t[%v] The failure is reported in the health.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The failure is reported in the health. Actual: %+v", ballotX, health)
+			}
+		}
+	}
+}
+
+func TestBreakerOpensAfterRepeatedFailuresAndRecovers(t *testing.T) {
+	t.Log("Given a guarded listener which opens after 3 failures for 1 minute")
+	{
+		clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 10, 0, 0, 0, time.UTC))
+		faulty := newFaultyTraceListener()
+		faulty.panics.Store(true)
+
+		guarded := NewGuardedTraceListener("breaker", faulty, Settings{FailureThreshold: 3, OpenDuration: time.Minute}, telemetry.WithClock(clock))
+		defer guarded.Close()
+
+		t.Log("\tWhen 5 messages fail")
+		{
+			for i := 0; i < 5; i++ {
+				guarded.TraceMessage("Test message", telemetry.Error)
+			}
+
+			health := guarded.Health()
+
+			if health.State == Open && health.TotalFailures == 3 && health.Dropped == 2 && faulty.started.Load() == 3 {
+				t.Logf("\t\t[%v] The breaker opens and later calls are dropped.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The breaker opens and later calls are dropped. Actual: %+v", ballotX, health)
+			}
+		}
+
+		t.Log("\tWhen the listener fails its trial call after the open duration")
+		{
+			clock.Advance(time.Minute)
+			guarded.TraceMessage("Test message", telemetry.Error)
+			guarded.TraceMessage("Test message", telemetry.Error)
+
+			if health := guarded.Health(); health.State == Open && health.TotalFailures == 4 && health.Dropped == 3 {
+				t.Logf("\t\t[%v] The breaker opens again.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The breaker opens again. Actual: %+v", ballotX, health)
+			}
+		}
+
+		t.Log("\tWhen the listener recovers")
+		{
+			faulty.panics.Store(false)
+			clock.Advance(time.Minute)
+			guarded.TraceMessage("Test message", telemetry.Error)
+
+			if health := guarded.Health(); health.Healthy() && health.ConsecutiveFailures == 0 && len(faulty.Messages()) == 1 {
+				t.Logf("\t\t[%v] The trial call succeeds and the breaker closes.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The trial call succeeds and the breaker closes. Actual: %+v", ballotX, health)
+			}
+		}
+	}
+}
+
+func TestHangingListenerIsAbandonedAfterTheTimeout(t *testing.T) {
+	t.Log("Given a guarded listener with a 20ms timeout which hangs")
+	{
+		faulty := newFaultyTraceListener()
+		faulty.hang = make(chan struct{})
+		defer close(faulty.hang)
+
+		guarded := NewGuardedTraceListener("hanging", faulty, Settings{Timeout: 20 * time.Millisecond})
+		defer guarded.Close()
+
+		t.Log("\tWhen a message is traced")
+		{
+			start := time.Now()
+			guarded.TraceMessage("Test message", telemetry.Information)
+			elapsed := time.Since(start)
+
+			if elapsed < time.Second {
+				t.Logf("\t\t[%v] The caller is released after the timeout.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The caller is released after the timeout. Actual: %v", ballotX, elapsed)
+			}
+
+			if health := guarded.Health(); health.LastError == "call timed out after 20ms" {
+				t.Logf("\t\t[%v] The timeout is reported in the health.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The timeout is reported in the health. Actual: %+v", ballotX, health)
+			}
+		}
+	}
+}
+
+func TestBreakerChangesAreReportedWithoutHoldingTheGuard(t *testing.T) {
+	defer telemetry.Close()
+	defer log.SetOutput(os.Stderr)
+	defer telemetry.SetDiagnosticsHandler(nil)
+
+	t.Log("Given a guarded listener which panics and opens after 1 failure, with the standard logger redirected to the telemetry")
+	{
+		faulty := newFaultyTraceListener()
+		faulty.panics.Store(true)
+
+		guarded := NewGuardedTraceListener("faulty", faulty, Settings{FailureThreshold: 1})
+		var listener telemetry.TraceListener = guarded
+		telemetry.AddListener(&listener)
+
+		var reported atomic.Value
+		telemetry.SetDiagnosticsHandler(func(err error) {
+			reported.Store(err.Error())
+			log.Printf("Telemetry: %v", err)
+		})
+
+		stdlog.Redirect(telemetry.Warning)
+
+		t.Log("\tWhen a message is traced")
+		{
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				telemetry.TraceInformation("Test message")
+			}()
+
+			select {
+			case <-done:
+				t.Logf("\t\t[%v] The call returns.", checkMark)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t\t[%v] The call returns.", ballotX)
+			}
+
+			stdlog.Flush()
+
+			if message, _ := reported.Load().(string); strings.HasPrefix(message, "trace listener 'faulty' has failed 1 times") {
+				t.Logf("\t\t[%v] The opening of the breaker is reported to the diagnostics handler.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The opening of the breaker is reported to the diagnostics handler. Actual: %v", ballotX, message)
+			}
+
+			if health := guarded.Health(); health.State == Open && health.Dropped == 1 {
+				t.Logf("\t\t[%v] The logged report is dropped by the open breaker.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The logged report is dropped by the open breaker. Actual: %+v", ballotX, health)
+			}
+		}
+	}
+}
+
+func TestOnlyOneCallIsAbandonedWhileTheListenerHangs(t *testing.T) {
+	t.Log("Given a guarded listener with a 20ms timeout which hangs")
+	{
+		faulty := newFaultyTraceListener()
+		faulty.hang = make(chan struct{})
+
+		guarded := NewGuardedTraceListener("hanging", faulty, Settings{Timeout: 20 * time.Millisecond, FailureThreshold: 10})
+		defer guarded.Close()
+
+		t.Log("\tWhen a request is tracked, and messages are traced and the request is checked while the first message hangs")
+		{
+			request := guarded.TrackRequest("GET", "/orders")
+			finished := false
+
+			for i := 0; i < 5; i++ {
+				guarded.TraceMessage("Test message", telemetry.Information)
+				finished = finished || (*request).Finished()
+			}
+
+			health := guarded.Health()
+
+			if faulty.started.Load() == 1 && health.TotalFailures == 1 && health.Dropped == 9 && !finished {
+				t.Logf("\t\t[%v] Only the first call reaches the listener, and the others are dropped.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the first call reaches the listener, and the others are dropped. Actual: %v, %+v", ballotX,
+					faulty.started.Load(), health)
+			}
+		}
+
+		t.Log("\tWhen the hanging call returns")
+		{
+			close(faulty.hang)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for faulty.started.Load() == 1 && time.Now().Before(deadline) {
+				guarded.TraceMessage("Test message", telemetry.Information)
+				time.Sleep(time.Millisecond)
+			}
+
+			if len(faulty.Messages()) > 0 && guarded.Health().Healthy() {
+				t.Logf("\t\t[%v] Calls reach the listener again.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Calls reach the listener again. Actual: %+v", ballotX, guarded.Health())
+			}
+		}
+	}
+}
+
+func TestWaitingForTheCallBeforeIsNotAFailure(t *testing.T) {
+	t.Log("Given a guarded listener with a 120ms timeout which takes 70ms per call")
+	{
+		faulty := newFaultyTraceListener()
+		faulty.delay = 70 * time.Millisecond
+
+		guarded := NewGuardedTraceListener("slow", faulty, Settings{Timeout: 120 * time.Millisecond})
+		defer guarded.Close()
+
+		t.Log("\tWhen two messages are traced at the same time")
+		{
+			var wg sync.WaitGroup
+
+			for i := 0; i < 2; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+					guarded.TraceMessage("Test message", telemetry.Information)
+				}()
+			}
+
+			wg.Wait()
+
+			if health := guarded.Health(); len(faulty.Messages()) == 2 && health.TotalFailures == 0 && health.Dropped == 0 {
+				t.Logf("\t\t[%v] Both messages are delivered, as the timeout of each starts once it reaches the listener.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Both messages are delivered, as the timeout of each starts once it reaches the listener. Actual: %v, %+v",
+					ballotX, len(faulty.Messages()), health)
+			}
+		}
+	}
+
+	t.Log("Given a guarded listener with a 50ms timeout which hangs")
+	{
+		faulty := newFaultyTraceListener()
+		faulty.hang = make(chan struct{})
+		defer close(faulty.hang)
+
+		guarded := NewGuardedTraceListener("hanging", faulty, Settings{Timeout: 50 * time.Millisecond})
+		defer guarded.Close()
+
+		t.Log("\tWhen a second message is traced while the first hangs")
+		{
+			var wg sync.WaitGroup
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				guarded.TraceMessage("First message", telemetry.Information)
+			}()
+
+			for faulty.started.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			guarded.TraceMessage("Second message", telemetry.Information)
+			wg.Wait()
+
+			if health := guarded.Health(); faulty.started.Load() == 1 && health.TotalFailures == 1 && health.Dropped == 1 {
+				t.Logf("\t\t[%v] The first message fails and the waiting second message is dropped.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The first message fails and the waiting second message is dropped. Actual: %v, %+v", ballotX,
+					faulty.started.Load(), health)
+			}
+		}
+	}
+}
+
+func TestHealthReportListsOpenGuards(t *testing.T) {
+	t.Log("Given two guarded listeners")
+	{
+		first := NewGuardedTraceListener("first", telemetrytest.NewRecorder(), Settings{})
+		second := NewGuardedTraceListener("second", telemetrytest.NewRecorder(), Settings{})
+
+		t.Log("\tWhen one is closed")
+		{
+			first.Close()
+
+			report := HealthReport()
+
+			if len(report) == 1 && report[0].Name == "second" && report[0].Healthy() {
+				t.Logf("\t\t[%v] Only the open listener is reported.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the open listener is reported. Actual: %+v", ballotX, report)
+			}
+
+			second.Close()
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failures which opens the breaker when the Settings do not specify one
+	DefaultFailureThreshold int = 5
+
+	// DefaultOpenDuration is how long the breaker stays open when the Settings do not specify a duration
+	DefaultOpenDuration time.Duration = 30 * time.Second
+)
+
+var (
+	// errAbandoned is the outcome of a call which is dropped because the call before it was abandoned after a timeout and has not yet
+	// returned
+	errAbandoned = errors.New("an abandoned call to the listener has not returned")
+
+	// errBusy is the outcome of a call which is dropped because the call before it did not return within the timeout
+	errBusy = errors.New("the call before has not returned within the timeout")
+)
+
+// Settings configures a guarded listener
+type Settings struct {
+	// Timeout limits how long each call to the listener may take. A call which times out is abandoned and counted as a failure. Zero calls
+	// the listener inline without a timeout, which is cheaper for listeners which never block, such as those which are asynchronous.
+	// With a timeout, the listener is called one call at a time, and calls are dropped while an abandoned call has not returned, so that a
+	// hanging listener holds on to a single goroutine. A call waits up to the timeout for the call before it to return, and is dropped
+	// rather than failed if it does not; its own timeout starts once it is passed to the listener.
+	Timeout time.Duration
+
+	// FailureThreshold is the number of consecutive failures which opens the breaker. Defaults to DefaultFailureThreshold.
+	FailureThreshold int
+
+	// OpenDuration is how long the breaker stays open before a trial call is allowed. Defaults to DefaultOpenDuration.
+	OpenDuration time.Duration
+}
+
+// GuardedTraceListener isolates the rest of the application from a misbehaving trace listener. Panics from the listener are recovered, calls
+// can be limited by a timeout, and repeated failures open a circuit breaker which drops calls until the listener has had time to recover.
+// The opening and closing of the breaker are reported through the diagnostics handler of the telemetry package. Listeners built by the
+// config package are guarded when their section sets guard.
+type GuardedTraceListener struct {
+	inner     *telemetry.TraceListener
+	settings  Settings
+	clock     telemetry.Clock
+	mutex     sync.Mutex
+	health    Health
+	openedAt  time.Time
+	trialBusy bool
+	slot      chan struct{}
+	abandoned bool
+}
+
+// NewGuardedTraceListener creates a guard around the listener, which is included in the HealthReport under the name until it is closed
+func NewGuardedTraceListener(name string, listener telemetry.TraceListener, settings Settings, options ...telemetry.ListenerOption) *GuardedTraceListener {
+	listenerOptions := telemetry.NewListenerOptions(options...)
+
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultFailureThreshold
+	}
+
+	if settings.OpenDuration <= 0 {
+		settings.OpenDuration = DefaultOpenDuration
+	}
+
+	guard := &GuardedTraceListener{
+		inner:    &listener,
+		settings: settings,
+		clock:    listenerOptions.Clock,
+		health:   Health{Name: name, State: Closed},
+		slot:     make(chan struct{}, 1),
+	}
+
+	register(guard)
+
+	return guard
+}
+
+// Health returns a snapshot of the state of the listener
+func (g *GuardedTraceListener) Health() Health {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.health
+}
+
+func (g *GuardedTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	g.call(func() { (*g.inner).TraceMessage(message, severity) })
+}
+
+func (g *GuardedTraceListener) TraceException(err error) {
+	g.call(func() { (*g.inner).TraceException(err) })
+}
+
+// TracePanic is passed straight to the listener, as the panic it recovers would otherwise be lost
+func (g *GuardedTraceListener) TracePanic(rethrow bool) {
+	(*g.inner).TracePanic(rethrow)
+}
+
+func (g *GuardedTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return g.track(func() *telemetry.DurationTrace { return (*g.inner).TrackAvailability(name) })
+}
+
+func (g *GuardedTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return g.track(func() *telemetry.DurationTrace { return (*g.inner).TrackRequest(method, uri) })
+}
+
+func (g *GuardedTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return g.track(func() *telemetry.DurationTrace { return (*g.inner).TrackDependency(name, dependencyType, target) })
+}
+
+func (g *GuardedTraceListener) TraceMetric(name string, value float64) {
+	g.call(func() { (*g.inner).TraceMetric(name, value) })
+}
+
+func (g *GuardedTraceListener) TraceEvent(name string) {
+	g.call(func() { (*g.inner).TraceEvent(name) })
+}
+
+func (g *GuardedTraceListener) TraceItem(item *telemetry.Item) {
+	g.call(func() { telemetry.TraceItemTo(*g.inner, item) })
+}
+
+func (g *GuardedTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	return g.track(func() *telemetry.DurationTrace { return telemetry.TrackItemTo(*g.inner, item) })
+}
+
+func (g *GuardedTraceListener) Flush() {
+	g.call(func() { (*g.inner).Flush() })
+}
+
+// Close closes the listener, whatever the state of the breaker, and removes it from the HealthReport
+func (g *GuardedTraceListener) Close() {
+	unregister(g)
+
+	g.record(g.run(func() { (*g.inner).Close() }))
+}
+
+// track starts a duration trace, whose calls are also guarded. A no-op trace is returned if the call is dropped or fails.
+func (g *GuardedTraceListener) track(start func() *telemetry.DurationTrace) *telemetry.DurationTrace {
+	inner, ok := callFor(g, start)
+	if !ok || inner == nil {
+		return telemetry.NoopDurationTrace()
+	}
+
+	var trace telemetry.DurationTrace = &guardedDurationTrace{guard: g, inner: inner}
+
+	return &trace
+}
+
+// call passes the call to the listener if the breaker allows it, returning whether it succeeded
+func (g *GuardedTraceListener) call(fn func()) bool {
+	if !g.allow() {
+		return false
+	}
+
+	err := g.run(fn)
+	g.record(err)
+
+	return err == nil
+}
+
+// callFor passes the call to the listener as call does, returning its result, or the zero value if the call is dropped or fails. The result
+// is passed back through a channel, so that a call which is abandoned after a timeout does not race with the caller when it returns.
+func callFor[T any](g *GuardedTraceListener, fn func() T) (T, bool) {
+	result := make(chan T, 1)
+
+	if !g.call(func() { result <- fn() }) {
+		var zero T
+		return zero, false
+	}
+
+	return <-result, true
+}
+
+// run calls the function, converting a panic or timeout into an error. With a timeout, the function is called once the call before it has
+// returned, and not at all while the call before it is abandoned or if it does not return within the timeout.
+func (g *GuardedTraceListener) run(fn func()) error {
+	if g.settings.Timeout <= 0 {
+		return protect(fn)
+	}
+
+	g.mutex.Lock()
+	abandoned := g.abandoned
+	g.mutex.Unlock()
+
+	if abandoned {
+		return errAbandoned
+	}
+
+	wait := time.NewTimer(g.settings.Timeout)
+
+	select {
+	case g.slot <- struct{}{}:
+		wait.Stop()
+
+	case <-wait.C:
+		return errBusy
+	}
+
+	timer := time.NewTimer(g.settings.Timeout)
+	defer timer.Stop()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- protect(fn)
+
+		g.mutex.Lock()
+		g.abandoned = false
+		g.mutex.Unlock()
+
+		<-g.slot
+	}()
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-timer.C:
+		return g.abandon(done)
+	}
+}
+
+// abandon marks the call in flight as abandoned, unless it has returned in the meantime, in which case its outcome is returned
+func (g *GuardedTraceListener) abandon(done chan error) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+
+	default:
+		g.abandoned = true
+		return fmt.Errorf("call timed out after %v", g.settings.Timeout)
+	}
+}
+
+// allow decides whether a call is passed to the listener, moving an open breaker to half-open once the open duration has passed
+func (g *GuardedTraceListener) allow() bool {
+	now := g.clock.Now()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	switch g.health.State {
+	case Open:
+		if now.Sub(g.openedAt) < g.settings.OpenDuration {
+			g.health.Dropped++
+			return false
+		}
+
+		g.health.State = HalfOpen
+		g.trialBusy = true
+		return true
+
+	case HalfOpen:
+		if g.trialBusy {
+			g.health.Dropped++
+			return false
+		}
+
+		g.trialBusy = true
+		return true
+
+	default:
+		return true
+	}
+}
+
+// record updates the health and breaker with the outcome of a call. A change of the breaker is reported through the diagnostics handler
+// once the lock is released, as the handler may trace, e.g. through the standard logger, and so call the guard again.
+func (g *GuardedTraceListener) record(err error) {
+	if change := g.update(err); change != nil {
+		telemetry.ReportDiagnostic(change)
+	}
+}
+
+// update updates the health and breaker with the outcome of a call, returning a description of the change of the breaker, if any
+func (g *GuardedTraceListener) update(err error) error {
+	now := g.clock.Now()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.trialBusy = false
+
+	if errors.Is(err, errAbandoned) || errors.Is(err, errBusy) {
+		g.health.Dropped++
+		return nil
+	}
+
+	if err == nil {
+		var change error
+		if g.health.State != Closed {
+			change = fmt.Errorf("trace listener '%v' has recovered", g.health.Name)
+		}
+
+		g.health.State = Closed
+		g.health.ConsecutiveFailures = 0
+		return change
+	}
+
+	g.health.ConsecutiveFailures++
+	g.health.TotalFailures++
+	g.health.LastError = err.Error()
+	g.health.LastFailure = now
+
+	if g.health.State == HalfOpen || (g.health.State == Closed && g.health.ConsecutiveFailures >= g.settings.FailureThreshold) {
+		g.health.State = Open
+		g.openedAt = now
+
+		return fmt.Errorf("trace listener '%v' has failed %v times and is disabled for %v: %w", g.health.Name, g.health.ConsecutiveFailures,
+			g.settings.OpenDuration, err)
+	}
+
+	return nil
+}
+
+// protect calls the function, converting a panic into an error
+func protect(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	fn()
+
+	return nil
+}
+
+// guardedDurationTrace passes the calls of a duration trace through its listener's guard
+type guardedDurationTrace struct {
+	guard *GuardedTraceListener
+	inner *telemetry.DurationTrace
+}
+
+// Complete indicates a successful completion of the measured duration activity
+func (gdt *guardedDurationTrace) Complete() {
+	gdt.guard.call(func() { (*gdt.inner).Complete() })
+}
+
+// Fail indicates an unsuccessful completion of the measured duration activity
+func (gdt *guardedDurationTrace) Fail(statusCode string) {
+	gdt.guard.call(func() { (*gdt.inner).Fail(statusCode) })
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (gdt *guardedDurationTrace) CompleteWithStatus(statusCode string) {
+	gdt.guard.call(func() { (*gdt.inner).CompleteWithStatus(statusCode) })
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code
+func (gdt *guardedDurationTrace) SetStatusCode(code int) {
+	gdt.guard.call(func() { (*gdt.inner).SetStatusCode(code) })
+}
+
+// Done indicates that the trace is complete and should be committed to the telemetry source
+func (gdt *guardedDurationTrace) Done() {
+	gdt.guard.call(func() { (*gdt.inner).Done() })
+}
+
+// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source
+func (gdt *guardedDurationTrace) DoneAt(end time.Time) {
+	gdt.guard.call(func() { telemetry.DoneAt(gdt.inner, end) })
+}
+
+// Finished indicates whether Done has been called. False is returned if the call is dropped or fails.
+func (gdt *guardedDurationTrace) Finished() bool {
+	finished, _ := callFor(gdt.guard, func() bool { return (*gdt.inner).Finished() })
+
+	return finished
+}
+
+// Duration returns the time taken by the measured duration activity. Zero is returned if the call is dropped or fails.
+func (gdt *guardedDurationTrace) Duration() time.Duration {
+	duration, _ := callFor(gdt.guard, func() time.Duration { return (*gdt.inner).Duration() })
+
+	return duration
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity, whose calls are also guarded
+func (gdt *guardedDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	return gdt.guard.track(func() *telemetry.DurationTrace { return (*gdt.inner).StartChild(name) })
+}
+
+// SetProperty sets a custom named value of the measured duration activity
+func (gdt *guardedDurationTrace) SetProperty(name string, value string) {
+	gdt.guard.call(func() { (*gdt.inner).SetProperty(name, value) })
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+func (gdt *guardedDurationTrace) SetMeasurement(name string, value float64) {
+	gdt.guard.call(func() { (*gdt.inner).SetMeasurement(name, value) })
+}
+
+// SetSource sets the source of a request
+func (gdt *guardedDurationTrace) SetSource(source string) {
+	gdt.guard.call(func() { (*gdt.inner).SetSource(source) })
+}
+
+// SetURL sets the full URL of a request
+func (gdt *guardedDurationTrace) SetURL(url string) {
+	gdt.guard.call(func() { (*gdt.inner).SetURL(url) })
+}
+
+// SetData sets the command of a dependency call
+func (gdt *guardedDurationTrace) SetData(data string) {
+	gdt.guard.call(func() { (*gdt.inner).SetData(data) })
+}
+
+// SetRunLocation sets where an availability test ran
+func (gdt *guardedDurationTrace) SetRunLocation(location string) {
+	gdt.guard.call(func() { (*gdt.inner).SetRunLocation(location) })
+}
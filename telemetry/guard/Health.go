@@ -0,0 +1,102 @@
+package guard
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a guard's circuit breaker
+type State int32
+
+const (
+	// Closed indicates that calls are passed to the listener
+	Closed State = 0
+
+	// Open indicates that the listener has failed repeatedly, and calls are dropped until the open duration has passed
+	Open State = 1
+
+	// HalfOpen indicates that a single trial call is being passed to the listener to decide whether to close the breaker again
+	HalfOpen State = 2
+)
+
+// ToString converts the State to a readable string
+func (s State) ToString() string {
+	switch s {
+	case Closed:
+		return "Closed"
+	case Open:
+		return "Open"
+	case HalfOpen:
+		return "HalfOpen"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Health is a snapshot of the state of a guarded listener
+type Health struct {
+	// Name identifies the listener
+	Name string
+
+	// State is the state of the circuit breaker
+	State State
+
+	// ConsecutiveFailures is the number of failed calls since the last successful call
+	ConsecutiveFailures int
+
+	// TotalFailures is the number of calls which have panicked or timed out
+	TotalFailures int
+
+	// Dropped is the number of calls which were not passed to the listener because the breaker was open, or because an abandoned call had
+	// not returned
+	Dropped int
+
+	// LastError describes the most recent failure
+	LastError string
+
+	// LastFailure is the time of the most recent failure
+	LastFailure time.Time
+}
+
+// Healthy indicates whether the breaker is closed
+func (h Health) Healthy() bool {
+	return h.State == Closed
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []*GuardedTraceListener
+)
+
+// HealthReport returns the health of every guarded listener which has not been closed, in the order they were created
+func HealthReport() []Health {
+	registryMutex.Lock()
+	guards := append([]*GuardedTraceListener{}, registry...)
+	registryMutex.Unlock()
+
+	report := make([]Health, 0, len(guards))
+	for _, guard := range guards {
+		report = append(report, guard.Health())
+	}
+
+	return report
+}
+
+func register(guard *GuardedTraceListener) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, guard)
+}
+
+func unregister(guard *GuardedTraceListener) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for i, registered := range registry {
+		if registered == guard {
+			registry = append(registry[:i], registry[i+1:]...)
+			return
+		}
+	}
+}
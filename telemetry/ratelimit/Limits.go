@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// DefaultWindow is the window used when the Limits do not specify one
+const DefaultWindow time.Duration = 10 * time.Second
+
+// Rate is a token bucket limit: up to Burst messages at once, refilled at PerSecond messages per second
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// KeyFunc returns the text which identifies duplicate messages. Messages are only duplicates if they also have the same severity.
+type KeyFunc func(item *telemetry.Item) string
+
+// Limits configures a rate limiting trace listener
+type Limits struct {
+	// Window is the period within which identical messages are collapsed into the first one, followed by a summary of how many were
+	// suppressed. It is also how often summaries of rate limited messages are written. Defaults to DefaultWindow.
+	Window time.Duration
+
+	// Key identifies duplicate messages. Defaults to ByText.
+	Key KeyFunc
+
+	// Rates limits the messages of each severity which are not duplicates. Severities without a rate are not limited.
+	Rates map[telemetry.Severity]Rate
+}
+
+var (
+	templateQuoted  = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	templateHex     = regexp.MustCompile(`\b(?:0x[0-9A-Fa-f]+|[0-9A-Fa-f]{8,}(?:-[0-9A-Fa-f]{4,})*)\b`)
+	templateNumbers = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// ByText identifies duplicates by the exact message or error text
+func ByText(item *telemetry.Item) string {
+	return text(item)
+}
+
+// ByTemplate identifies duplicates by the message or error text with quoted strings, identifiers and numbers replaced by placeholders, so that
+// "timeout after 30ms calling 10.0.0.7" and "timeout after 31ms calling 10.0.0.9" are duplicates.
+func ByTemplate(item *telemetry.Item) string {
+	template := templateQuoted.ReplaceAllString(text(item), `"*"`)
+	template = templateHex.ReplaceAllString(template, "#")
+
+	return templateNumbers.ReplaceAllString(template, "#")
+}
+
+func text(item *telemetry.Item) string {
+	if item.Kind == telemetry.ExceptionItem && item.Err != nil {
+		return item.Err.Error()
+	}
+
+	return item.Message
+}
@@ -0,0 +1,249 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+func newTestListener(limits Limits) (telemetry.TraceListener, *telemetrytest.Recorder, *telemetrytest.ManualClock) {
+	clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 10, 0, 0, 0, time.UTC))
+	recorder := telemetrytest.NewRecorder()
+
+	return NewRateLimitingTraceListener(recorder, limits, telemetry.WithClock(clock)), recorder, clock
+}
+
+func TestDuplicatesAreCollapsedWithinTheWindow(t *testing.T) {
+	t.Log("Given a rate limiting listener with a 10 second window")
+	{
+		tl, recorder, clock := newTestListener(Limits{Window: 10 * time.Second})
+		defer tl.Close()
+
+		t.Log("\tWhen the same error is traced 4,214 times")
+		{
+			for i := 0; i < 4214; i++ {
+				tl.TraceMessage("connection refused", telemetry.Error)
+			}
+
+			if len(recorder.Messages()) == 1 {
+				t.Logf("\t\t[%v] Only the first message is written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the first message is written. Actual: %v", ballotX, len(recorder.Messages()))
+			}
+		}
+
+		t.Log("\tWhen the window closes")
+		{
+			clock.Advance(10 * time.Second)
+			tl.Flush()
+
+			expected := "Suppressed 4,213 duplicates of: connection refused"
+			messages := recorder.Messages()
+
+			if len(messages) == 2 && messages[1].Message == expected && messages[1].Severity == telemetry.Error {
+				t.Logf("\t\t[%v] A summary of the duplicates is written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] A summary of the duplicates is written. Expected: '%v', Actual: %v", ballotX, expected, messages)
+			}
+		}
+
+		t.Log("\tWhen the error is traced again")
+		{
+			tl.TraceMessage("connection refused", telemetry.Error)
+
+			if len(recorder.Messages()) == 3 {
+				t.Logf("\t\t[%v] The message is written in the new window.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message is written in the new window. Actual: %v", ballotX, len(recorder.Messages()))
+			}
+		}
+	}
+}
+
+func TestDuplicatesAreIdentifiedBySeverityAndKey(t *testing.T) {
+	t.Log("Given a rate limiting listener which identifies duplicates by template")
+	{
+		tl, recorder, _ := newTestListener(Limits{Key: ByTemplate})
+
+		t.Log("\tWhen messages differing only by numbers and identifiers are traced")
+		{
+			tl.TraceMessage("timeout after 30ms calling 10.0.0.7 for \"orders\"", telemetry.Warning)
+			tl.TraceMessage("timeout after 31ms calling 10.0.0.9 for \"invoices\"", telemetry.Warning)
+			tl.TraceException(errors.New("request 3fa85f64-5717-4562-b3fc-2c963f66afa6 failed"))
+			tl.TraceException(errors.New("request 9c858901-8a57-4791-81fe-4c455b099bc9 failed"))
+
+			if len(recorder.Messages()) == 1 && len(recorder.Exceptions()) == 1 {
+				t.Logf("\t\t[%v] They are collapsed as duplicates.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] They are collapsed as duplicates. Actual: %v messages, %v exceptions", ballotX, len(recorder.Messages()), len(recorder.Exceptions()))
+			}
+		}
+
+		t.Log("\tWhen the same text is traced at another severity")
+		{
+			tl.TraceMessage("timeout after 30ms calling 10.0.0.7 for \"orders\"", telemetry.Error)
+
+			if len(recorder.Messages()) == 2 {
+				t.Logf("\t\t[%v] It is not a duplicate.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] It is not a duplicate. Actual: %v", ballotX, len(recorder.Messages()))
+			}
+		}
+
+		t.Log("\tWhen the listener is closed")
+		{
+			tl.Close()
+
+			summaries := 0
+			for _, message := range recorder.Messages() {
+				if message.Message == "Suppressed 1 duplicates of: timeout after 30ms calling 10.0.0.7 for \"orders\"" {
+					summaries++
+				}
+			}
+
+			if summaries == 1 && len(recorder.Messages()) == 4 {
+				t.Logf("\t\t[%v] Summaries of the open windows are written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Summaries of the open windows are written. Actual: %v", ballotX, recorder.Messages())
+			}
+		}
+	}
+}
+
+func TestMessagesAreLimitedPerSeverity(t *testing.T) {
+	t.Log("Given a rate limiting listener allowing bursts of 2 warnings, then 1 per second")
+	{
+		tl, recorder, clock := newTestListener(Limits{Rates: map[telemetry.Severity]Rate{telemetry.Warning: {PerSecond: 1, Burst: 2}}})
+
+		t.Log("\tWhen 5 different warnings and 5 different errors are traced")
+		{
+			for i := 0; i < 5; i++ {
+				tl.TraceMessage(fmt.Sprintf("Warning %v", i), telemetry.Warning)
+				tl.TraceMessage(fmt.Sprintf("Error %v", i), telemetry.Error)
+			}
+
+			warnings := len(recorder.FindMessages(telemetry.Warning, "Warning"))
+			errs := len(recorder.FindMessages(telemetry.Error, "Error"))
+
+			if warnings == 2 && errs == 5 {
+				t.Logf("\t\t[%v] The warnings are limited to the burst and the errors are not limited.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The warnings are limited to the burst and the errors are not limited. Actual: %v warnings, %v errors", ballotX, warnings, errs)
+			}
+		}
+
+		t.Log("\tWhen a second passes")
+		{
+			clock.Advance(time.Second)
+			tl.TraceMessage("Warning 5", telemetry.Warning)
+			tl.TraceMessage("Warning 6", telemetry.Warning)
+
+			if warnings := len(recorder.FindMessages(telemetry.Warning, "Warning")); warnings == 3 {
+				t.Logf("\t\t[%v] One more warning is allowed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] One more warning is allowed. Actual: %v", ballotX, warnings)
+			}
+		}
+
+		t.Log("\tWhen the listener is closed")
+		{
+			tl.Close()
+
+			expected := "Rate limited 4 Warning messages"
+
+			if len(recorder.FindMessages(telemetry.Warning, expected)) == 1 {
+				t.Logf("\t\t[%v] A summary of the limited messages is written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] A summary of the limited messages is written. Expected: '%v', Actual: %v", ballotX, expected, recorder.Messages())
+			}
+		}
+	}
+}
+
+func TestCountsAreFormattedWithSeparators(t *testing.T) {
+	t.Log("Given counts of different sizes")
+	{
+		for count, expected := range map[int]string{7: "7", 999: "999", 1000: "1,000", 4213: "4,213", 1234567: "1,234,567"} {
+			t.Logf("\tWhen %v is formatted", count)
+			{
+				if actual := formatCount(count); actual == expected {
+					t.Logf("\t\t[%v] It has thousands separators.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] It has thousands separators. Expected: '%v', Actual: '%v'", ballotX, expected, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestRateLimitedMessagesDoNotSuppressTheirDuplicates(t *testing.T) {
+	t.Log("Given a rate limiting listener allowing one error at once, refilled at one a second")
+	{
+		tl, recorder, clock := newTestListener(Limits{Rates: map[telemetry.Severity]Rate{telemetry.Error: {PerSecond: 1, Burst: 1}}})
+		defer tl.Close()
+
+		t.Log("\tWhen a second error is rate limited and traced again once a token is available, within the window")
+		{
+			tl.TraceMessage("connection refused", telemetry.Error)
+			tl.TraceMessage("disk full", telemetry.Error)
+
+			clock.Advance(time.Second)
+			tl.TraceMessage("disk full", telemetry.Error)
+
+			messages := recorder.Messages()
+
+			if len(messages) == 2 && messages[1].Message == "disk full" {
+				t.Logf("\t\t[%v] The error is written, as its first occurrence was never passed on.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The error is written, as its first occurrence was never passed on. Actual: %v", ballotX, messages)
+			}
+		}
+	}
+}
+
+func TestTheInnerListenerIsOnlyFlushedWhenThereAreSummaries(t *testing.T) {
+	t.Log("Given a rate limiting listener with a 10 millisecond window, using the system clock")
+	{
+		recorder := telemetrytest.NewRecorder()
+		tl := NewRateLimitingTraceListener(recorder, Limits{Window: 10 * time.Millisecond})
+		defer tl.Close()
+
+		t.Log("\tWhen several windows close without anything being suppressed")
+		{
+			tl.TraceMessage("connection refused", telemetry.Error)
+			time.Sleep(100 * time.Millisecond)
+
+			if recorder.Flushes() == 0 {
+				t.Logf("\t\t[%v] The inner listener is not flushed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The inner listener is not flushed. Actual: %v flushes", ballotX, recorder.Flushes())
+			}
+		}
+
+		t.Log("\tWhen a window closes after duplicates were suppressed")
+		{
+			tl.TraceMessage("disk full", telemetry.Error)
+			tl.TraceMessage("disk full", telemetry.Error)
+
+			for deadline := time.Now().Add(5 * time.Second); recorder.Flushes() == 0 && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if recorder.Flushes() > 0 && len(recorder.FindMessages(telemetry.Error, "Suppressed 1 duplicates of: disk full")) == 1 {
+				t.Logf("\t\t[%v] The summary is written and the inner listener flushed.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The summary is written and the inner listener flushed. Actual: %v flushes, %v", ballotX, recorder.Flushes(),
+					recorder.Messages())
+			}
+		}
+	}
+}
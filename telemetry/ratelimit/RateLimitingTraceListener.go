@@ -0,0 +1,292 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+type duplicateKey struct {
+	kind     telemetry.ItemKind
+	severity telemetry.Severity
+	key      string
+}
+
+type duplicates struct {
+	start      time.Time
+	text       string
+	suppressed int
+}
+
+type bucket struct {
+	rate    Rate
+	tokens  float64
+	updated time.Time
+	dropped int
+}
+
+type rateLimitingTraceListener struct {
+	inner      *telemetry.TraceListener
+	window     time.Duration
+	key        KeyFunc
+	clock      telemetry.Clock
+	mutex      sync.Mutex
+	duplicates map[duplicateKey]*duplicates
+	buckets    map[telemetry.Severity]*bucket
+	lastSweep  time.Time
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewRateLimitingTraceListener creates a trace listener which limits the messages and exceptions passed to the inner listener. Identical
+// messages within the window are collapsed into the first, and a summary such as "Suppressed 4,213 duplicates of: connection refused" is
+// written when the window closes. Messages of each severity are then limited by the token bucket Rates. Other telemetry is not limited.
+func NewRateLimitingTraceListener(listener telemetry.TraceListener, limits Limits, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	settings := telemetry.NewListenerOptions(options...)
+
+	if limits.Window <= 0 {
+		limits.Window = DefaultWindow
+	}
+
+	if limits.Key == nil {
+		limits.Key = ByText
+	}
+
+	traceListener := &rateLimitingTraceListener{
+		inner:      &listener,
+		window:     limits.Window,
+		key:        limits.Key,
+		clock:      settings.Clock,
+		duplicates: make(map[duplicateKey]*duplicates),
+		buckets:    make(map[telemetry.Severity]*bucket),
+		lastSweep:  settings.Clock.Now(),
+		stop:       make(chan struct{}),
+	}
+
+	for severity, rate := range limits.Rates {
+		traceListener.buckets[severity] = &bucket{rate: rate, tokens: float64(rate.Burst), updated: traceListener.lastSweep}
+	}
+
+	go traceListener.sweepLoop()
+
+	return traceListener
+}
+
+func (rltl *rateLimitingTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	rltl.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
+
+func (rltl *rateLimitingTraceListener) TraceException(err error) {
+	rltl.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
+}
+
+func (rltl *rateLimitingTraceListener) TracePanic(rethrow bool) {
+	(*rltl.inner).TracePanic(rethrow)
+}
+
+func (rltl *rateLimitingTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return (*rltl.inner).TrackAvailability(name)
+}
+
+func (rltl *rateLimitingTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return (*rltl.inner).TrackRequest(method, uri)
+}
+
+func (rltl *rateLimitingTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return (*rltl.inner).TrackDependency(name, dependencyType, target)
+}
+
+func (rltl *rateLimitingTraceListener) TraceMetric(name string, value float64) {
+	(*rltl.inner).TraceMetric(name, value)
+}
+
+func (rltl *rateLimitingTraceListener) TraceEvent(name string) {
+	(*rltl.inner).TraceEvent(name)
+}
+
+func (rltl *rateLimitingTraceListener) TraceItem(item *telemetry.Item) {
+	if item.Kind != telemetry.MessageItem && item.Kind != telemetry.ExceptionItem {
+		telemetry.TraceItemTo(*rltl.inner, item)
+		return
+	}
+
+	allowed, summaries := rltl.allow(item)
+
+	rltl.write(summaries)
+
+	if allowed {
+		telemetry.TraceItemTo(*rltl.inner, item)
+	}
+}
+
+func (rltl *rateLimitingTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	return telemetry.TrackItemTo(*rltl.inner, item)
+}
+
+// Flush writes the summaries of any windows which have closed, then flushes the inner listener
+func (rltl *rateLimitingTraceListener) Flush() {
+	rltl.mutex.Lock()
+	summaries := rltl.sweep(rltl.clock.Now(), false)
+	rltl.mutex.Unlock()
+
+	rltl.write(summaries)
+	(*rltl.inner).Flush()
+}
+
+// Close writes the summaries of every window, whether or not it has closed, then closes the inner listener
+func (rltl *rateLimitingTraceListener) Close() {
+	rltl.stopOnce.Do(func() { close(rltl.stop) })
+
+	rltl.mutex.Lock()
+	summaries := rltl.sweep(rltl.clock.Now(), true)
+	rltl.mutex.Unlock()
+
+	rltl.write(summaries)
+	(*rltl.inner).Close()
+}
+
+// allow decides whether the item is passed on, returning any summaries which are due
+func (rltl *rateLimitingTraceListener) allow(item *telemetry.Item) (bool, []*telemetry.Item) {
+	now := rltl.clock.Now()
+	severity := severityOf(item)
+	key := duplicateKey{kind: item.Kind, severity: severity, key: rltl.key(item)}
+
+	rltl.mutex.Lock()
+	defer rltl.mutex.Unlock()
+
+	var summaries []*telemetry.Item
+
+	if now.Sub(rltl.lastSweep) >= rltl.window {
+		summaries = rltl.sweep(now, false)
+	}
+
+	if entry, ok := rltl.duplicates[key]; ok {
+		if now.Sub(entry.start) < rltl.window {
+			entry.suppressed++
+			return false, summaries
+		}
+
+		if entry.suppressed > 0 {
+			summaries = append(summaries, duplicateSummary(severity, entry))
+		}
+
+		delete(rltl.duplicates, key)
+	}
+
+	if b, ok := rltl.buckets[severity]; ok && !b.take(now) {
+		return false, summaries
+	}
+
+	// Only a message which is passed on opens a window, so that its duplicates are not suppressed after it was itself rate limited
+	rltl.duplicates[key] = &duplicates{start: now, text: text(item)}
+
+	return true, summaries
+}
+
+// sweep removes the duplicate windows which have closed, or all windows if forced, and returns the summaries of what was suppressed.
+// It must be called with the mutex held.
+func (rltl *rateLimitingTraceListener) sweep(now time.Time, force bool) []*telemetry.Item {
+	summaries := make([]*telemetry.Item, 0)
+
+	for key, entry := range rltl.duplicates {
+		if force || now.Sub(entry.start) >= rltl.window {
+			if entry.suppressed > 0 {
+				summaries = append(summaries, duplicateSummary(key.severity, entry))
+			}
+
+			delete(rltl.duplicates, key)
+		}
+	}
+
+	for severity, b := range rltl.buckets {
+		if b.dropped > 0 {
+			summaries = append(summaries, &telemetry.Item{
+				Kind:     telemetry.MessageItem,
+				Severity: telemetry.Warning,
+				Message:  fmt.Sprintf("Rate limited %v %v messages", formatCount(b.dropped), severity.ToString()),
+			})
+			b.dropped = 0
+		}
+	}
+
+	rltl.lastSweep = now
+
+	return summaries
+}
+
+// sweepLoop writes the summaries of the windows as they close, flushing the inner listener only when there are summaries to write
+func (rltl *rateLimitingTraceListener) sweepLoop() {
+	ticker := time.NewTicker(rltl.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rltl.mutex.Lock()
+			summaries := rltl.sweep(rltl.clock.Now(), false)
+			rltl.mutex.Unlock()
+
+			if len(summaries) > 0 {
+				rltl.write(summaries)
+				(*rltl.inner).Flush()
+			}
+
+		case <-rltl.stop:
+			return
+		}
+	}
+}
+
+func (rltl *rateLimitingTraceListener) write(summaries []*telemetry.Item) {
+	for _, summary := range summaries {
+		telemetry.TraceItemTo(*rltl.inner, summary)
+	}
+}
+
+// take removes a token from the bucket if one is available, counting the message as dropped otherwise
+func (b *bucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.updated).Seconds() * b.rate.PerSecond
+	b.updated = now
+
+	if b.tokens > float64(b.rate.Burst) {
+		b.tokens = float64(b.rate.Burst)
+	}
+
+	if b.tokens < 1 {
+		b.dropped++
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func duplicateSummary(severity telemetry.Severity, entry *duplicates) *telemetry.Item {
+	return &telemetry.Item{
+		Kind:     telemetry.MessageItem,
+		Severity: severity,
+		Message:  fmt.Sprintf("Suppressed %v duplicates of: %v", formatCount(entry.suppressed), entry.text),
+	}
+}
+
+func severityOf(item *telemetry.Item) telemetry.Severity {
+	if item.Kind == telemetry.ExceptionItem {
+		return telemetry.Error
+	}
+
+	return item.Severity
+}
+
+// formatCount formats the count with thousands separators, e.g. 4,213
+func formatCount(count int) string {
+	digits := strconv.Itoa(count)
+
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+
+	return digits
+}
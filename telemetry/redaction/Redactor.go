@@ -0,0 +1,75 @@
+package redaction
+
+import (
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// DefaultMask is the text which replaces sensitive values
+const DefaultMask string = "[REDACTED]"
+
+// Redactor masks sensitive values in telemetry. It is a telemetry.Processor, so adding it with telemetry.AddProcessor masks every text of
+// an item before any listener sees it, including the properties and the details set on duration traces, such as URLs and data. Only the
+// identifiers which correlate items are left as they are.
+type Redactor struct {
+	detectors []Detector
+	mask      string
+}
+
+// NewRedactor creates a Redactor which uses the detectors in order, or the DefaultDetectors if none are supplied
+func NewRedactor(detectors ...Detector) *Redactor {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors()
+	}
+
+	return &Redactor{detectors: detectors, mask: DefaultMask}
+}
+
+// WithMask sets the text which replaces sensitive values
+func (r *Redactor) WithMask(mask string) *Redactor {
+	r.mask = mask
+
+	return r
+}
+
+// Redact returns the text with every sensitive value masked
+func (r *Redactor) Redact(text string) string {
+	for _, detector := range r.detectors {
+		text = detector.redact(text, r.mask)
+	}
+
+	return text
+}
+
+// Process masks the sensitive values in the item
+func (r *Redactor) Process(item *telemetry.Item) []*telemetry.Item {
+	for _, field := range []*string{&item.Message, &item.Name, &item.Method, &item.URI, &item.DependencyType, &item.Target, &item.Source,
+		&item.URL, &item.Data, &item.RunLocation} {
+		*field = r.Redact(*field)
+	}
+
+	if item.Err != nil {
+		if message := r.Redact(item.Err.Error()); message != item.Err.Error() {
+			item.Err = &redactedError{message: message, err: item.Err}
+		}
+	}
+
+	for k, v := range item.Properties {
+		item.Properties[k] = r.Redact(v)
+	}
+
+	return []*telemetry.Item{item}
+}
+
+// redactedError replaces the text of an error which contains sensitive values, while still wrapping the original
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (re *redactedError) Error() string {
+	return re.message
+}
+
+func (re *redactedError) Unwrap() error {
+	return re.err
+}
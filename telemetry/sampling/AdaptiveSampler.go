@@ -0,0 +1,90 @@
+package sampling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	// MinPercentage is the lowest percentage that the adaptive sampler will reduce to
+	MinPercentage float64 = 0.1
+
+	evaluationInterval time.Duration = time.Second
+	smoothing          float64       = 0.5
+)
+
+// AdaptiveSampler is a Sampler which adjusts the percentage of items kept so that roughly the target number of items per second pass
+// through. The rate of incoming items is re-evaluated every second, smoothed over previous seconds to avoid oscillating.
+type AdaptiveSampler struct {
+	mutex       sync.Mutex
+	target      float64
+	clock       telemetry.Clock
+	windowStart time.Time
+	count       int
+	averageRate float64
+	percentage  float64
+}
+
+// NewAdaptiveSampler creates an AdaptiveSampler which targets the number of items per second. It keeps everything until the first evaluation.
+// The incoming rate is measured by the Clock in the options (the system clock by default).
+func NewAdaptiveSampler(targetItemsPerSecond float64, options ...telemetry.ListenerOption) *AdaptiveSampler {
+	settings := telemetry.NewListenerOptions(options...)
+
+	return &AdaptiveSampler{
+		target:      targetItemsPerSecond,
+		clock:       settings.Clock,
+		averageRate: -1,
+		percentage:  100,
+	}
+}
+
+// Rate counts the item towards the incoming rate and returns the current percentage
+func (as *AdaptiveSampler) Rate(item *telemetry.Item) float64 {
+	now := as.clock.Now()
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if as.windowStart.IsZero() {
+		as.windowStart = now
+	}
+
+	if elapsed := now.Sub(as.windowStart); elapsed >= evaluationInterval {
+		as.evaluate(float64(as.count) / elapsed.Seconds())
+		as.windowStart = now
+		as.count = 0
+	}
+
+	as.count++
+
+	return as.percentage
+}
+
+// Percentage returns the percentage of items currently being kept
+func (as *AdaptiveSampler) Percentage() float64 {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	return as.percentage
+}
+
+func (as *AdaptiveSampler) evaluate(rate float64) {
+	if as.averageRate < 0 {
+		as.averageRate = rate
+	} else {
+		as.averageRate = smoothing*rate + (1-smoothing)*as.averageRate
+	}
+
+	if as.averageRate <= as.target {
+		as.percentage = 100
+		return
+	}
+
+	as.percentage = as.target / as.averageRate * 100
+
+	if as.percentage < MinPercentage {
+		as.percentage = MinPercentage
+	}
+}
@@ -0,0 +1,88 @@
+package sampling
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// Sampler decides how much telemetry is kept by a sampling trace listener
+type Sampler interface {
+	// Rate returns the percentage (0-100) of items like the supplied item which should be kept
+	Rate(item *telemetry.Item) float64
+}
+
+type fixedSampler struct {
+	percentage float64
+}
+
+// FixedRate creates a Sampler which keeps the same percentage (0-100) of every kind of item
+func FixedRate(percentage float64) Sampler {
+	return &fixedSampler{percentage: clampPercentage(percentage)}
+}
+
+func (fs *fixedSampler) Rate(item *telemetry.Item) float64 {
+	return fs.percentage
+}
+
+type perKindSampler struct {
+	samplers map[telemetry.ItemKind]Sampler
+	fallback Sampler
+}
+
+// PerKind creates a Sampler which uses a different Sampler for each kind of item, e.g. keeping every request but only some of the dependencies.
+// Kinds which are not in the map use the fallback, or are all kept if the fallback is nil.
+func PerKind(samplers map[telemetry.ItemKind]Sampler, fallback Sampler) Sampler {
+	if fallback == nil {
+		fallback = FixedRate(100)
+	}
+
+	return &perKindSampler{samplers: samplers, fallback: fallback}
+}
+
+func (pks *perKindSampler) Rate(item *telemetry.Item) float64 {
+	if sampler, ok := pks.samplers[item.Kind]; ok && sampler != nil {
+		return sampler.Rate(item)
+	}
+
+	return pks.fallback.Rate(item)
+}
+
+// isSampledIn decides whether the item is kept at the percentage. Items with an operation ID are scored by a hash of it, so every item in
+// the operation is kept or dropped together when they are sampled at the same percentage; otherwise the decision is random.
+func isSampledIn(item *telemetry.Item, percentage float64) bool {
+	if percentage >= 100 {
+		return true
+	}
+
+	if percentage <= 0 {
+		return false
+	}
+
+	return score(item.OperationID) < percentage
+}
+
+// score maps the operation ID to a value in [0, 100)
+func score(operationID string) float64 {
+	if operationID == "" {
+		return rand.Float64() * 100
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(operationID))
+
+	return float64(hash.Sum32()) / (float64(^uint32(0)) + 1) * 100
+}
+
+func clampPercentage(percentage float64) float64 {
+	if percentage < 0 {
+		return 0
+	}
+
+	if percentage > 100 {
+		return 100
+	}
+
+	return percentage
+}
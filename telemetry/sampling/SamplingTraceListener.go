@@ -0,0 +1,91 @@
+package sampling
+
+import (
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+type samplingTraceListener struct {
+	inner   *telemetry.TraceListener
+	sampler Sampler
+}
+
+// NewSamplingTraceListener creates a trace listener which samples the telemetry before passing it to the inner listener. Items which are kept
+// carry the percentage they were sampled at, which listeners such as ApplicationInsights use to re-weight counts. Panics are never sampled.
+func NewSamplingTraceListener(listener telemetry.TraceListener, sampler Sampler) telemetry.TraceListener {
+	traceListener := samplingTraceListener{inner: &listener, sampler: sampler}
+
+	return &traceListener
+}
+
+func (stl *samplingTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
+
+func (stl *samplingTraceListener) TraceException(err error) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
+}
+
+func (stl *samplingTraceListener) TracePanic(rethrow bool) {
+	(*stl.inner).TracePanic(rethrow)
+}
+
+func (stl *samplingTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.AvailabilityItem, Name: name})
+}
+
+func (stl *samplingTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: method, URI: uri})
+}
+
+func (stl *samplingTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
+
+func (stl *samplingTraceListener) TraceMetric(name string, value float64) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MetricItem, Name: name, Value: value})
+}
+
+func (stl *samplingTraceListener) TraceEvent(name string) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: name})
+}
+
+func (stl *samplingTraceListener) TraceItem(item *telemetry.Item) {
+	if sampled, ok := stl.sample(item); ok {
+		telemetry.TraceItemTo(*stl.inner, sampled)
+	}
+}
+
+func (stl *samplingTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	if sampled, ok := stl.sample(item); ok {
+		return telemetry.TrackItemTo(*stl.inner, sampled)
+	}
+
+	return telemetry.NoopDurationTrace()
+}
+
+func (stl *samplingTraceListener) Flush() {
+	(*stl.inner).Flush()
+}
+
+func (stl *samplingTraceListener) Close() {
+	(*stl.inner).Close()
+}
+
+// sample decides whether the item is kept, returning a copy which carries the combined sample rate if it is
+func (stl *samplingTraceListener) sample(item *telemetry.Item) (*telemetry.Item, bool) {
+	percentage := clampPercentage(stl.sampler.Rate(item))
+
+	if !isSampledIn(item, percentage) {
+		return nil, false
+	}
+
+	sampled := *item
+
+	if item.SampleRate > 0 && item.SampleRate < 100 {
+		sampled.SampleRate = item.SampleRate * percentage / 100
+	} else {
+		sampled.SampleRate = percentage
+	}
+
+	return &sampled, true
+}
@@ -0,0 +1,214 @@
+package sampling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+func TestFixedRateSamplingKeepsTheProportion(t *testing.T) {
+	t.Log("Given a listener sampling at a fixed 25%")
+	{
+		recorder := telemetrytest.NewRecorder()
+		tl := NewSamplingTraceListener(recorder, FixedRate(25))
+
+		t.Log("\tWhen 10000 messages are traced in separate operations")
+		{
+			for i := 0; i < 10000; i++ {
+				telemetry.TraceItemTo(tl, &telemetry.Item{Kind: telemetry.MessageItem, OperationID: fmt.Sprintf("op-%v", i), Message: "Test"})
+			}
+
+			messages := recorder.Messages()
+
+			if len(messages) > 2250 && len(messages) < 2750 {
+				t.Logf("\t\t[%v] Roughly a quarter of the messages are kept.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Roughly a quarter of the messages are kept. Actual: %v", ballotX, len(messages))
+			}
+
+			if len(messages) > 0 && messages[0].SampleRate == 25 {
+				t.Logf("\t\t[%v] The kept messages carry the sample rate.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The kept messages carry the sample rate.", ballotX)
+			}
+		}
+	}
+
+	t.Log("Given listeners sampling at 100% and 0%")
+	{
+		all := telemetrytest.NewRecorder()
+		none := telemetrytest.NewRecorder()
+		allListener := NewSamplingTraceListener(all, FixedRate(100))
+		noneListener := NewSamplingTraceListener(none, FixedRate(0))
+
+		t.Log("\tWhen 100 metrics are traced without an operation")
+		{
+			for i := 0; i < 100; i++ {
+				allListener.TraceMetric("Test", float64(i))
+				noneListener.TraceMetric("Test", float64(i))
+			}
+
+			if len(all.Metrics()) == 100 && len(none.Metrics()) == 0 {
+				t.Logf("\t\t[%v] Everything or nothing is kept.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Everything or nothing is kept. Actual: %v and %v", ballotX, len(all.Metrics()), len(none.Metrics()))
+			}
+		}
+	}
+}
+
+func TestSamplingIsConsistentPerOperation(t *testing.T) {
+	t.Log("Given a listener sampling at 50%")
+	{
+		recorder := telemetrytest.NewRecorder()
+		tl := NewSamplingTraceListener(recorder, FixedRate(50))
+
+		t.Log("\tWhen 200 operations each track a request and two dependencies")
+		{
+			for i := 0; i < 200; i++ {
+				operationID := telemetry.NewOperationID()
+
+				request := telemetry.TrackItemTo(tl, &telemetry.Item{Kind: telemetry.RequestItem, OperationID: operationID, Method: "GET", URI: "/"})
+				for j := 0; j < 2; j++ {
+					dependency := telemetry.TrackItemTo(tl, &telemetry.Item{Kind: telemetry.DependencyItem, OperationID: operationID, Name: "db"})
+					(*dependency).Complete()
+					(*dependency).Done()
+				}
+
+				(*request).Complete()
+				(*request).Done()
+			}
+
+			dependencies := make(map[string]int)
+			for _, dependency := range recorder.Dependencies() {
+				dependencies[dependency.OperationID]++
+			}
+
+			consistent := len(dependencies) == len(recorder.Requests())
+			for _, request := range recorder.Requests() {
+				consistent = consistent && dependencies[request.OperationID] == 2
+			}
+
+			if consistent && len(recorder.Requests()) > 0 && len(recorder.Requests()) < 200 {
+				t.Logf("\t\t[%v] Each request and its dependencies are kept or dropped together.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Each request and its dependencies are kept or dropped together. Requests: %v, Operations with dependencies: %v",
+					ballotX, len(recorder.Requests()), len(dependencies))
+			}
+		}
+	}
+}
+
+func TestPerKindSamplingUsesTheRateForEachKind(t *testing.T) {
+	t.Log("Given a listener keeping every request, no dependencies and half of everything else")
+	{
+		recorder := telemetrytest.NewRecorder()
+		sampler := PerKind(map[telemetry.ItemKind]Sampler{
+			telemetry.RequestItem:    FixedRate(100),
+			telemetry.DependencyItem: FixedRate(0),
+		}, FixedRate(50))
+		tl := NewSamplingTraceListener(recorder, sampler)
+
+		t.Log("\tWhen requests, dependencies and events are traced")
+		{
+			for i := 0; i < 100; i++ {
+				(*tl.TrackRequest("GET", "/")).Done()
+				(*tl.TrackDependency("db", "SQL", "server")).Done()
+				tl.TraceEvent("Test")
+			}
+
+			if len(recorder.Requests()) == 100 {
+				t.Logf("\t\t[%v] Every request is kept.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Every request is kept. Actual: %v", ballotX, len(recorder.Requests()))
+			}
+
+			if len(recorder.Dependencies()) == 0 {
+				t.Logf("\t\t[%v] Every dependency is dropped.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Every dependency is dropped. Actual: %v", ballotX, len(recorder.Dependencies()))
+			}
+
+			if events := len(recorder.Events()); events > 0 && events < 100 && recorder.Events()[0].SampleRate == 50 {
+				t.Logf("\t\t[%v] Events are sampled at the fallback rate.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Events are sampled at the fallback rate. Actual: %v", ballotX, events)
+			}
+		}
+	}
+}
+
+func TestSampleRatesOfNestedSamplersAreCombined(t *testing.T) {
+	t.Log("Given a listener sampling at 50% inside a listener sampling at 50%")
+	{
+		recorder := telemetrytest.NewRecorder()
+		tl := NewSamplingTraceListener(NewSamplingTraceListener(recorder, FixedRate(50)), FixedRate(50))
+
+		t.Log("\tWhen messages are traced")
+		{
+			for i := 0; i < 100; i++ {
+				tl.TraceMessage("Test", telemetry.Information)
+			}
+
+			messages := recorder.Messages()
+
+			if len(messages) > 0 && messages[0].SampleRate == 25 {
+				t.Logf("\t\t[%v] The kept messages carry the combined rate.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The kept messages carry the combined rate.", ballotX)
+			}
+		}
+	}
+}
+
+func TestAdaptiveSamplingTargetsTheItemRate(t *testing.T) {
+	t.Log("Given an adaptive sampler targeting 10 items per second")
+	{
+		clock := telemetrytest.NewManualClock(time.Date(2020, time.March, 4, 10, 0, 0, 0, time.UTC))
+		sampler := NewAdaptiveSampler(10, telemetry.WithClock(clock))
+		item := &telemetry.Item{Kind: telemetry.EventItem, Name: "Test"}
+
+		t.Log("\tWhen 1000 items arrive in the first second")
+		{
+			for i := 0; i < 1000; i++ {
+				sampler.Rate(item)
+			}
+
+			if sampler.Percentage() == 100 {
+				t.Logf("\t\t[%v] Everything is kept until the first evaluation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Everything is kept until the first evaluation. Actual: %v", ballotX, sampler.Percentage())
+			}
+
+			clock.Advance(time.Second)
+
+			if rate := sampler.Rate(item); rate == 1 {
+				t.Logf("\t\t[%v] The percentage is reduced to keep 10 items per second.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The percentage is reduced to keep 10 items per second. Actual: %v", ballotX, rate)
+			}
+		}
+
+		t.Log("\tWhen the load drops to 1 item per second")
+		{
+			for i := 0; i < 10; i++ {
+				clock.Advance(time.Second)
+				sampler.Rate(item)
+			}
+
+			if sampler.Percentage() == 100 {
+				t.Logf("\t\t[%v] The percentage recovers to keep everything.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The percentage recovers to keep everything. Actual: %v", ballotX, sampler.Percentage())
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package slogbridge
+
+import (
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+type slogDurationTrace struct {
+	telemetry.TraceState
+	traceListener *slogTraceListener
+	statusCode    string
+	success       bool
+	reported      bool
+	startTime     time.Time
+	message       string
+	attrs         []slog.Attr
+	details       telemetry.Item
+	item          telemetry.Item
+}
+
+// Complete indicates a successful completion of the measured duration activity
+func (sdt *slogDurationTrace) Complete() {
+	sdt.Update("Complete", func() {
+		sdt.reported = true
+		sdt.success = true
+		sdt.statusCode = "OK"
+	})
+}
+
+// Fail indicates an unsuccessful completion of the measured duration activity
+func (sdt *slogDurationTrace) Fail(statusCode string) {
+	sdt.Update("Fail", func() {
+		sdt.reported = true
+		sdt.success = false
+		sdt.statusCode = statusCode
+	})
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (sdt *slogDurationTrace) CompleteWithStatus(statusCode string) {
+	sdt.Update("CompleteWithStatus", func() {
+		sdt.reported = true
+		sdt.success = true
+		sdt.statusCode = statusCode
+	})
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code
+func (sdt *slogDurationTrace) SetStatusCode(code int) {
+	sdt.Update("SetStatusCode", func() {
+		sdt.reported = true
+		sdt.success = telemetry.IsSuccessStatusCode(code)
+		sdt.statusCode = strconv.Itoa(code)
+	})
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity, whose "parentId" is the "id" of this trace
+func (sdt *slogDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var child *telemetry.Item
+
+	started := sdt.Update("StartChild", func() {
+		if sdt.item.ID == "" {
+			sdt.item.ID = telemetry.NewSpanID()
+			sdt.attrs = append(sdt.attrs, slog.String("id", sdt.item.ID))
+		}
+
+		child = telemetry.NewChildItem(&sdt.item, name)
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return sdt.traceListener.TrackItem(child)
+}
+
+// SetProperty sets a custom named value of the measured duration activity
+func (sdt *slogDurationTrace) SetProperty(name string, value string) {
+	sdt.Update("SetProperty", func() { sdt.details.SetProperty(name, value) })
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+func (sdt *slogDurationTrace) SetMeasurement(name string, value float64) {
+	sdt.Update("SetMeasurement", func() { sdt.details.SetMeasurement(name, value) })
+}
+
+// SetSource sets the source of a request
+func (sdt *slogDurationTrace) SetSource(source string) {
+	sdt.Update("SetSource", func() { sdt.details.Source = source })
+}
+
+// SetURL sets the full URL of a request
+func (sdt *slogDurationTrace) SetURL(url string) {
+	sdt.Update("SetURL", func() { sdt.details.URL = url })
+}
+
+// SetData sets the command of a dependency call
+func (sdt *slogDurationTrace) SetData(data string) {
+	sdt.Update("SetData", func() { sdt.details.Data = data })
+}
+
+// SetRunLocation sets where an availability test ran
+func (sdt *slogDurationTrace) SetRunLocation(location string) {
+	sdt.Update("SetRunLocation", func() { sdt.details.RunLocation = location })
+}
+
+// Done indicates that the trace is complete and should be committed to the telemetry source
+func (sdt *slogDurationTrace) Done() {
+	sdt.DoneAt(sdt.traceListener.clock.Now())
+}
+
+// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source. A trace which was neither
+// completed nor failed is logged as a warning. A trace is only logged once.
+func (sdt *slogDurationTrace) DoneAt(end time.Time) {
+	if !sdt.Finish(end) {
+		return
+	}
+
+	duration := end.Sub(sdt.startTime)
+	attrs := append(append([]slog.Attr{}, sdt.attrs...), detailAttrs(&sdt.details)...)
+	attrs = append(attrs,
+		slog.Duration("duration", duration),
+		slog.Bool("success", sdt.success),
+		slog.String("status", sdt.statusCode))
+
+	if !sdt.reported {
+		sdt.traceListener.writeAt(end, slog.LevelWarn, sdt.message+" incomplete: done without Complete or Fail", attrs...)
+	} else if sdt.success {
+		sdt.traceListener.writeAt(end, slog.LevelInfo, sdt.message, attrs...)
+	} else {
+		sdt.traceListener.writeAt(end, slog.LevelError, sdt.message, attrs...)
+	}
+}
+
+// detailAttrs converts the kind-specific details, properties and measurements set on a trace to attributes, the properties and measurements
+// in name order
+func detailAttrs(details *telemetry.Item) []slog.Attr {
+	var attrs []slog.Attr
+
+	for _, detail := range []slog.Attr{
+		slog.String("source", details.Source),
+		slog.String("url", details.URL),
+		slog.String("data", details.Data),
+		slog.String("runLocation", details.RunLocation),
+	} {
+		if detail.Value.String() != "" {
+			attrs = append(attrs, detail)
+		}
+	}
+
+	attrs = withProperties(attrs, details.Properties)
+
+	names := make([]string, 0, len(details.Measurements))
+	for name := range details.Measurements {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		attrs = append(attrs, slog.Float64(name, details.Measurements[name]))
+	}
+
+	return attrs
+}
@@ -0,0 +1,201 @@
+package slogbridge
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// HandlerOptions configures the slog.Handler created by NewHandler
+type HandlerOptions struct {
+	// Level is the minimum level of the records which are forwarded. Defaults to slog.LevelDebug, leaving the trace listeners to
+	// limit output by their own logging level.
+	Level slog.Leveler
+}
+
+// traceTarget is the destination of the items of the records handled by a traceHandler
+type traceTarget func(item *telemetry.Item)
+
+// property is a single flattened attribute
+type property struct {
+	key   string
+	value string
+}
+
+type traceHandler struct {
+	target     traceTarget
+	structured bool
+	level      slog.Leveler
+	group      string
+	properties []property
+	errs       []error
+}
+
+// NewHandler creates a slog.Handler which forwards records to the supplied trace listener, or to all the listeners registered with the
+// telemetry package if the listener is nil. Each record is traced as a message item at the time of the record, in the operation carried by
+// its context, with its attributes as properties and groups flattened into dotted keys. A listener which does not implement
+// telemetry.ItemTraceListener cannot record properties, so they are written as key=value pairs after its message instead. Attributes
+// holding an error are traced as exceptions.
+func NewHandler(listener *telemetry.TraceListener, options *HandlerOptions) slog.Handler {
+	var target traceTarget = telemetry.TraceItem
+	structured := true
+
+	if listener != nil {
+		tl := *listener
+		target = func(item *telemetry.Item) { telemetry.TraceItemTo(tl, item) }
+		_, structured = tl.(telemetry.ItemTraceListener)
+	}
+
+	var level slog.Leveler = slog.LevelDebug
+	if options != nil && options.Level != nil {
+		level = options.Level
+	}
+
+	return &traceHandler{target: target, structured: structured, level: level}
+}
+
+func (th *traceHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= th.level.Level()
+}
+
+func (th *traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	properties := append([]property{}, th.properties...)
+	errs := append([]error{}, th.errs...)
+
+	record.Attrs(func(attr slog.Attr) bool {
+		properties, errs = collect(properties, errs, th.group, attr)
+		return true
+	})
+
+	operationID := telemetry.OperationIDFromContext(ctx)
+	item := &telemetry.Item{Kind: telemetry.MessageItem, OperationID: operationID, Timestamp: record.Time, Message: record.Message,
+		Severity: toSeverity(record.Level)}
+
+	if th.structured {
+		for _, p := range properties {
+			item.SetProperty(p.key, p.value)
+		}
+	} else {
+		item.Message += formatProperties(properties)
+	}
+
+	th.target(item)
+
+	for _, err := range errs {
+		th.target(&telemetry.Item{Kind: telemetry.ExceptionItem, OperationID: operationID, Timestamp: record.Time, Err: err})
+	}
+
+	return nil
+}
+
+func (th *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *th
+	handler.properties = append([]property{}, th.properties...)
+	handler.errs = append([]error{}, th.errs...)
+
+	for _, attr := range attrs {
+		handler.properties, handler.errs = collect(handler.properties, handler.errs, th.group, attr)
+	}
+
+	return &handler
+}
+
+func (th *traceHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return th
+	}
+
+	handler := *th
+	handler.group = th.group + name + "."
+
+	return &handler
+}
+
+// collect flattens the attribute into properties, separating out any errors
+func collect(properties []property, errs []error, group string, attr slog.Attr) ([]property, []error) {
+	attr.Value = attr.Value.Resolve()
+
+	if attr.Equal(slog.Attr{}) {
+		return properties, errs
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		prefix := group
+		if attr.Key != "" {
+			prefix = group + attr.Key + "."
+		}
+
+		for _, member := range attr.Value.Group() {
+			properties, errs = collect(properties, errs, prefix, member)
+		}
+
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			errs = append(errs, err)
+		} else {
+			properties = append(properties, property{key: group + attr.Key, value: attr.Value.String()})
+		}
+
+	default:
+		properties = append(properties, property{key: group + attr.Key, value: attr.Value.String()})
+	}
+
+	return properties, errs
+}
+
+// formatProperties renders the properties as space separated key=value pairs, quoting values where needed
+func formatProperties(properties []property) string {
+	var builder strings.Builder
+
+	for _, p := range properties {
+		value := p.value
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+
+		builder.WriteString(" ")
+		builder.WriteString(p.key)
+		builder.WriteString("=")
+		builder.WriteString(value)
+	}
+
+	return builder.String()
+}
+
+// toSeverity converts the slog.Level to the nearest Severity
+func toSeverity(level slog.Level) telemetry.Severity {
+	switch {
+	case level < slog.LevelInfo:
+		return telemetry.Verbose
+	case level < slog.LevelWarn:
+		return telemetry.Information
+	case level < slog.LevelError:
+		return telemetry.Warning
+	case level < slog.LevelError+4:
+		return telemetry.Error
+	default:
+		return telemetry.Critical
+	}
+}
+
+// toLevel converts the Severity to the equivalent slog.Level
+func toLevel(severity telemetry.Severity) slog.Level {
+	switch severity {
+	case telemetry.Verbose:
+		return slog.LevelDebug
+	case telemetry.Information:
+		return slog.LevelInfo
+	case telemetry.Warning:
+		return slog.LevelWarn
+	case telemetry.Error:
+		return slog.LevelError
+	case telemetry.Critical:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelInfo
+	}
+}
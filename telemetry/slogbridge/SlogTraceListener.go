@@ -0,0 +1,166 @@
+package slogbridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+type slogTraceListener struct {
+	handler slog.Handler
+	clock   telemetry.Clock
+}
+
+// NewSlogTraceListener creates a trace listener which writes records to the supplied slog.Handler, e.g. slog.Default().Handler(). Output is
+// limited by the handler's own level. The handler must not forward back into the telemetry package, or each message would loop.
+func NewSlogTraceListener(handler slog.Handler, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	settings := telemetry.NewListenerOptions(options...)
+	traceListener := slogTraceListener{handler: handler, clock: settings.Clock}
+
+	return &traceListener
+}
+
+func (stl *slogTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
+
+func (stl *slogTraceListener) TraceException(err error) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
+}
+
+func (stl *slogTraceListener) TracePanic(rethrow bool) {
+	if r := recover(); r != nil {
+		stl.write(toLevel(telemetry.Critical), fmt.Sprint(r), slog.Any("panic", r))
+
+		if rethrow {
+			panic(r)
+		}
+	}
+}
+
+func (stl *slogTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.AvailabilityItem, Name: name})
+}
+
+func (stl *slogTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: method, URI: uri})
+}
+
+func (stl *slogTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
+
+func (stl *slogTraceListener) TraceMetric(name string, value float64) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MetricItem, Name: name, Value: value})
+}
+
+func (stl *slogTraceListener) TraceEvent(name string) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: name})
+}
+
+// TraceItem writes the item, with its properties as string attributes
+func (stl *slogTraceListener) TraceItem(item *telemetry.Item) {
+	timestamp := item.Time(stl.clock)
+
+	switch item.Kind {
+	case telemetry.MessageItem:
+		stl.writeAt(timestamp, toLevel(item.Severity), item.Message, withProperties(nil, item.Properties)...)
+	case telemetry.ExceptionItem:
+		stl.writeAt(timestamp, slog.LevelError, item.Err.Error(), withProperties([]slog.Attr{slog.Any("error", item.Err)}, item.Properties)...)
+	case telemetry.MetricItem:
+		attrs := []slog.Attr{slog.String("name", item.Name), slog.Float64("value", item.Value)}
+		stl.writeAt(timestamp, slog.LevelInfo, "metric", withProperties(attrs, item.Properties)...)
+	case telemetry.EventItem:
+		stl.writeAt(timestamp, slog.LevelDebug, "event", withProperties([]slog.Attr{slog.String("name", item.Name)}, item.Properties)...)
+	}
+}
+
+// TrackItem creates a tracking of the item, with its properties as string attributes. The "id" and "parentId" attributes relate the traces
+// started within another to it.
+func (stl *slogTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	var message string
+	var attrs []slog.Attr
+
+	switch item.Kind {
+	case telemetry.AvailabilityItem:
+		message, attrs = "availability", []slog.Attr{slog.String("name", item.Name)}
+	case telemetry.RequestItem:
+		message, attrs = "request", []slog.Attr{slog.String("method", item.Method), slog.String("uri", item.URI)}
+	case telemetry.DependencyItem:
+		message, attrs = "dependency", []slog.Attr{slog.String("name", item.Name), slog.String("type", item.DependencyType), slog.String("target", item.Target)}
+	default:
+		return telemetry.NoopDurationTrace()
+	}
+
+	if item.ID != "" {
+		attrs = append(attrs, slog.String("id", item.ID))
+	}
+
+	if item.ParentID != "" {
+		attrs = append(attrs, slog.String("parentId", item.ParentID))
+	}
+
+	durationTrace := stl.newDurationTrace(item, message, item.Time(stl.clock), withProperties(attrs, item.Properties)...)
+
+	return &durationTrace
+}
+
+func (stl *slogTraceListener) Flush() {
+	// Unused
+}
+
+func (stl *slogTraceListener) Close() {
+	// Unused
+}
+
+func (stl *slogTraceListener) newDurationTrace(item *telemetry.Item, message string, startTime time.Time, attrs ...slog.Attr) telemetry.DurationTrace {
+	return &slogDurationTrace{
+		TraceState:    telemetry.NewTraceState(item.Describe(), stl.clock, startTime),
+		traceListener: stl,
+		item:          *item.Clone(),
+		message:       message,
+		attrs:         attrs,
+		startTime:     startTime,
+		statusCode:    "Incomplete",
+		success:       false,
+	}
+}
+
+// withProperties appends the item's custom properties, in name order, to the standard attributes
+func withProperties(attrs []slog.Attr, properties map[string]string) []slog.Attr {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		attrs = append(attrs, slog.String(name, properties[name]))
+	}
+
+	return attrs
+}
+
+// write creates a record and passes it to the handler if the handler is enabled for the level
+func (stl *slogTraceListener) write(level slog.Level, message string, attrs ...slog.Attr) {
+	stl.writeAt(stl.clock.Now(), level, message, attrs...)
+}
+
+// writeAt creates a record at the specified time and passes it to the handler if the handler is enabled for the level
+func (stl *slogTraceListener) writeAt(timestamp time.Time, level slog.Level, message string, attrs ...slog.Attr) {
+	ctx := context.Background()
+
+	if !stl.handler.Enabled(ctx, level) {
+		return
+	}
+
+	record := slog.NewRecord(timestamp, level, message, 0)
+	record.AddAttrs(attrs...)
+
+	_ = stl.handler.Handle(ctx, record)
+}
@@ -0,0 +1,260 @@
+package slogbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+type recordedMessage struct {
+	message  string
+	severity telemetry.Severity
+}
+
+type recordingTraceListener struct {
+	messages   []recordedMessage
+	exceptions []error
+}
+
+func (rtl *recordingTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	rtl.messages = append(rtl.messages, recordedMessage{message: message, severity: severity})
+}
+
+func (rtl *recordingTraceListener) TraceException(err error) {
+	rtl.exceptions = append(rtl.exceptions, err)
+}
+
+func (rtl *recordingTraceListener) TracePanic(rethrow bool) {}
+
+func (rtl *recordingTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TraceMetric(name string, value float64) {}
+
+func (rtl *recordingTraceListener) TraceEvent(name string) {}
+
+func (rtl *recordingTraceListener) Flush() {}
+
+func (rtl *recordingTraceListener) Close() {}
+
+func decodeRecords(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	records := make([]map[string]interface{}, 0)
+	decoder := json.NewDecoder(buffer)
+
+	for decoder.More() {
+		record := make(map[string]interface{})
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestHandlerMapsLevelsToSeverities(t *testing.T) {
+	t.Log("Given a slog.Logger using the telemetry Handler")
+	{
+		rtl := &recordingTraceListener{}
+		var tl telemetry.TraceListener = rtl
+		logger := slog.New(NewHandler(&tl, nil))
+
+		expected := map[slog.Level]telemetry.Severity{
+			slog.LevelDebug:     telemetry.Verbose,
+			slog.LevelInfo:      telemetry.Information,
+			slog.LevelWarn:      telemetry.Warning,
+			slog.LevelError:     telemetry.Error,
+			slog.LevelError + 4: telemetry.Critical,
+		}
+
+		for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError, slog.LevelError + 4} {
+			t.Logf("\tWhen a '%v' record is logged", level)
+			{
+				logger.Log(context.Background(), level, "Test message")
+				actual := rtl.messages[len(rtl.messages)-1]
+
+				if actual.severity == expected[level] && actual.message == "Test message" {
+					t.Logf("\t\t[%v] The message is traced with the '%v' severity.", checkMark, expected[level].ToString())
+				} else {
+					t.Errorf("\t\t[%v] The message is traced with the '%v' severity. Actual: '%v' \"%v\"", ballotX, expected[level].ToString(), actual.severity.ToString(), actual.message)
+				}
+			}
+		}
+	}
+}
+
+func TestHandlerFlattensAttributesAndGroups(t *testing.T) {
+	expectedMessage := `Saved a=1 order.id="x y" order.item.count=2`
+
+	t.Log("Given a slog.Logger using the telemetry Handler")
+	{
+		rtl := &recordingTraceListener{}
+		var tl telemetry.TraceListener = rtl
+		logger := slog.New(NewHandler(&tl, nil))
+
+		t.Log("\tWhen a record is logged with attributes and groups")
+		{
+			logger.With("a", 1).WithGroup("order").Info("Saved", "id", "x y", slog.Group("item", "count", 2))
+			actualMessage := rtl.messages[0].message
+
+			if actualMessage == expectedMessage {
+				t.Logf("\t\t[%v] The attributes are written as properties with dotted keys.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The attributes are written as properties with dotted keys. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedMessage, actualMessage)
+			}
+		}
+	}
+}
+
+func TestHandlerTracesRecordsAsItemsWithProperties(t *testing.T) {
+	recordTime := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+
+	t.Log("Given a slog.Handler forwarding to a listener which records items")
+	{
+		recorder := telemetrytest.NewRecorder()
+		var tl telemetry.TraceListener = recorder
+		handler := NewHandler(&tl, nil)
+
+		t.Log("\tWhen a record with a time, attributes and groups is handled within an operation")
+		{
+			record := slog.NewRecord(recordTime, slog.LevelWarn, "Saved", 0)
+			record.AddAttrs(slog.String("id", "x y"), slog.Group("item", "count", 2))
+
+			ctx := telemetry.WithOperationID(context.Background(), "op-1")
+			if err := handler.WithAttrs([]slog.Attr{slog.Int("a", 1)}).Handle(ctx, record); err != nil {
+				t.Fatal(err)
+			}
+
+			message := recorder.Messages()[0]
+
+			if message.Message == "Saved" && message.Properties["a"] == "1" && message.Properties["id"] == "x y" && message.Properties["item.count"] == "2" {
+				t.Logf("\t\t[%v] The attributes are traced as properties rather than in the message.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The attributes are traced as properties rather than in the message. Actual: \"%v\", %v", ballotX, message.Message, message.Properties)
+			}
+
+			if message.Timestamp.Equal(recordTime) && message.OperationID == "op-1" && message.Severity == telemetry.Warning {
+				t.Logf("\t\t[%v] The message has the time of the record and the operation of its context.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message has the time of the record and the operation of its context. Actual: %v, \"%v\"", ballotX, message.Timestamp, message.OperationID)
+			}
+		}
+	}
+}
+
+func TestHandlerTracesErrorAttributesAsExceptions(t *testing.T) {
+	expectedErr := errors.New("connection refused")
+
+	t.Log("Given a slog.Logger using the telemetry Handler")
+	{
+		rtl := &recordingTraceListener{}
+		var tl telemetry.TraceListener = rtl
+		logger := slog.New(NewHandler(&tl, nil))
+
+		t.Log("\tWhen a record is logged with an error attribute")
+		{
+			logger.Error("Save failed", "err", expectedErr, "id", 7)
+
+			if len(rtl.exceptions) == 1 && rtl.exceptions[0] == expectedErr {
+				t.Logf("\t\t[%v] The error is traced as an exception.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The error is traced as an exception. Actual: %v", ballotX, rtl.exceptions)
+			}
+
+			if rtl.messages[0].message == "Save failed id=7" {
+				t.Logf("\t\t[%v] The error is not repeated in the message properties.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The error is not repeated in the message properties. Actual: \"%v\"", ballotX, rtl.messages[0].message)
+			}
+		}
+	}
+}
+
+func TestHandlerWithoutListenerUsesRegisteredListeners(t *testing.T) {
+	defer telemetry.Close()
+
+	t.Log("Given a trace listener registered with the telemetry package")
+	{
+		rtl := &recordingTraceListener{}
+		var tl telemetry.TraceListener = rtl
+		telemetry.AddListener(&tl)
+
+		t.Log("\tWhen a record is logged by a Handler without a listener")
+		{
+			slog.New(NewHandler(nil, &HandlerOptions{Level: slog.LevelInfo})).Debug("Ignored")
+			slog.New(NewHandler(nil, nil)).Warn("Test message")
+
+			if len(rtl.messages) == 1 && rtl.messages[0].message == "Test message" && rtl.messages[0].severity == telemetry.Warning {
+				t.Logf("\t\t[%v] The enabled message reaches the registered listener.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The enabled message reaches the registered listener. Actual: %v", ballotX, rtl.messages)
+			}
+		}
+	}
+}
+
+func TestTraceListenerWritesToHandler(t *testing.T) {
+	t.Log("Given a SlogTraceListener writing to a JSON handler")
+	{
+		buffer := &bytes.Buffer{}
+		tl := NewSlogTraceListener(slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+		t.Log("\tWhen messages, an exception and a failed dependency are traced")
+		{
+			tl.TraceMessage("Verbose message", telemetry.Verbose)
+			tl.TraceMessage("Warning message", telemetry.Warning)
+			tl.TraceException(errors.New("broken"))
+
+			dt := tl.TrackDependency("db", "SQL", "server")
+			(*dt).Fail("500")
+			(*dt).Done()
+
+			records := decodeRecords(t, buffer)
+
+			if len(records) != 3 {
+				t.Fatalf("\t\t[%v] Only the records enabled by the handler are written. Actual: %v", ballotX, records)
+			}
+
+			if records[0]["level"] == "WARN" && records[0]["msg"] == "Warning message" {
+				t.Logf("\t\t[%v] The message is written at the equivalent level.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message is written at the equivalent level. Actual: %v", ballotX, records[0])
+			}
+
+			if records[1]["level"] == "ERROR" && records[1]["error"] == "broken" {
+				t.Logf("\t\t[%v] The exception is written with an error attribute.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The exception is written with an error attribute. Actual: %v", ballotX, records[1])
+			}
+
+			dependency := records[2]
+			if dependency["level"] == "ERROR" && dependency["msg"] == "dependency" && dependency["target"] == "server" && dependency["success"] == false && dependency["status"] == "500" {
+				t.Logf("\t\t[%v] The dependency is written with its outcome as attributes.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency is written with its outcome as attributes. Actual: %v", ballotX, dependency)
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package stdlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// queueSize is the most lines which wait to be traced. Lines written while the queue is full are written to standard error instead.
+const queueSize int = 1024
+
+var (
+	// severityKeywords are the leading words recognised as the level of a line
+	severityKeywords = map[string]telemetry.Severity{
+		"trace":       telemetry.Verbose,
+		"debug":       telemetry.Verbose,
+		"dbg":         telemetry.Verbose,
+		"verbose":     telemetry.Verbose,
+		"vrb":         telemetry.Verbose,
+		"info":        telemetry.Information,
+		"inf":         telemetry.Information,
+		"information": telemetry.Information,
+		"notice":      telemetry.Information,
+		"warn":        telemetry.Warning,
+		"wrn":         telemetry.Warning,
+		"warning":     telemetry.Warning,
+		"error":       telemetry.Error,
+		"err":         telemetry.Error,
+		"fatal":       telemetry.Critical,
+		"panic":       telemetry.Critical,
+		"critical":    telemetry.Critical,
+		"crit":        telemetry.Critical,
+		"crt":         telemetry.Critical,
+	}
+
+	// levelPattern finds the leading level token, e.g. "ERROR:", "[warn]" or "level=info"
+	levelPattern = regexp.MustCompile(`^(?:\[([A-Za-z]+)\]|level=([A-Za-z]+)|([A-Za-z]+):?)(?:\s+|$)`)
+
+	// lines are the lines waiting to be traced by the delivering goroutine, which is started by the first line
+	lines        = make(chan queuedLine, queueSize)
+	startOnce    sync.Once
+	deliverer    atomic.Uint64
+	delivering   atomic.Bool
+	fallback     io.Writer = os.Stderr
+	fallbackLock sync.Mutex
+)
+
+// queuedLine is a parsed line waiting to be traced, or a barrier which is closed once the lines before it have been traced
+type queuedLine struct {
+	message  string
+	severity telemetry.Severity
+	barrier  chan struct{}
+}
+
+type logWriter struct {
+	mutex           sync.Mutex
+	defaultSeverity telemetry.Severity
+	prefix          string
+	flags           int
+	header          *regexp.Regexp
+	buffer          bytes.Buffer
+}
+
+// NewWriter creates an io.Writer, for use with log.SetOutput or log.New, which traces each line written to it through the telemetry package.
+// The prefix and flags must match those of the logger so that the header of each line can be removed. Lines beginning with a level keyword,
+// such as "ERROR:", "[warn]" or "level=debug", are traced with that severity; all other lines use the default severity.
+//
+// The lines are traced by a separate goroutine, as the logger holds its lock while it writes, so that a listener which itself logs, e.g.
+// to report a failure, does not deadlock. Lines logged by a listener while it traces a line are written to standard error rather than
+// traced again, as are lines written while too many are waiting to be traced. Call Flush to wait for the lines to be traced, e.g. before
+// closing the telemetry.
+func NewWriter(defaultSeverity telemetry.Severity, prefix string, flags int) io.Writer {
+	return &logWriter{
+		defaultSeverity: defaultSeverity,
+		prefix:          prefix,
+		flags:           flags,
+		header:          newHeaderPattern(flags),
+	}
+}
+
+// Redirect sends the output of the standard logger to the telemetry package, using the standard logger's current prefix and flags
+func Redirect(defaultSeverity telemetry.Severity) {
+	log.SetOutput(NewWriter(defaultSeverity, log.Prefix(), log.Flags()))
+}
+
+// Flush waits until the lines written so far to every Writer have been traced
+func Flush() {
+	startOnce.Do(start)
+
+	if isDeliverer() {
+		return
+	}
+
+	barrier := make(chan struct{})
+	lines <- queuedLine{barrier: barrier}
+	<-barrier
+}
+
+// Write queues each complete line in the content to be traced, holding any partial line until the rest of it is written
+func (lw *logWriter) Write(p []byte) (int, error) {
+	lw.mutex.Lock()
+
+	lw.buffer.Write(p)
+
+	var complete []string
+	for {
+		index := bytes.IndexByte(lw.buffer.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+
+		complete = append(complete, strings.TrimRight(string(lw.buffer.Next(index+1)), "\r\n"))
+	}
+
+	lw.mutex.Unlock()
+
+	for _, line := range complete {
+		lw.trace(line)
+	}
+
+	return len(p), nil
+}
+
+// trace parses the line and queues it to be traced. A line written by a listener while it traces a line, or while the queue is full, is
+// written to standard error instead.
+func (lw *logWriter) trace(line string) {
+	startOnce.Do(start)
+
+	if isDeliverer() {
+		writeFallback(line)
+		return
+	}
+
+	message, severity, ok := lw.parse(line)
+	if !ok {
+		return
+	}
+
+	select {
+	case lines <- queuedLine{message: message, severity: severity}:
+	default:
+		writeFallback(line)
+	}
+}
+
+// parse removes the prefix and header from the line and finds its severity. It returns false if nothing remains to be traced.
+func (lw *logWriter) parse(line string) (string, telemetry.Severity, bool) {
+	if lw.flags&log.Lmsgprefix == 0 {
+		line = strings.TrimPrefix(line, lw.prefix)
+	}
+
+	line = lw.header.ReplaceAllString(line, "")
+
+	if lw.flags&log.Lmsgprefix != 0 {
+		line = strings.TrimPrefix(line, lw.prefix)
+	}
+
+	if strings.TrimSpace(line) == "" {
+		return "", lw.defaultSeverity, false
+	}
+
+	message, severity := lw.parseSeverity(line)
+
+	return message, severity, true
+}
+
+// parseSeverity finds the severity from a leading level keyword, removing the keyword from the message
+func (lw *logWriter) parseSeverity(line string) (string, telemetry.Severity) {
+	match := levelPattern.FindStringSubmatch(line)
+	if match == nil {
+		return line, lw.defaultSeverity
+	}
+
+	keyword := match[1] + match[2] + match[3]
+
+	// A bare word without a colon is only a level if it is upper case, so that "error reading file" is not mistaken for one
+	if match[3] != "" && !strings.HasSuffix(strings.TrimSpace(match[0]), ":") && keyword != strings.ToUpper(keyword) {
+		return line, lw.defaultSeverity
+	}
+
+	severity, ok := severityKeywords[strings.ToLower(keyword)]
+	if !ok {
+		return line, lw.defaultSeverity
+	}
+
+	return line[len(match[0]):], severity
+}
+
+// newHeaderPattern creates the pattern matching the date, time and file header which the log package writes for the flags
+func newHeaderPattern(flags int) *regexp.Regexp {
+	var pattern strings.Builder
+
+	pattern.WriteString("^")
+
+	if flags&log.Ldate != 0 {
+		pattern.WriteString(`\d{4}/\d{2}/\d{2} `)
+	}
+
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		pattern.WriteString(`\d{2}:\d{2}:\d{2}`)
+
+		if flags&log.Lmicroseconds != 0 {
+			pattern.WriteString(`\.\d{6}`)
+		}
+
+		pattern.WriteString(" ")
+	}
+
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		pattern.WriteString(`.+?:\d+: `)
+	}
+
+	return regexp.MustCompile(pattern.String())
+}
+
+// start starts the goroutine which traces the queued lines
+func start() {
+	ready := make(chan struct{})
+
+	go func() {
+		deliverer.Store(goroutineID())
+		close(ready)
+
+		for line := range lines {
+			if line.barrier != nil {
+				close(line.barrier)
+				continue
+			}
+
+			delivering.Store(true)
+			telemetry.TraceMessage(line.message, line.severity)
+			delivering.Store(false)
+		}
+	}()
+
+	<-ready
+}
+
+// isDeliverer indicates whether the caller is the goroutine which traces the queued lines, in the middle of tracing one. The goroutine's ID
+// is only read while a line is being traced, as reading it is relatively slow.
+func isDeliverer() bool {
+	return delivering.Load() && goroutineID() == deliverer.Load()
+}
+
+// writeFallback writes a line which is not traced to standard error
+func writeFallback(line string) {
+	fallbackLock.Lock()
+	defer fallbackLock.Unlock()
+
+	_, _ = fmt.Fprintln(fallback, line)
+}
+
+// goroutineID parses the ID of the calling goroutine from its stack trace header, "goroutine 123 [running]:"
+func goroutineID() uint64 {
+	var buffer [64]byte
+	header := buffer[:runtime.Stack(buffer[:], false)]
+
+	var id uint64
+	for _, c := range header[len("goroutine "):] {
+		if c < '0' || c > '9' {
+			break
+		}
+
+		id = id*10 + uint64(c-'0')
+	}
+
+	return id
+}
@@ -0,0 +1,216 @@
+package stdlog
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+type recordedMessage struct {
+	message  string
+	severity telemetry.Severity
+}
+
+type recordingTraceListener struct {
+	messages []recordedMessage
+}
+
+func (rtl *recordingTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	rtl.messages = append(rtl.messages, recordedMessage{message: message, severity: severity})
+}
+
+func (rtl *recordingTraceListener) TraceException(err error) {}
+
+func (rtl *recordingTraceListener) TracePanic(rethrow bool) {}
+
+func (rtl *recordingTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return nil
+}
+
+func (rtl *recordingTraceListener) TraceMetric(name string, value float64) {}
+
+func (rtl *recordingTraceListener) TraceEvent(name string) {}
+
+func (rtl *recordingTraceListener) Flush() {}
+
+func (rtl *recordingTraceListener) Close() {}
+
+// loggingTraceListener records each message and then logs it through the standard logger, as a listener reporting a failure might
+type loggingTraceListener struct {
+	recordingTraceListener
+}
+
+func (ltl *loggingTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	ltl.recordingTraceListener.TraceMessage(message, severity)
+	log.Printf("Listener received: %v", message)
+}
+
+func newRegisteredListener() *recordingTraceListener {
+	rtl := &recordingTraceListener{}
+	var tl telemetry.TraceListener = rtl
+	telemetry.AddListener(&tl)
+
+	return rtl
+}
+
+func TestHeaderAndPrefixAreRemoved(t *testing.T) {
+	defer telemetry.Close()
+
+	flagSets := map[string]int{
+		"standard flags":                    log.LstdFlags,
+		"microseconds and short file":       log.LstdFlags | log.Lmicroseconds | log.Lshortfile,
+		"long file and UTC":                 log.Ldate | log.Llongfile | log.LUTC,
+		"message prefix and standard flags": log.LstdFlags | log.Lmsgprefix,
+		"no flags":                          0,
+	}
+
+	for description, flags := range flagSets {
+		t.Logf("Given a logger writing to the telemetry Writer with %v", description)
+		{
+			rtl := newRegisteredListener()
+			logger := log.New(NewWriter(telemetry.Information, "svc: ", flags), "svc: ", flags)
+
+			t.Log("\tWhen a line is logged")
+			{
+				logger.Print("Test message")
+				Flush()
+
+				if len(rtl.messages) == 1 && rtl.messages[0].message == "Test message" && rtl.messages[0].severity == telemetry.Information {
+					t.Logf("\t\t[%v] Only the message is traced, with the default severity.", checkMark)
+				} else {
+					t.Errorf("\t\t[%v] Only the message is traced, with the default severity. Actual: %v", ballotX, rtl.messages)
+				}
+			}
+
+			telemetry.Close()
+		}
+	}
+}
+
+func TestLevelKeywordsAreDetected(t *testing.T) {
+	defer telemetry.Close()
+
+	lines := []recordedMessage{
+		{"ERROR: connection refused", telemetry.Error},
+		{"[warn] disk nearly full", telemetry.Warning},
+		{"level=debug cache miss", telemetry.Verbose},
+		{"FATAL out of memory", telemetry.Critical},
+		{"error reading file", telemetry.Information},
+		{"Starting server", telemetry.Information},
+	}
+
+	expectedMessages := []string{"connection refused", "disk nearly full", "cache miss", "out of memory", "error reading file", "Starting server"}
+
+	t.Log("Given a logger writing to the telemetry Writer with a default severity of 'Information'")
+	{
+		rtl := newRegisteredListener()
+		logger := log.New(NewWriter(telemetry.Information, "", log.LstdFlags), "", log.LstdFlags)
+
+		for i, line := range lines {
+			t.Logf("\tWhen \"%v\" is logged", line.message)
+			{
+				logger.Print(line.message)
+				Flush()
+				actual := rtl.messages[i]
+
+				if actual.severity == line.severity && actual.message == expectedMessages[i] {
+					t.Logf("\t\t[%v] \"%v\" is traced with the '%v' severity.", checkMark, expectedMessages[i], line.severity.ToString())
+				} else {
+					t.Errorf("\t\t[%v] \"%v\" is traced with the '%v' severity. Actual: \"%v\" '%v'", ballotX, expectedMessages[i], line.severity.ToString(), actual.message, actual.severity.ToString())
+				}
+			}
+		}
+	}
+}
+
+func TestPartialLinesAreHeldUntilComplete(t *testing.T) {
+	defer telemetry.Close()
+
+	t.Log("Given the telemetry Writer without flags")
+	{
+		rtl := newRegisteredListener()
+		writer := NewWriter(telemetry.Warning, "", 0)
+
+		t.Log("\tWhen a line is written in pieces followed by a second line")
+		{
+			_, _ = writer.Write([]byte("First "))
+			_, _ = writer.Write([]byte("line\nSecond line\n"))
+			Flush()
+
+			if len(rtl.messages) == 2 && rtl.messages[0].message == "First line" && rtl.messages[1].message == "Second line" {
+				t.Logf("\t\t[%v] Each complete line is traced once.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Each complete line is traced once. Actual: %v", ballotX, rtl.messages)
+			}
+		}
+	}
+}
+
+func TestListenersWhichLogDoNotDeadlock(t *testing.T) {
+	defer telemetry.Close()
+	defer log.SetOutput(os.Stderr)
+
+	var written bytes.Buffer
+	fallback = &written
+	defer func() { fallback = os.Stderr }()
+
+	t.Log("Given the standard logger redirected to the telemetry, and a listener which logs each message it receives")
+	{
+		ltl := &loggingTraceListener{}
+		var tl telemetry.TraceListener = ltl
+		telemetry.AddListener(&tl)
+
+		Redirect(telemetry.Information)
+
+		t.Log("\tWhen a line is logged")
+		{
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				log.Print("Test message")
+				Flush()
+			}()
+
+			select {
+			case <-done:
+				t.Logf("\t\t[%v] The call returns.", checkMark)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t\t[%v] The call returns.", ballotX)
+			}
+
+			if len(ltl.messages) == 1 && ltl.messages[0].message == "Test message" {
+				t.Logf("\t\t[%v] The line is traced once.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The line is traced once. Actual: %v", ballotX, ltl.messages)
+			}
+
+			fallbackLock.Lock()
+			output := written.String()
+			fallbackLock.Unlock()
+
+			if strings.Contains(output, "Listener received: Test message") {
+				t.Logf("\t\t[%v] The line logged by the listener is written to standard error.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The line logged by the listener is written to standard error. Actual: %q", ballotX, output)
+			}
+		}
+	}
+}
@@ -1,39 +1,161 @@
 package stream
 
 import (
-	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/phbarton/Telemetry-Go/telemetry"
 )
 
 type streamDurationTrace struct {
+	telemetry.TraceState
 	traceListener *streamTraceListener
 	statusCode    string
 	success       bool
-	startTime     time.Time
-	output        string
+	reported      bool
+	start         Entry
+	details       telemetry.Item
+	item          telemetry.Item
 }
 
 // Complete indicates a successful completion of the measured duration activity
 func (sdt *streamDurationTrace) Complete() {
-	sdt.success = true
-	sdt.statusCode = "OK"
+	sdt.Update("Complete", func() {
+		sdt.reported = true
+		sdt.success = true
+		sdt.statusCode = "OK"
+	})
 }
 
 // Fail indicates an unsuccessful completion of the measured duration activity
 func (sdt *streamDurationTrace) Fail(statusCode string) {
-	sdt.success = false
-	sdt.statusCode = statusCode
+	sdt.Update("Fail", func() {
+		sdt.reported = true
+		sdt.success = false
+		sdt.statusCode = statusCode
+	})
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (sdt *streamDurationTrace) CompleteWithStatus(statusCode string) {
+	sdt.Update("CompleteWithStatus", func() {
+		sdt.reported = true
+		sdt.success = true
+		sdt.statusCode = statusCode
+	})
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code
+func (sdt *streamDurationTrace) SetStatusCode(code int) {
+	sdt.Update("SetStatusCode", func() {
+		sdt.reported = true
+		sdt.success = telemetry.IsSuccessStatusCode(code)
+		sdt.statusCode = strconv.Itoa(code)
+	})
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity, which is written indented beneath this trace
+func (sdt *streamDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var child *telemetry.Item
+
+	started := sdt.Update("StartChild", func() {
+		if sdt.item.ID == "" {
+			sdt.item.ID = telemetry.NewSpanID()
+			sdt.traceListener.addParent(sdt.item.ID, sdt.start.Text, sdt.start.Depth)
+		}
+
+		child = telemetry.NewChildItem(&sdt.item, name)
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return sdt.traceListener.TrackItem(child)
+}
+
+// SetProperty sets a custom named value of the measured duration activity
+func (sdt *streamDurationTrace) SetProperty(name string, value string) {
+	sdt.Update("SetProperty", func() { sdt.details.SetProperty(name, value) })
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+func (sdt *streamDurationTrace) SetMeasurement(name string, value float64) {
+	sdt.Update("SetMeasurement", func() { sdt.details.SetMeasurement(name, value) })
+}
+
+// SetSource sets the source of a request
+func (sdt *streamDurationTrace) SetSource(source string) {
+	sdt.Update("SetSource", func() { sdt.details.Source = source })
+}
+
+// SetURL sets the full URL of a request
+func (sdt *streamDurationTrace) SetURL(url string) {
+	sdt.Update("SetURL", func() { sdt.details.URL = url })
+}
+
+// SetData sets the command of a dependency call
+func (sdt *streamDurationTrace) SetData(data string) {
+	sdt.Update("SetData", func() { sdt.details.Data = data })
+}
+
+// SetRunLocation sets where an availability test ran
+func (sdt *streamDurationTrace) SetRunLocation(location string) {
+	sdt.Update("SetRunLocation", func() { sdt.details.RunLocation = location })
 }
 
 // Done indicates that the trace is complete and should be committed to the telemetry source
 func (sdt *streamDurationTrace) Done() {
-	duration := time.Now().Sub(sdt.startTime)
+	sdt.DoneAt(sdt.traceListener.clock.Now())
+}
+
+// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source. The details set on the trace
+// are written as key=value pairs after the outcome. A trace which was neither completed nor failed is written as a warning. A trace is only
+// written once.
+func (sdt *streamDurationTrace) DoneAt(end time.Time) {
+	if !sdt.Finish(end) {
+		return
+	}
+
+	if sdt.item.ID != "" {
+		sdt.traceListener.removeParent(sdt.item.ID)
+	}
 
-	if sdt.success {
-		sdt.traceListener.TraceMessage(fmt.Sprintf("%v, Duration: %vms, Success", sdt.output, duration.Milliseconds()), telemetry.Information)
+	entry := sdt.start
+	entry.Timestamp = end
+	entry.Done = true
+	entry.Duration = end.Sub(sdt.start.Timestamp)
+	entry.Details = collectDetails(&sdt.details)
+
+	if !sdt.reported {
+		entry.Severity, entry.Outcome = telemetry.Warning, "Incomplete: done without Complete or Fail"
+	} else if sdt.success {
+		entry.Severity, entry.Outcome = telemetry.Information, "Success"
 	} else {
-		sdt.traceListener.TraceMessage(fmt.Sprintf("%v, Duration: %vms, Failed: %v", sdt.output, duration.Milliseconds(), sdt.statusCode), telemetry.Error)
+		entry.Severity, entry.Outcome = telemetry.Error, "Failed: "+sdt.statusCode
 	}
+
+	sdt.traceListener.write(&entry)
+}
+
+// collectDetails collects the kind-specific details, properties and measurements set on a trace, so that they are rendered in the same way as the
+// properties of an item
+func collectDetails(details *telemetry.Item) map[string]string {
+	values := make(map[string]string, len(details.Properties)+len(details.Measurements)+4)
+
+	for k, v := range details.Properties {
+		values[k] = v
+	}
+
+	for k, v := range details.Measurements {
+		values[k] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	for k, v := range map[string]string{"source": details.Source, "url": details.URL, "data": details.Data, "runLocation": details.RunLocation} {
+		if v != "" {
+			values[k] = v
+		}
+	}
+
+	return values
 }
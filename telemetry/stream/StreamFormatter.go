@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// Entry is a line of output of a stream listener, before it is rendered by a Formatter
+type Entry struct {
+	// Timestamp is when the item happened, or when the tracked activity started or ended
+	Timestamp time.Time
+
+	// Severity is the severity of the line. The end of a tracked activity is Information when it succeeded, Warning when it was incomplete
+	// and Error when it failed.
+	Severity telemetry.Severity
+
+	// Depth is the number of traces, not yet done, that the tracked activity was started within
+	Depth int
+
+	// Text is the message, or the description of the tracked activity, e.g. "REQUEST: GET /orders"
+	Text string
+
+	// Properties are the custom named values of the item, including the "parent" of a tracked activity started within another
+	Properties map[string]string
+
+	// Done indicates that the line is the end of a tracked activity, which has a Duration, an Outcome and Details
+	Done bool
+
+	// Duration is the time taken by the tracked activity
+	Duration time.Duration
+
+	// Outcome is "Success", "Failed: " followed by the status code, or "Incomplete: done without Complete or Fail"
+	Outcome string
+
+	// Details are the details, properties and measurements set on the trace of the tracked activity
+	Details map[string]string
+}
+
+// Formatter renders an entry as the text written to the stream, including its line ending
+type Formatter func(entry *Entry) string
+
+// FormatText renders an entry on a single line, with its timestamp, severity tag and properties, e.g.
+//
+//	Jan  2 15:04:05.000 [INF]: REQUEST: GET /orders, Duration: 250ms, Success source=web
+//
+// It is the default Formatter of a stream listener.
+func FormatText(entry *Entry) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "%v [%v]: %v%v%v", entry.Timestamp.Format(time.StampMilli), SeverityTag(entry.Severity), strings.Repeat("  ", entry.Depth),
+		entry.Text, FormatProperties(entry.Properties))
+
+	if entry.Done {
+		fmt.Fprintf(&builder, ", Duration: %vms, %v%v", entry.Duration.Milliseconds(), entry.Outcome, FormatProperties(entry.Details))
+	}
+
+	builder.WriteString("\n")
+
+	return builder.String()
+}
+
+// FormatProperties renders the properties as space separated key=value pairs in key order, each preceded by a space, quoting values where
+// needed
+func FormatProperties(properties map[string]string) string {
+	if len(properties) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(properties))
+	for k := range properties {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var builder strings.Builder
+
+	for _, k := range keys {
+		value := properties[k]
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+
+		builder.WriteString(" ")
+		builder.WriteString(k)
+		builder.WriteString("=")
+		builder.WriteString(value)
+	}
+
+	return builder.String()
+}
+
+// SeverityTag returns the three letter tag of the severity, e.g. "INF"
+func SeverityTag(severity telemetry.Severity) string {
+	switch severity {
+	case telemetry.Verbose:
+		return "VRB"
+	case telemetry.Information:
+		return "INF"
+	case telemetry.Warning:
+		return "WRN"
+	case telemetry.Error:
+		return "ERR"
+	case telemetry.Critical:
+		return "CRT"
+	default:
+		return "UNK"
+	}
+}
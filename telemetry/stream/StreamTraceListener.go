@@ -3,6 +3,9 @@ package stream
 import (
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/phbarton/Telemetry-Go/telemetry"
@@ -11,25 +14,107 @@ import (
 type streamTraceListener struct {
 	loggingLevel telemetry.Severity
 	channel      *streamTraceListenerChannel
+	writer       *io.Writer
+	errorWriter  *io.Writer
+	errorLevel   telemetry.Severity
+	clock        telemetry.Clock
+	formatter    Formatter
+	mutex        sync.Mutex
+	parents      map[string]streamParent
+	added        uint64
 }
 
-// NewStreamTraceListener creates a trace listener which outputs to the provided implementation of io.Writer interface. It limits output based on the logging level supplied
-func NewStreamTraceListener(loggingLevel telemetry.Severity, writer *io.Writer) telemetry.TraceListener {
-	traceListener := streamTraceListener{loggingLevel: loggingLevel, channel: newStreamTraceListenerChannel(writer)}
+// maxParents is the most traces not yet done which are recorded as parents. Once it is reached, the oldest is forgotten to make room, so
+// that traces which are never done do not hold on to memory; the traces started within a forgotten trace are no longer indented.
+const maxParents int = 1024
 
-	return &traceListener
+// streamParent is a trace which is not yet done, recorded so that the traces started within it can be indented beneath it and tagged with it
+type streamParent struct {
+	description string
+	depth       int
+	sequence    uint64
 }
 
-func (stl *streamTraceListener) TraceMessage(message string, severity telemetry.Severity) {
-	if severity >= stl.loggingLevel {
-		entry := fmt.Sprintf("%v [%v]: %v\n", time.Now().Format(time.StampMilli), getSeverityTag(severity), message)
+// Settings configures how a stream listener renders its output
+type Settings struct {
+	// Formatter renders each line. Defaults to FormatText.
+	Formatter Formatter
+
+	// ErrorWriter, if set, is written the lines with a severity of at least the ErrorLevel in place of the writer of the listener, e.g.
+	// standard error in place of standard output. The lines are written in the order they are traced, across both writers.
+	ErrorWriter *io.Writer
+
+	// ErrorLevel is the minimum severity of the lines written to the ErrorWriter
+	ErrorLevel telemetry.Severity
+}
+
+// streamSettings are the settings of a "stream" listener in a configuration file
+type streamSettings struct {
+	Level  telemetry.Severity `json:"level"`
+	Output string             `json:"output"`
+}
+
+func init() {
+	telemetry.RegisterListenerFactory("stream", newStreamTraceListenerFromSettings)
+}
+
+// NewStreamTraceListener creates a trace listener which outputs to the provided implementation of io.Writer interface. It limits output based on the logging level supplied,
+// and takes its timestamps and durations from the Clock in the options (the system clock by default)
+func NewStreamTraceListener(loggingLevel telemetry.Severity, writer *io.Writer, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	return NewStreamTraceListenerWithSettings(loggingLevel, writer, Settings{}, options...)
+}
+
+// NewStreamTraceListenerWithSettings creates a trace listener which outputs to the provided implementation of io.Writer interface, rendered
+// as configured by the settings. It limits output based on the logging level supplied.
+func NewStreamTraceListenerWithSettings(loggingLevel telemetry.Severity, writer *io.Writer, settings Settings, options ...telemetry.ListenerOption) telemetry.TraceListener {
+	listenerOptions := telemetry.NewListenerOptions(options...)
+
+	if settings.Formatter == nil {
+		settings.Formatter = FormatText
+	}
+
+	traceListener := &streamTraceListener{
+		loggingLevel: loggingLevel,
+		channel:      newStreamTraceListenerChannel(),
+		writer:       writer,
+		errorWriter:  settings.ErrorWriter,
+		errorLevel:   settings.ErrorLevel,
+		clock:        listenerOptions.Clock,
+		formatter:    settings.Formatter,
+		parents:      make(map[string]streamParent),
+	}
+
+	return traceListener
+}
 
-		stl.channel.Send(entry)
+// newStreamTraceListenerFromSettings creates a stream trace listener from its settings. The "output" is "stdout" or "stderr", and output is
+// limited to the "level", which defaults to Information
+func newStreamTraceListenerFromSettings(settings map[string]any) (telemetry.TraceListener, error) {
+	ss := streamSettings{Level: telemetry.Information}
+	if err := telemetry.DecodeSettings(settings, &ss); err != nil {
+		return nil, err
 	}
+
+	var writer io.Writer
+
+	switch ss.Output {
+	case "stdout":
+		writer = os.Stdout
+	case "stderr":
+		writer = os.Stderr
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected stdout or stderr", ss.Output)
+	}
+
+	return NewStreamTraceListener(ss.Level, &writer), nil
+}
+
+func (stl *streamTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	stl.write(&Entry{Timestamp: stl.clock.Now(), Severity: severity, Text: message})
 }
 
 func (stl *streamTraceListener) TraceException(err error) {
-	stl.TraceMessage(err.Error(), telemetry.Error)
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
 }
 
 func (stl *streamTraceListener) TracePanic(rethrow bool) {
@@ -43,29 +128,84 @@ func (stl *streamTraceListener) TracePanic(rethrow bool) {
 }
 
 func (stl *streamTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
-	durationTrace := stl.newDurationTrace(fmt.Sprintf("AVAILABILITY: %v", name))
-
-	return &durationTrace
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.AvailabilityItem, Name: name})
 }
 
 func (stl *streamTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
-	durationTrace := stl.newDurationTrace(fmt.Sprintf("REQUEST: %v %v", method, uri))
-
-	return &durationTrace
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: method, URI: uri})
 }
 
 func (stl *streamTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
-	durationTrace := stl.newDurationTrace(fmt.Sprintf("DEPENDENCY: %v (%v) %v", name, dependencyType, target))
-
-	return &durationTrace
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
 }
 
 func (stl *streamTraceListener) TraceMetric(name string, value float64) {
-	stl.TraceMessage(fmt.Sprintf("METRIC: '%v': %v", name, value), telemetry.Information)
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MetricItem, Name: name, Value: value})
 }
 
 func (stl *streamTraceListener) TraceEvent(name string) {
-	stl.TraceMessage(fmt.Sprintf("EVENT: %v", name), telemetry.Verbose)
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: name})
+}
+
+// TraceItem writes the item with its properties as key=value pairs after the message
+func (stl *streamTraceListener) TraceItem(item *telemetry.Item) {
+	entry := &Entry{Timestamp: item.Time(stl.clock), Properties: item.Properties}
+
+	switch item.Kind {
+	case telemetry.MessageItem:
+		entry.Severity, entry.Text = item.Severity, item.Message
+	case telemetry.ExceptionItem:
+		entry.Severity, entry.Text = telemetry.Error, item.Err.Error()
+	case telemetry.MetricItem:
+		entry.Severity, entry.Text = telemetry.Information, fmt.Sprintf("METRIC: '%v': %v", item.Name, item.Value)
+	case telemetry.EventItem:
+		entry.Severity, entry.Text = telemetry.Verbose, fmt.Sprintf("EVENT: %v", item.Name)
+	default:
+		return
+	}
+
+	stl.write(entry)
+}
+
+// TrackItem creates a tracking of the item, with its properties as key=value pairs after the description. A trace started within another
+// which is not yet done is indented beneath it and tagged with its description as the "parent".
+func (stl *streamTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	var description string
+
+	switch item.Kind {
+	case telemetry.AvailabilityItem:
+		description = fmt.Sprintf("AVAILABILITY: %v", item.Name)
+	case telemetry.RequestItem:
+		description = fmt.Sprintf("REQUEST: %v %v", item.Method, item.URI)
+	case telemetry.DependencyItem:
+		description = strings.TrimSpace(fmt.Sprintf("DEPENDENCY: %v (%v) %v", item.Name, item.DependencyType, item.Target))
+	default:
+		return telemetry.NoopDurationTrace()
+	}
+
+	properties := item.Properties
+	depth := 0
+
+	if parent, ok := stl.parent(item.ParentID); ok {
+		properties = item.Clone().Properties
+		if properties == nil {
+			properties = make(map[string]string, 1)
+		}
+
+		properties["parent"] = parent.description
+		depth = parent.depth + 1
+	}
+
+	durationTrace := stl.newDurationTrace(item, &Entry{Timestamp: item.Time(stl.clock), Severity: telemetry.Information, Depth: depth,
+		Text: description, Properties: properties})
+	durationTrace.item = *item.Clone()
+
+	if item.ID != "" {
+		stl.addParent(item.ID, description, depth)
+	}
+
+	var dt telemetry.DurationTrace = durationTrace
+	return &dt
 }
 
 func (stl *streamTraceListener) Flush() {
@@ -81,31 +221,71 @@ func (stl *streamTraceListener) Close() {
 	}
 }
 
-func (stl *streamTraceListener) newDurationTrace(output string) telemetry.DurationTrace {
-	stl.TraceMessage(output, telemetry.Information)
+// parent finds the trace which is not yet done with the ID
+func (stl *streamTraceListener) parent(id string) (streamParent, bool) {
+	if id == "" {
+		return streamParent{}, false
+	}
+
+	stl.mutex.Lock()
+	defer stl.mutex.Unlock()
+
+	parent, ok := stl.parents[id]
+	return parent, ok
+}
+
+// addParent records a trace which is not yet done, so that the traces started within it can refer to it, forgetting the oldest when there
+// are already maxParents
+func (stl *streamTraceListener) addParent(id string, description string, depth int) {
+	stl.mutex.Lock()
+	defer stl.mutex.Unlock()
+
+	if _, ok := stl.parents[id]; !ok && len(stl.parents) >= maxParents {
+		oldest := ""
+		for k, parent := range stl.parents {
+			if oldest == "" || parent.sequence < stl.parents[oldest].sequence {
+				oldest = k
+			}
+		}
+
+		delete(stl.parents, oldest)
+	}
+
+	stl.added++
+	stl.parents[id] = streamParent{description: description, depth: depth, sequence: stl.added}
+}
+
+// removeParent forgets a trace once it is done
+func (stl *streamTraceListener) removeParent(id string) {
+	stl.mutex.Lock()
+	defer stl.mutex.Unlock()
+
+	delete(stl.parents, id)
+}
+
+// newDurationTrace writes the start of the tracked activity, and creates the trace which writes its end with the same text and properties
+func (stl *streamTraceListener) newDurationTrace(item *telemetry.Item, start *Entry) *streamDurationTrace {
+	stl.write(start)
 
 	return &streamDurationTrace{
+		TraceState:    telemetry.NewTraceState(item.Describe(), stl.clock, start.Timestamp),
 		traceListener: stl,
-		output:        output,
-		startTime:     time.Now(),
+		start:         *start,
 		statusCode:    "Incomplete",
 		success:       false,
 	}
 }
 
-func getSeverityTag(severity telemetry.Severity) string {
-	switch severity {
-	case telemetry.Verbose:
-		return "VRB"
-	case telemetry.Information:
-		return "INF"
-	case telemetry.Warning:
-		return "WRN"
-	case telemetry.Error:
-		return "ERR"
-	case telemetry.Critical:
-		return "CRT"
-	default:
-		return "UNK"
+// write renders the entry with the formatter and sends it to the writer for its severity, if the severity is within the logging level
+func (stl *streamTraceListener) write(entry *Entry) {
+	if entry.Severity < stl.loggingLevel {
+		return
+	}
+
+	writer := stl.writer
+	if stl.errorWriter != nil && entry.Severity >= stl.errorLevel {
+		writer = stl.errorWriter
 	}
+
+	stl.channel.Send(writer, stl.formatter(entry))
 }
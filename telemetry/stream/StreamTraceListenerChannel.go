@@ -10,20 +10,25 @@ const (
 	bufferSize int = 10
 )
 
-// streamTraceListenerChannel is a complex channel that allows for async send of messages, and control of the channel.
+// streamMessage is a message to be written to its target
+type streamMessage struct {
+	writer *io.Writer
+	text   string
+}
+
+// streamTraceListenerChannel is a complex channel that allows for async send of messages, and control of the channel. Messages are written
+// one at a time in the order they are sent, even when they are sent to different targets.
 type streamTraceListenerChannel struct {
-	emitChannel    chan string
+	emitChannel    chan streamMessage
 	controlChannel chan *channelStateControl
 	waitGroup      sync.WaitGroup
-	writer         *io.Writer
 }
 
 // newStreamTraceListenerChannel creates a new instance of the streamTraceListenerChannel and begins listening
-func newStreamTraceListenerChannel(writer *io.Writer) *streamTraceListenerChannel {
+func newStreamTraceListenerChannel() *streamTraceListenerChannel {
 	channel := &streamTraceListenerChannel{
-		emitChannel:    make(chan string, bufferSize), // Buffered so that we can get some performance boost
+		emitChannel:    make(chan streamMessage, bufferSize), // Buffered so that we can get some performance boost
 		controlChannel: make(chan *channelStateControl),
-		writer:         writer,
 	}
 
 	// Start the listening loop
@@ -57,12 +62,12 @@ func (ch *streamTraceListenerChannel) Stop() {
 	}
 }
 
-// Send puts the message in the channel to be picked up and written to the target
-func (ch *streamTraceListenerChannel) Send(message string) {
+// Send puts the message in the channel to be picked up and written to the target writer
+func (ch *streamTraceListenerChannel) Send(writer *io.Writer, message string) {
 	if ch.emitChannel != nil {
 		// Notify the waitgroup of the work beforehand so that we track the amount of work in the buffer.
 		ch.waitGroup.Add(1)
-		ch.emitChannel <- message
+		ch.emitChannel <- streamMessage{writer: writer, text: message}
 	}
 }
 
@@ -115,19 +120,38 @@ func (ctl *channelState) process() {
 	case control := <-ctl.channel.controlChannel:
 		// If we get something from the control channel, we are changing the state of the complex channel
 		if control.stop {
+			// Write anything still buffered when closing, or discard it when force stopping
+			ctl.drain(control.completed != nil)
 			ctl.channel.notifyComplete(control.completed)
 			ctl.stopping = true
 		}
 	}
 }
 
-// send writes the supplied message to the target
-func (ctl *channelState) send(message string) {
+// drain empties the emit channel, writing each message to the target if requested
+func (ctl *channelState) drain(write bool) {
+	for {
+		select {
+		case msg := <-ctl.channel.emitChannel:
+			if write {
+				ctl.send(msg)
+			} else {
+				ctl.channel.waitGroup.Done()
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+// send writes the supplied message to its target
+func (ctl *channelState) send(message streamMessage) {
 	// Tell the channel that we're done when we exit the function
 	defer ctl.channel.waitGroup.Done()
 
 	// Write the message to the target
-	if _, err := (*ctl.channel.writer).Write([]byte(message)); err != nil {
+	if _, err := (*message.writer).Write([]byte(message.text)); err != nil {
 		log.Fatalf("Unexpected error when writing message to target: %v", err.Error())
 	}
 }
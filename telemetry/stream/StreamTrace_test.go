@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
 )
 
 const (
@@ -275,3 +276,262 @@ func TestCriticalMessagesAreFormattedCorrectly(t *testing.T) {
 		}
 	}
 }
+
+func TestDurationTraceOutputIsDeterministicWithManualClock(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+	expectedOutput := "Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders\n" +
+		"Mar  4 09:30:15.250 [INF]: REQUEST: GET /orders, Duration: 250ms, Success\n" +
+		"Mar  4 09:30:15.250 [INF]: DEPENDENCY: db (SQL) server\n" +
+		"Mar  4 09:30:16.750 [ERR]: DEPENDENCY: db (SQL) server, Duration: 1500ms, Failed: 500\n"
+	actualOutput := ""
+	tw := newTestWriter(func(s string) { actualOutput += s })
+
+	t.Log("Given a StreamTraceListener using a manual clock")
+	{
+		clock := telemetrytest.NewManualClock(start)
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw, telemetry.WithClock(clock))
+
+		t.Log("\tWhen traces are completed after the clock is advanced")
+		{
+			request := tl.TrackRequest("GET", "/orders")
+			clock.Advance(250 * time.Millisecond)
+			(*request).Complete()
+			(*request).Done()
+
+			dependency := tl.TrackDependency("db", "SQL", "server")
+			clock.Advance(1500 * time.Millisecond)
+			(*dependency).Fail("500")
+			(*dependency).Done()
+
+			tl.Close()
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The output has exact timestamps and durations.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The output has exact timestamps and durations. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestItemPropertiesAreWrittenInKeyOrder(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+	expectedOutput := "Mar  4 09:30:15.000 [WRN]: Test message region=west service=\"order api\"\n" +
+		"Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders tenant=contoso\n" +
+		"Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders tenant=contoso, Duration: 0ms, Success\n"
+	actualOutput := ""
+	tw := newTestWriter(func(s string) { actualOutput += s })
+
+	t.Log("Given a StreamTraceListener")
+	{
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw, telemetry.WithClock(telemetrytest.NewManualClock(start)))
+
+		t.Log("\tWhen items with properties are traced")
+		{
+			telemetry.TraceItemTo(tl, &telemetry.Item{
+				Kind:       telemetry.MessageItem,
+				Message:    "Test message",
+				Severity:   telemetry.Warning,
+				Properties: map[string]string{"service": "order api", "region": "west"},
+			})
+
+			request := telemetry.TrackItemTo(tl, &telemetry.Item{
+				Kind:       telemetry.RequestItem,
+				Method:     "GET",
+				URI:        "/orders",
+				Properties: map[string]string{"tenant": "contoso"},
+			})
+			(*request).Complete()
+			(*request).Done()
+
+			tl.Close()
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The properties follow the message as key=value pairs.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The properties follow the message as key=value pairs. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestDurationTraceDetailsAreWrittenWithTheOutcome(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+	expectedOutput := "Mar  4 09:30:15.000 [INF]: DEPENDENCY: db (SQL) server\n" +
+		"Mar  4 09:30:15.000 [INF]: DEPENDENCY: db (SQL) server, Duration: 0ms, Success data=\"SELECT * FROM orders\" rows=42 shard=eu\n"
+	actualOutput := ""
+	tw := newTestWriter(func(s string) { actualOutput += s })
+
+	t.Log("Given a StreamTraceListener")
+	{
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw, telemetry.WithClock(telemetrytest.NewManualClock(start)))
+
+		t.Log("\tWhen a dependency's data, a property and a measurement are set before it is done")
+		{
+			dependency := tl.TrackDependency("db", "SQL", "server")
+			(*dependency).SetData("SELECT * FROM orders")
+			(*dependency).SetProperty("shard", "eu")
+			(*dependency).SetMeasurement("rows", 42)
+			(*dependency).Complete()
+			(*dependency).Done()
+
+			tl.Close()
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The details follow the outcome as key=value pairs.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The details follow the outcome as key=value pairs. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestStatusCodesAndIncompleteTracesAreWritten(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+	expectedOutput := "Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders\n" +
+		"Mar  4 09:30:15.000 [ERR]: REQUEST: GET /orders, Duration: 0ms, Failed: 404\n" +
+		"Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders\n" +
+		"Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders, Duration: 0ms, Success\n" +
+		"Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders\n" +
+		"Mar  4 09:30:15.000 [WRN]: REQUEST: GET /orders, Duration: 0ms, Incomplete: done without Complete or Fail\n"
+	actualOutput := ""
+	tw := newTestWriter(func(s string) { actualOutput += s })
+
+	t.Log("Given a StreamTraceListener")
+	{
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw, telemetry.WithClock(telemetrytest.NewManualClock(start)))
+
+		t.Log("\tWhen requests end with a 404, a 204 and without an outcome")
+		{
+			request := tl.TrackRequest("GET", "/orders")
+			(*request).SetStatusCode(404)
+			(*request).Done()
+
+			request = tl.TrackRequest("GET", "/orders")
+			(*request).SetStatusCode(204)
+			(*request).Done()
+
+			request = tl.TrackRequest("GET", "/orders")
+			(*request).Done()
+
+			tl.Close()
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The 404 is a failure, the 204 a success, and the request without an outcome a warning.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The 404 is a failure, the 204 a success, and the request without an outcome a warning. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestChildTracesAreIndentedUnderTheirParent(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+	expectedOutput := "Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders\n" +
+		"Mar  4 09:30:15.000 [INF]:   DEPENDENCY: validate (InProc) parent=\"REQUEST: GET /orders\"\n" +
+		"Mar  4 09:30:15.100 [INF]:   DEPENDENCY: validate (InProc) parent=\"REQUEST: GET /orders\", Duration: 100ms, Success\n" +
+		"Mar  4 09:30:15.100 [INF]: REQUEST: GET /orders, Duration: 100ms, Success\n"
+	actualOutput := ""
+	tw := newTestWriter(func(s string) { actualOutput += s })
+
+	t.Log("Given a StreamTraceListener using a manual clock")
+	{
+		clock := telemetrytest.NewManualClock(start)
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw, telemetry.WithClock(clock))
+
+		t.Log("\tWhen a child trace is started within a request")
+		{
+			request := tl.TrackRequest("GET", "/orders")
+			child := (*request).StartChild("validate")
+			clock.Advance(100 * time.Millisecond)
+			(*child).Complete()
+			(*child).Done()
+			(*request).Complete()
+			(*request).Done()
+
+			tl.Close()
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The child is indented and names its parent.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The child is indented and names its parent. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedOutput, actualOutput)
+			}
+		}
+	}
+}
+
+func TestTracesWhichAreNeverDoneAreForgotten(t *testing.T) {
+	tw := newTestWriter(func(s string) {})
+
+	t.Log("Given a StreamTraceListener")
+	{
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw)
+		defer tl.Close()
+
+		t.Log("\tWhen more traces than the most recorded parents are started and never done")
+		{
+			for i := 0; i <= maxParents; i++ {
+				telemetry.TrackItemTo(tl, &telemetry.Item{Kind: telemetry.RequestItem, ID: fmt.Sprintf("request-%v", i), Method: "GET", URI: "/orders"})
+			}
+
+			stl := tl.(*streamTraceListener)
+			_, first := stl.parent("request-0")
+			_, last := stl.parent(fmt.Sprintf("request-%v", maxParents))
+
+			if len(stl.parents) == maxParents && !first && last {
+				t.Logf("\t\t[%v] The oldest trace is forgotten to make room for the newest.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The oldest trace is forgotten to make room for the newest. Actual: %v parents", ballotX, len(stl.parents))
+			}
+		}
+	}
+}
+
+func TestDurationTracesAreOnlyWrittenOnce(t *testing.T) {
+	start := time.Date(2020, time.March, 4, 9, 30, 15, 0, time.UTC)
+	expectedOutput := "Mar  4 09:30:15.000 [INF]: REQUEST: GET /orders\n" +
+		"Mar  4 09:30:15.250 [INF]: REQUEST: GET /orders, Duration: 250ms, Success\n"
+	actualOutput := ""
+	tw := newTestWriter(func(s string) { actualOutput += s })
+
+	t.Log("Given a StreamTraceListener using a manual clock")
+	{
+		clock := telemetrytest.NewManualClock(start)
+		tl := NewStreamTraceListener(telemetry.Verbose, &tw, telemetry.WithClock(clock))
+		request := tl.TrackRequest("GET", "/orders")
+		clock.Advance(100 * time.Millisecond)
+
+		t.Log("\tWhen the trace is not yet done")
+		{
+			if !(*request).Finished() && (*request).Duration() == 100*time.Millisecond {
+				t.Logf("\t\t[%v] The duration is the time elapsed so far.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The duration is the time elapsed so far. Actual: %v", ballotX, (*request).Duration())
+			}
+		}
+
+		t.Log("\tWhen the trace is done twice and failed in between")
+		{
+			clock.Advance(150 * time.Millisecond)
+			(*request).Complete()
+			(*request).Done()
+			clock.Advance(time.Second)
+			(*request).Fail("500")
+			(*request).Done()
+
+			tl.Close()
+
+			if actualOutput == expectedOutput {
+				t.Logf("\t\t[%v] The trace is written once.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The trace is written once. Expected: \"%v\", Actual: \"%v\"", ballotX, expectedOutput, actualOutput)
+			}
+
+			if (*request).Finished() && (*request).Duration() == 250*time.Millisecond {
+				t.Logf("\t\t[%v] The duration is fixed when the trace is done.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The duration is fixed when the trace is done. Actual: %v", ballotX, (*request).Duration())
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+type syslogDurationTrace struct {
+	telemetry.TraceState
+	traceListener *syslogTraceListener
+	statusCode    string
+	success       bool
+	reported      bool
+	startTime     time.Time
+	msgID         string
+	output        string
+	properties    []property
+	details       telemetry.Item
+	item          telemetry.Item
+}
+
+// Complete indicates a successful completion of the measured duration activity
+func (sdt *syslogDurationTrace) Complete() {
+	sdt.Update("Complete", func() {
+		sdt.reported = true
+		sdt.success = true
+		sdt.statusCode = "OK"
+	})
+}
+
+// Fail indicates an unsuccessful completion of the measured duration activity
+func (sdt *syslogDurationTrace) Fail(statusCode string) {
+	sdt.Update("Fail", func() {
+		sdt.reported = true
+		sdt.success = false
+		sdt.statusCode = statusCode
+	})
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (sdt *syslogDurationTrace) CompleteWithStatus(statusCode string) {
+	sdt.Update("CompleteWithStatus", func() {
+		sdt.reported = true
+		sdt.success = true
+		sdt.statusCode = statusCode
+	})
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code
+func (sdt *syslogDurationTrace) SetStatusCode(code int) {
+	sdt.Update("SetStatusCode", func() {
+		sdt.reported = true
+		sdt.success = telemetry.IsSuccessStatusCode(code)
+		sdt.statusCode = strconv.Itoa(code)
+	})
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity, whose "parentId" is the "id" of this trace
+func (sdt *syslogDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var child *telemetry.Item
+
+	started := sdt.Update("StartChild", func() {
+		if sdt.item.ID == "" {
+			sdt.item.ID = telemetry.NewSpanID()
+			sdt.properties = append(sdt.properties, property{"id", sdt.item.ID})
+		}
+
+		child = telemetry.NewChildItem(&sdt.item, name)
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return sdt.traceListener.TrackItem(child)
+}
+
+// SetProperty sets a custom named value of the measured duration activity
+func (sdt *syslogDurationTrace) SetProperty(name string, value string) {
+	sdt.Update("SetProperty", func() { sdt.details.SetProperty(name, value) })
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+func (sdt *syslogDurationTrace) SetMeasurement(name string, value float64) {
+	sdt.Update("SetMeasurement", func() { sdt.details.SetMeasurement(name, value) })
+}
+
+// SetSource sets the source of a request
+func (sdt *syslogDurationTrace) SetSource(source string) {
+	sdt.Update("SetSource", func() { sdt.details.Source = source })
+}
+
+// SetURL sets the full URL of a request
+func (sdt *syslogDurationTrace) SetURL(url string) {
+	sdt.Update("SetURL", func() { sdt.details.URL = url })
+}
+
+// SetData sets the command of a dependency call
+func (sdt *syslogDurationTrace) SetData(data string) {
+	sdt.Update("SetData", func() { sdt.details.Data = data })
+}
+
+// SetRunLocation sets where an availability test ran
+func (sdt *syslogDurationTrace) SetRunLocation(location string) {
+	sdt.Update("SetRunLocation", func() { sdt.details.RunLocation = location })
+}
+
+// Done indicates that the trace is complete and should be committed to the telemetry source
+func (sdt *syslogDurationTrace) Done() {
+	sdt.DoneAt(sdt.traceListener.clock.Now())
+}
+
+// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source. A trace which was neither
+// completed nor failed is written as a warning. A trace is only written once.
+func (sdt *syslogDurationTrace) DoneAt(end time.Time) {
+	if !sdt.Finish(end) {
+		return
+	}
+
+	duration := end.Sub(sdt.startTime)
+	properties := append(append([]property{}, sdt.properties...), detailProperties(&sdt.details)...)
+	properties = append(properties,
+		property{"durationMs", strconv.FormatInt(duration.Milliseconds(), 10)},
+		property{"success", strconv.FormatBool(sdt.success)},
+		property{"status", sdt.statusCode})
+
+	if !sdt.reported {
+		sdt.traceListener.writeAt(end, telemetry.Warning, sdt.msgID, properties, fmt.Sprintf("%v, Duration: %vms, Incomplete: done without Complete or Fail", sdt.output, duration.Milliseconds()))
+	} else if sdt.success {
+		sdt.traceListener.writeAt(end, telemetry.Information, sdt.msgID, properties, fmt.Sprintf("%v, Duration: %vms, Success", sdt.output, duration.Milliseconds()))
+	} else {
+		sdt.traceListener.writeAt(end, telemetry.Error, sdt.msgID, properties, fmt.Sprintf("%v, Duration: %vms, Failed: %v", sdt.output, duration.Milliseconds(), sdt.statusCode))
+	}
+}
+
+// detailProperties converts the kind-specific details, properties and measurements set on a trace to structured data parameters, the
+// properties and measurements in name order
+func detailProperties(details *telemetry.Item) []property {
+	var properties []property
+
+	for _, detail := range []property{{"source", details.Source}, {"url", details.URL}, {"data", details.Data}, {"runLocation", details.RunLocation}} {
+		if detail.value != "" {
+			properties = append(properties, detail)
+		}
+	}
+
+	measurements := make(map[string]string, len(details.Measurements))
+	for name, value := range details.Measurements {
+		measurements[name] = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	return withProperties(withProperties(properties, details.Properties), measurements)
+}
@@ -0,0 +1,354 @@
+package syslog
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	// structuredDataID is the SD-ID used for the telemetry properties of each message
+	structuredDataID string = "telemetry@32473"
+
+	nilValue string = "-"
+)
+
+// Facility provides constants for the syslog facility that messages are logged under.
+type Facility int32
+
+const (
+	// Kern represents kernel messages
+	Kern Facility = 0
+
+	// User represents user-level messages
+	User Facility = 1
+
+	// Mail represents the mail system
+	Mail Facility = 2
+
+	// Daemon represents system daemons
+	Daemon Facility = 3
+
+	// Auth represents security/authorization messages
+	Auth Facility = 4
+
+	// Syslog represents messages generated internally by syslogd
+	Syslog Facility = 5
+
+	// Local0 represents local use 0
+	Local0 Facility = 16
+
+	// Local1 represents local use 1
+	Local1 Facility = 17
+
+	// Local2 represents local use 2
+	Local2 Facility = 18
+
+	// Local3 represents local use 3
+	Local3 Facility = 19
+
+	// Local4 represents local use 4
+	Local4 Facility = 20
+
+	// Local5 represents local use 5
+	Local5 Facility = 21
+
+	// Local6 represents local use 6
+	Local6 Facility = 22
+
+	// Local7 represents local use 7
+	Local7 Facility = 23
+)
+
+type syslogTraceListener struct {
+	loggingLevel telemetry.Severity
+	facility     Facility
+	hostname     string
+	appName      string
+	procID       string
+	writer       *syslogWriter
+	clock        telemetry.Clock
+}
+
+// property is a single structured data parameter
+type property struct {
+	name  string
+	value string
+}
+
+// NewSyslogTraceListener creates a trace listener which outputs RFC 5424 formatted messages to a syslog daemon. The network may be "unix", "unixgram",
+// "udp" or "tcp"; an empty network and address use the local daemon socket (e.g. /dev/log). It limits output based on the logging level supplied
+func NewSyslogTraceListener(loggingLevel telemetry.Severity, network, address string, facility Facility, appName string, options ...telemetry.ListenerOption) (telemetry.TraceListener, error) {
+	settings := telemetry.NewListenerOptions(options...)
+
+	writer, err := newSyslogWriter(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = nilValue
+	}
+
+	if appName == "" {
+		appName = os.Args[0]
+	}
+
+	traceListener := syslogTraceListener{
+		loggingLevel: loggingLevel,
+		facility:     facility,
+		hostname:     toHeaderField(hostname, 255),
+		appName:      toHeaderField(appName, 48),
+		procID:       strconv.Itoa(os.Getpid()),
+		writer:       writer,
+		clock:        settings.Clock,
+	}
+
+	return &traceListener, nil
+}
+
+func (stl *syslogTraceListener) TraceMessage(message string, severity telemetry.Severity) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
+
+func (stl *syslogTraceListener) TraceException(err error) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
+}
+
+func (stl *syslogTraceListener) TracePanic(rethrow bool) {
+	if r := recover(); r != nil {
+		stl.write(telemetry.Critical, "panic", nil, fmt.Sprint(r))
+
+		if rethrow {
+			panic(r)
+		}
+	}
+}
+
+func (stl *syslogTraceListener) TrackAvailability(name string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.AvailabilityItem, Name: name})
+}
+
+func (stl *syslogTraceListener) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: method, URI: uri})
+}
+
+func (stl *syslogTraceListener) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return stl.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
+
+func (stl *syslogTraceListener) TraceMetric(name string, value float64) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.MetricItem, Name: name, Value: value})
+}
+
+func (stl *syslogTraceListener) TraceEvent(name string) {
+	stl.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: name})
+}
+
+// TraceItem writes the item, with its properties as structured data parameters
+func (stl *syslogTraceListener) TraceItem(item *telemetry.Item) {
+	timestamp := item.Time(stl.clock)
+
+	switch item.Kind {
+	case telemetry.MessageItem:
+		stl.writeAt(timestamp, item.Severity, "message", withProperties(nil, item.Properties), item.Message)
+	case telemetry.ExceptionItem:
+		stl.writeAt(timestamp, telemetry.Error, "exception", withProperties(nil, item.Properties), item.Err.Error())
+	case telemetry.MetricItem:
+		properties := []property{{"name", item.Name}, {"value", strconv.FormatFloat(item.Value, 'g', -1, 64)}}
+		stl.writeAt(timestamp, telemetry.Information, "metric", withProperties(properties, item.Properties), fmt.Sprintf("METRIC: '%v': %v", item.Name, item.Value))
+	case telemetry.EventItem:
+		stl.writeAt(timestamp, telemetry.Verbose, "event", withProperties([]property{{"name", item.Name}}, item.Properties), fmt.Sprintf("EVENT: %v", item.Name))
+	}
+}
+
+// TrackItem creates a tracking of the item, with its properties as structured data parameters. The "id" and "parentId" parameters relate
+// the traces started within another to it.
+func (stl *syslogTraceListener) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	var msgID, output string
+	var properties []property
+
+	switch item.Kind {
+	case telemetry.AvailabilityItem:
+		msgID, output = "availability", fmt.Sprintf("AVAILABILITY: %v", item.Name)
+		properties = []property{{"name", item.Name}}
+	case telemetry.RequestItem:
+		msgID, output = "request", fmt.Sprintf("REQUEST: %v %v", item.Method, item.URI)
+		properties = []property{{"method", item.Method}, {"uri", item.URI}}
+	case telemetry.DependencyItem:
+		msgID, output = "dependency", fmt.Sprintf("DEPENDENCY: %v (%v) %v", item.Name, item.DependencyType, item.Target)
+		properties = []property{{"name", item.Name}, {"type", item.DependencyType}, {"target", item.Target}}
+	default:
+		return telemetry.NoopDurationTrace()
+	}
+
+	if item.ID != "" {
+		properties = append(properties, property{"id", item.ID})
+	}
+
+	if item.ParentID != "" {
+		properties = append(properties, property{"parentId", item.ParentID})
+	}
+
+	durationTrace := stl.newDurationTrace(item, msgID, output, withProperties(properties, item.Properties), item.Time(stl.clock))
+
+	return &durationTrace
+}
+
+func (stl *syslogTraceListener) Flush() {
+	// Unused
+}
+
+func (stl *syslogTraceListener) Close() {
+	_ = stl.writer.Close()
+}
+
+func (stl *syslogTraceListener) newDurationTrace(item *telemetry.Item, msgID string, output string, properties []property, startTime time.Time) telemetry.DurationTrace {
+	stl.writeAt(startTime, telemetry.Information, msgID, properties, output)
+
+	return &syslogDurationTrace{
+		TraceState:    telemetry.NewTraceState(item.Describe(), stl.clock, startTime),
+		traceListener: stl,
+		item:          *item.Clone(),
+		msgID:         msgID,
+		output:        output,
+		properties:    properties,
+		startTime:     startTime,
+		statusCode:    "Incomplete",
+		success:       false,
+	}
+}
+
+// write formats and sends the message if the severity is within the logging level
+func (stl *syslogTraceListener) write(severity telemetry.Severity, msgID string, properties []property, message string) {
+	stl.writeAt(stl.clock.Now(), severity, msgID, properties, message)
+}
+
+// writeAt formats and sends the message, timestamped at the specified time, if the severity is within the logging level
+func (stl *syslogTraceListener) writeAt(timestamp time.Time, severity telemetry.Severity, msgID string, properties []property, message string) {
+	if severity < stl.loggingLevel {
+		return
+	}
+
+	if err := stl.writer.Write(stl.format(timestamp, severity, msgID, properties, message)); err != nil {
+		telemetry.ReportDiagnostic(fmt.Errorf("unable to write the message to syslog: %w", err))
+	}
+}
+
+// format creates the RFC 5424 representation of the message
+func (stl *syslogTraceListener) format(timestamp time.Time, severity telemetry.Severity, msgID string, properties []property, message string) string {
+	priority := int(stl.facility)*8 + toSyslogSeverity(severity)
+
+	return fmt.Sprintf("<%d>1 %v %v %v %v %v %v %v",
+		priority,
+		timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+		stl.hostname,
+		stl.appName,
+		stl.procID,
+		toHeaderField(msgID, 32),
+		toStructuredData(properties),
+		message)
+}
+
+// withProperties appends the item's custom properties, in name order, to the standard properties
+func withProperties(properties []property, custom map[string]string) []property {
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		properties = append(properties, property{name, custom[name]})
+	}
+
+	return properties
+}
+
+// toSyslogSeverity converts the Severity to the syslog severity code
+func toSyslogSeverity(severity telemetry.Severity) int {
+	switch severity {
+	case telemetry.Verbose:
+		return 7 // debug
+	case telemetry.Information:
+		return 6 // info
+	case telemetry.Warning:
+		return 4 // warning
+	case telemetry.Error:
+		return 3 // err
+	case telemetry.Critical:
+		return 2 // crit
+	default:
+		return 5 // notice
+	}
+}
+
+// toHeaderField restricts the value to the printable US-ASCII characters allowed in a header field, truncated to the maximum length
+func toHeaderField(value string, maxLength int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+
+		return r
+	}, value)
+
+	if field == "" {
+		return nilValue
+	}
+
+	if len(field) > maxLength {
+		field = field[:maxLength]
+	}
+
+	return field
+}
+
+// toStructuredData renders the properties as a single SD-ELEMENT
+func toStructuredData(properties []property) string {
+	if len(properties) == 0 {
+		return nilValue
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("[")
+	builder.WriteString(structuredDataID)
+
+	for _, p := range properties {
+		fmt.Fprintf(&builder, " %v=\"%v\"", toParamName(p.name), escapeParamValue(p.value))
+	}
+
+	builder.WriteString("]")
+
+	return builder.String()
+}
+
+// toParamName restricts the name to the characters allowed in an SD-NAME
+func toParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+
+		return r
+	}, name)
+
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	return name
+}
+
+// escapeParamValue escapes the characters which must be escaped in a PARAM-VALUE
+func escapeParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
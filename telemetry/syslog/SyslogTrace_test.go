@@ -0,0 +1,364 @@
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+var (
+	rfc5424Pattern = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ (\S+) (\d+) (\S+) (-|\[.*\]) (.*)$`)
+)
+
+// packetServer receives syslog datagrams from UDP or unixgram sockets
+type packetServer struct {
+	conn     net.PacketConn
+	messages chan string
+}
+
+func newPacketServer(t *testing.T, network, address string) *packetServer {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Fatalf("Unable to listen on %v %v: %v", network, address, err)
+	}
+
+	server := &packetServer{conn: conn, messages: make(chan string, 100)}
+
+	go func() {
+		buffer := make([]byte, 65536)
+
+		for {
+			n, _, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			server.messages <- string(buffer[:n])
+		}
+	}()
+
+	return server
+}
+
+// streamServer receives octet-counted syslog messages over TCP
+type streamServer struct {
+	listener    net.Listener
+	messages    chan string
+	connections chan net.Conn
+}
+
+func newStreamServer(t *testing.T) *streamServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen on tcp: %v", err)
+	}
+
+	server := &streamServer{listener: listener, messages: make(chan string, 100), connections: make(chan net.Conn, 10)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			server.connections <- conn
+			go server.receive(conn)
+		}
+	}()
+
+	return server
+}
+
+func (ss *streamServer) receive(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	for {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			ss.messages <- fmt.Sprintf("invalid frame length '%v'", length)
+			return
+		}
+
+		buffer := make([]byte, n)
+		if _, err := io.ReadFull(reader, buffer); err != nil {
+			return
+		}
+
+		ss.messages <- string(buffer)
+	}
+}
+
+func receive(messages chan string) string {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(2 * time.Second):
+		return ""
+	}
+}
+
+func TestSeveritiesAreMappedToSyslogPriorities(t *testing.T) {
+	server := newPacketServer(t, "udp", "127.0.0.1:0")
+	defer server.conn.Close()
+
+	t.Log("Given a SyslogTraceListener over UDP with the 'Local0' facility and a minimum severity of 'Verbose'")
+	{
+		tl, err := NewSyslogTraceListener(telemetry.Verbose, "udp", server.conn.LocalAddr().String(), Local0, "my-app")
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should connect. Error: %v", ballotX, err)
+		}
+
+		defer tl.Close()
+
+		expected := map[telemetry.Severity]int{
+			telemetry.Critical:    130, // local0.crit
+			telemetry.Error:       131, // local0.err
+			telemetry.Warning:     132, // local0.warning
+			telemetry.Information: 134, // local0.info
+			telemetry.Verbose:     135, // local0.debug
+		}
+
+		for severity := telemetry.Verbose; severity <= telemetry.Critical; severity++ {
+			t.Logf("\tWhen a '%v' severity message is traced", severity.ToString())
+			{
+				tl.TraceMessage("Test message", severity)
+				match := rfc5424Pattern.FindStringSubmatch(receive(server.messages))
+
+				if match != nil && match[1] == strconv.Itoa(expected[severity]) {
+					t.Logf("\t\t[%v] The message has the priority %v.", checkMark, expected[severity])
+				} else {
+					t.Errorf("\t\t[%v] The message has the priority %v. Actual: %v", ballotX, expected[severity], match)
+				}
+			}
+		}
+	}
+}
+
+func TestMessagesAreFormattedAsRFC5424(t *testing.T) {
+	server := newPacketServer(t, "udp", "127.0.0.1:0")
+	defer server.conn.Close()
+
+	t.Log("Given a SyslogTraceListener over UDP with the app-name 'my app'")
+	{
+		tl, err := NewSyslogTraceListener(telemetry.Verbose, "udp", server.conn.LocalAddr().String(), User, "my app")
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should connect. Error: %v", ballotX, err)
+		}
+
+		defer tl.Close()
+
+		t.Log("\tWhen a metric is traced")
+		{
+			tl.TraceMetric(`queue "depth"`, 12.5)
+			message := receive(server.messages)
+			match := rfc5424Pattern.FindStringSubmatch(message)
+
+			if match == nil {
+				t.Fatalf("\t\t[%v] The message is RFC 5424 formatted. Actual: \"%v\"", ballotX, message)
+			}
+
+			if match[2] == "my_app" && match[3] == strconv.Itoa(os.Getpid()) && match[4] == "metric" {
+				t.Logf("\t\t[%v] The header carries the app-name, procid and msgid.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The header carries the app-name, procid and msgid. Actual: \"%v\"", ballotX, message)
+			}
+
+			expectedData := `[telemetry@32473 name="queue \"depth\"" value="12.5"]`
+			if match[5] == expectedData {
+				t.Logf("\t\t[%v] The properties are written as structured data.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The properties are written as structured data. Expected: '%v', Actual: '%v'", ballotX, expectedData, match[5])
+			}
+		}
+
+		t.Log("\tWhen a failed dependency is tracked")
+		{
+			dt := tl.TrackDependency("db", "SQL", "server")
+			receive(server.messages) // Discard the start message
+
+			(*dt).Fail("500")
+			(*dt).Done()
+			message := receive(server.messages)
+
+			if strings.HasPrefix(message, "<11>1 ") && strings.Contains(message, `type="SQL" target="server" durationMs="`) && strings.Contains(message, `success="false" status="500"]`) {
+				t.Logf("\t\t[%v] The outcome is written as an error with structured data.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The outcome is written as an error with structured data. Actual: \"%v\"", ballotX, message)
+			}
+		}
+	}
+}
+
+func TestLoggingLevelIsRespected(t *testing.T) {
+	server := newPacketServer(t, "udp", "127.0.0.1:0")
+	defer server.conn.Close()
+
+	t.Log("Given a SyslogTraceListener with a minimum severity of 'Error'")
+	{
+		tl, err := NewSyslogTraceListener(telemetry.Error, "udp", server.conn.LocalAddr().String(), User, "app")
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should connect. Error: %v", ballotX, err)
+		}
+
+		defer tl.Close()
+
+		t.Log("\tWhen a 'Warning' and then an 'Error' message are traced")
+		{
+			tl.TraceMessage("Warning message", telemetry.Warning)
+			tl.TraceMessage("Error message", telemetry.Error)
+			message := receive(server.messages)
+
+			if strings.HasSuffix(message, " Error message") {
+				t.Logf("\t\t[%v] Only the 'Error' message is written.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Only the 'Error' message is written. Actual: \"%v\"", ballotX, message)
+			}
+		}
+	}
+}
+
+func TestUnixDatagramSocketIsSupported(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log")
+	server := newPacketServer(t, "unixgram", socket)
+	defer server.conn.Close()
+
+	t.Log("Given a SyslogTraceListener with no network, addressing a local daemon socket")
+	{
+		tl, err := NewSyslogTraceListener(telemetry.Verbose, "", socket, User, "app")
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should connect. Error: %v", ballotX, err)
+		}
+
+		defer tl.Close()
+
+		t.Log("\tWhen a message is traced")
+		{
+			tl.TraceMessage("Test message", telemetry.Information)
+			message := receive(server.messages)
+
+			if strings.HasPrefix(message, "<14>1 ") && strings.HasSuffix(message, " Test message") {
+				t.Logf("\t\t[%v] The message is written to the socket.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The message is written to the socket. Actual: \"%v\"", ballotX, message)
+			}
+		}
+	}
+}
+
+func TestTCPUsesOctetCountingAndReconnects(t *testing.T) {
+	server := newStreamServer(t)
+	defer server.listener.Close()
+
+	t.Log("Given a SyslogTraceListener over TCP")
+	{
+		tl, err := NewSyslogTraceListener(telemetry.Verbose, "tcp", server.listener.Addr().String(), User, "app")
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should connect. Error: %v", ballotX, err)
+		}
+
+		defer tl.Close()
+
+		t.Log("\tWhen a message is traced")
+		{
+			tl.TraceMessage("First message", telemetry.Information)
+			message := receive(server.messages)
+
+			if strings.HasSuffix(message, " First message") {
+				t.Logf("\t\t[%v] The octet-counted frame is received intact.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The octet-counted frame is received intact. Actual: \"%v\"", ballotX, message)
+			}
+		}
+
+		t.Log("\tWhen the server drops the connection")
+		{
+			(<-server.connections).Close()
+
+			received := ""
+			for i := 0; i < 20 && received == ""; i++ {
+				tl.TraceMessage("Message after reconnect", telemetry.Information)
+
+				select {
+				case received = <-server.messages:
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+
+			if strings.HasSuffix(received, " Message after reconnect") {
+				t.Logf("\t\t[%v] The listener reconnects and delivers later messages.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The listener reconnects and delivers later messages. Actual: \"%v\"", ballotX, received)
+			}
+		}
+	}
+}
+
+func TestFailedWritesAreReported(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log")
+	server := newPacketServer(t, "unixgram", socket)
+
+	var reported []error
+	telemetry.SetDiagnosticsHandler(func(err error) { reported = append(reported, err) })
+	defer telemetry.SetDiagnosticsHandler(nil)
+
+	t.Log("Given a SyslogTraceListener whose daemon has gone away")
+	{
+		tl, err := NewSyslogTraceListener(telemetry.Verbose, "", socket, User, "app")
+		if err != nil {
+			t.Fatalf("\t[%v] The listener should connect. Error: %v", ballotX, err)
+		}
+
+		defer tl.Close()
+
+		server.conn.Close()
+		_ = os.Remove(socket)
+
+		t.Log("\tWhen a message is traced")
+		{
+			tl.TraceMessage("Lost message", telemetry.Information)
+
+			if len(reported) == 1 && strings.HasPrefix(reported[0].Error(), "unable to write the message to syslog") {
+				t.Logf("\t\t[%v] The failure is reported to the diagnostics handler.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The failure is reported to the diagnostics handler. Actual: %v", ballotX, reported)
+			}
+		}
+	}
+}
+
+func TestUnsupportedNetworkIsRejected(t *testing.T) {
+	t.Log("Given the SyslogTraceListener constructor")
+	{
+		t.Log("\tWhen an unsupported network is supplied")
+		{
+			_, err := NewSyslogTraceListener(telemetry.Verbose, "ip4:1", "127.0.0.1", User, "app")
+
+			if err != nil {
+				t.Logf("\t\t[%v] An error is returned.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] An error is returned.", ballotX)
+			}
+		}
+	}
+}
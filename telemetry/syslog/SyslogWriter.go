@@ -0,0 +1,139 @@
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout  time.Duration = 5 * time.Second
+	writeTimeout time.Duration = 5 * time.Second
+)
+
+var (
+	// localSocketPaths are the well-known locations of the local syslog daemon socket
+	localSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+// syslogWriter is the transport to the syslog daemon. It frames each message for the network in use and reconnects when a write fails.
+type syslogWriter struct {
+	mutex   sync.Mutex
+	network string
+	address string
+	conn    net.Conn
+}
+
+// newSyslogWriter creates a new instance of the syslogWriter and connects to the daemon. An empty network and address connect to the local daemon socket.
+func newSyslogWriter(network, address string) (*syslogWriter, error) {
+	switch network {
+	case "", "unix", "unixgram", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("syslog: unsupported network '%v'", network)
+	}
+
+	writer := &syslogWriter{network: network, address: address}
+
+	if err := writer.connect(); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// Write sends the message to the daemon, reconnecting and retrying once if the write fails
+func (sw *syslogWriter) Write(message string) error {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	if sw.conn != nil {
+		if err := sw.write(message); err == nil {
+			return nil
+		}
+	}
+
+	if err := sw.connect(); err != nil {
+		return err
+	}
+
+	return sw.write(message)
+}
+
+// Close closes the connection to the daemon
+func (sw *syslogWriter) Close() error {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	if sw.conn == nil {
+		return nil
+	}
+
+	err := sw.conn.Close()
+	sw.conn = nil
+
+	return err
+}
+
+// connect (re)establishes the connection to the daemon. Callers must hold the mutex, or own the writer exclusively.
+func (sw *syslogWriter) connect() error {
+	if sw.conn != nil {
+		_ = sw.conn.Close()
+		sw.conn = nil
+	}
+
+	if sw.network != "" {
+		conn, err := net.DialTimeout(sw.network, sw.address, dialTimeout)
+		if err != nil {
+			return fmt.Errorf("syslog: unable to connect to %v://%v: %w", sw.network, sw.address, err)
+		}
+
+		sw.conn = conn
+		return nil
+	}
+
+	// Discover the local daemon, remembering what worked so that reconnects go straight to it
+	paths := localSocketPaths
+	if sw.address != "" {
+		paths = []string{sw.address}
+	}
+
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.DialTimeout(network, path, dialTimeout); err == nil {
+				sw.conn = conn
+				sw.network = network
+				sw.address = path
+				return nil
+			}
+		}
+	}
+
+	return errors.New("syslog: unable to connect to the local syslog daemon")
+}
+
+// write frames the message for the connected network and writes it
+func (sw *syslogWriter) write(message string) error {
+	var frame string
+
+	switch sw.network {
+	case "tcp", "tcp4", "tcp6":
+		// RFC 6587 octet-counting framing
+		frame = fmt.Sprintf("%d %v", len(message), message)
+	case "unix":
+		// Stream sockets on the local machine expect newline delimited messages
+		frame = strings.TrimSuffix(message, "\n") + "\n"
+	default:
+		// Datagrams carry exactly one message each
+		frame = message
+	}
+
+	if err := sw.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+
+	_, err := sw.conn.Write([]byte(frame))
+	return err
+}
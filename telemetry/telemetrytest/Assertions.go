@@ -0,0 +1,195 @@
+package telemetrytest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// FindMessages returns the recorded messages with the severity which contain the substring
+func (r *Recorder) FindMessages(severity telemetry.Severity, substring string) []Message {
+	messages := make([]Message, 0)
+
+	for _, message := range r.Messages() {
+		if message.Severity == severity && strings.Contains(message.Message, substring) {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
+
+// FindExceptions returns the recorded errors whose text contains the substring
+func (r *Recorder) FindExceptions(substring string) []error {
+	exceptions := make([]error, 0)
+
+	for _, err := range r.Exceptions() {
+		if strings.Contains(err.Error(), substring) {
+			exceptions = append(exceptions, err)
+		}
+	}
+
+	return exceptions
+}
+
+// FindMetrics returns the recorded values of the named metric
+func (r *Recorder) FindMetrics(name string) []float64 {
+	values := make([]float64, 0)
+
+	for _, metric := range r.Metrics() {
+		if metric.Name == name {
+			values = append(values, metric.Value)
+		}
+	}
+
+	return values
+}
+
+// FindTraces returns snapshots of the recorded duration traces of the kind with the name. Request traces are named "<method> <uri>".
+func (r *Recorder) FindTraces(kind TraceKind, name string) []Trace {
+	traces := make([]Trace, 0)
+
+	for _, trace := range r.tracesOfKind(kind) {
+		if trace.Name == name {
+			traces = append(traces, trace)
+		}
+	}
+
+	return traces
+}
+
+// AssertMessage reports an error if no message with the severity containing the substring was recorded
+func (r *Recorder) AssertMessage(tb testing.TB, severity telemetry.Severity, substring string) bool {
+	tb.Helper()
+
+	if len(r.FindMessages(severity, substring)) == 0 {
+		tb.Errorf("Expected a '%v' message containing \"%v\". Recorded messages: %v", severity.ToString(), substring, r.Messages())
+		return false
+	}
+
+	return true
+}
+
+// AssertNoMessage reports an error if a message with the severity containing the substring was recorded
+func (r *Recorder) AssertNoMessage(tb testing.TB, severity telemetry.Severity, substring string) bool {
+	tb.Helper()
+
+	if found := r.FindMessages(severity, substring); len(found) > 0 {
+		tb.Errorf("Expected no '%v' message containing \"%v\". Found: %v", severity.ToString(), substring, found)
+		return false
+	}
+
+	return true
+}
+
+// AssertException reports an error if no error containing the substring was recorded
+func (r *Recorder) AssertException(tb testing.TB, substring string) bool {
+	tb.Helper()
+
+	if len(r.FindExceptions(substring)) == 0 {
+		tb.Errorf("Expected an exception containing \"%v\". Recorded exceptions: %v", substring, r.Exceptions())
+		return false
+	}
+
+	return true
+}
+
+// AssertMetric reports an error if the named metric was not recorded with the value
+func (r *Recorder) AssertMetric(tb testing.TB, name string, value float64) bool {
+	tb.Helper()
+
+	values := r.FindMetrics(name)
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	tb.Errorf("Expected metric '%v' with value %v. Recorded values: %v", name, value, values)
+	return false
+}
+
+// AssertEvent reports an error if the named event was not recorded
+func (r *Recorder) AssertEvent(tb testing.TB, name string) bool {
+	tb.Helper()
+
+	for _, event := range r.Events() {
+		if event.Name == name {
+			return true
+		}
+	}
+
+	tb.Errorf("Expected event '%v'. Recorded events: %v", name, r.Events())
+	return false
+}
+
+// AssertAvailabilityCompleted reports an error if the named availability trace was not completed successfully and done
+func (r *Recorder) AssertAvailabilityCompleted(tb testing.TB, name string) bool {
+	tb.Helper()
+
+	return r.assertCompleted(tb, AvailabilityTrace, name)
+}
+
+// AssertAvailabilityFailed reports an error if the named availability trace was not failed with the status code and done
+func (r *Recorder) AssertAvailabilityFailed(tb testing.TB, name string, statusCode string) bool {
+	tb.Helper()
+
+	return r.assertFailed(tb, AvailabilityTrace, name, statusCode)
+}
+
+// AssertRequestCompleted reports an error if the request trace was not completed successfully and done
+func (r *Recorder) AssertRequestCompleted(tb testing.TB, method string, uri string) bool {
+	tb.Helper()
+
+	return r.assertCompleted(tb, RequestTrace, method+" "+uri)
+}
+
+// AssertRequestFailed reports an error if the request trace was not failed with the status code and done
+func (r *Recorder) AssertRequestFailed(tb testing.TB, method string, uri string, statusCode string) bool {
+	tb.Helper()
+
+	return r.assertFailed(tb, RequestTrace, method+" "+uri, statusCode)
+}
+
+// AssertDependencyCompleted reports an error if the named dependency trace was not completed successfully and done
+func (r *Recorder) AssertDependencyCompleted(tb testing.TB, name string) bool {
+	tb.Helper()
+
+	return r.assertCompleted(tb, DependencyTrace, name)
+}
+
+// AssertDependencyFailed reports an error if the named dependency trace was not failed with the status code and done
+func (r *Recorder) AssertDependencyFailed(tb testing.TB, name string, statusCode string) bool {
+	tb.Helper()
+
+	return r.assertFailed(tb, DependencyTrace, name, statusCode)
+}
+
+func (r *Recorder) assertCompleted(tb testing.TB, kind TraceKind, name string) bool {
+	tb.Helper()
+
+	traces := r.FindTraces(kind, name)
+	for _, trace := range traces {
+		if trace.Finished && trace.Success {
+			return true
+		}
+	}
+
+	tb.Errorf("Expected a completed %v trace '%v'. Recorded traces: %+v", kind.ToString(), name, traces)
+	return false
+}
+
+func (r *Recorder) assertFailed(tb testing.TB, kind TraceKind, name string, statusCode string) bool {
+	tb.Helper()
+
+	traces := r.FindTraces(kind, name)
+	for _, trace := range traces {
+		if trace.Finished && !trace.Success && trace.StatusCode == statusCode {
+			return true
+		}
+	}
+
+	tb.Errorf("Expected a %v trace '%v' failed with status '%v'. Recorded traces: %+v", kind.ToString(), name, statusCode, traces)
+	return false
+}
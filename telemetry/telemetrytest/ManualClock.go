@@ -0,0 +1,41 @@
+package telemetrytest
+
+import (
+	"sync"
+	"time"
+)
+
+// ManualClock is a telemetry.Clock which only moves when told to, so that timestamps and durations are deterministic in tests
+type ManualClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewManualClock creates a ManualClock set to the specified time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the time the clock is currently set to
+func (mc *ManualClock) Now() time.Time {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	return mc.now
+}
+
+// Advance moves the clock forward by the duration
+func (mc *ManualClock) Advance(duration time.Duration) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.now = mc.now.Add(duration)
+}
+
+// Set moves the clock to the specified time
+func (mc *ManualClock) Set(now time.Time) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.now = now
+}
@@ -0,0 +1,566 @@
+package telemetrytest
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// TraceKind identifies the kind of activity measured by a recorded duration trace
+type TraceKind int32
+
+const (
+	// AvailabilityTrace represents a trace created by TrackAvailability
+	AvailabilityTrace TraceKind = 0
+
+	// RequestTrace represents a trace created by TrackRequest
+	RequestTrace TraceKind = 1
+
+	// DependencyTrace represents a trace created by TrackDependency
+	DependencyTrace TraceKind = 2
+)
+
+// ToString converts the TraceKind to a readable string
+func (k TraceKind) ToString() string {
+	switch k {
+	case AvailabilityTrace:
+		return "Availability"
+	case RequestTrace:
+		return "Request"
+	case DependencyTrace:
+		return "Dependency"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Message is a recorded message
+type Message struct {
+	Message     string
+	Severity    telemetry.Severity
+	OperationID string
+	SampleRate  float64
+	Properties  map[string]string
+	Timestamp   time.Time
+}
+
+// Metric is a recorded metric
+type Metric struct {
+	Name        string
+	Value       float64
+	OperationID string
+	SampleRate  float64
+	Properties  map[string]string
+	Timestamp   time.Time
+}
+
+// Event is a recorded event
+type Event struct {
+	Name        string
+	OperationID string
+	SampleRate  float64
+	Properties  map[string]string
+	Timestamp   time.Time
+}
+
+// Trace is a recorded duration trace. The outcome fields are updated as the trace is completed, failed and done, so snapshots returned by
+// the Recorder should be retrieved after Done has been called. Incomplete is set if the trace was done without being completed or failed.
+type Trace struct {
+	Kind           TraceKind
+	Name           string
+	Method         string
+	URI            string
+	DependencyType string
+	Target         string
+	ID             string
+	ParentID       string
+	Source         string
+	URL            string
+	Data           string
+	RunLocation    string
+	OperationID    string
+	SampleRate     float64
+	Properties     map[string]string
+	Measurements   map[string]float64
+	StatusCode     string
+	Success        bool
+	Incomplete     bool
+	Finished       bool
+	StartTime      time.Time
+	EndTime        time.Time
+	Duration       time.Duration
+}
+
+// Recorder is a thread-safe, in-memory trace listener which records everything traced to it, for use in tests. It implements
+// telemetry.ItemTraceListener, so the operation and sample rate of each item are recorded too.
+type Recorder struct {
+	mutex      sync.Mutex
+	messages   []Message
+	exceptions []error
+	panics     []interface{}
+	metrics    []Metric
+	events     []Event
+	traces     []*Trace
+	flushes    int
+	closed     bool
+	clock      telemetry.Clock
+}
+
+// NewRecorder creates a new, empty Recorder. Register it with telemetry.AddListener, or use Register. Timestamps and durations are taken from
+// the Clock in the options, such as a ManualClock.
+func NewRecorder(options ...telemetry.ListenerOption) *Recorder {
+	settings := telemetry.NewListenerOptions(options...)
+
+	return &Recorder{clock: settings.Clock}
+}
+
+// Register creates a new Recorder and adds it to the telemetry package listeners. The listeners are closed when the test completes.
+func Register(tb testing.TB, options ...telemetry.ListenerOption) *Recorder {
+	recorder := NewRecorder(options...)
+	var tl telemetry.TraceListener = recorder
+
+	telemetry.AddListener(&tl)
+	tb.Cleanup(telemetry.Close)
+
+	return recorder
+}
+
+// TraceMessage records the message
+func (r *Recorder) TraceMessage(message string, severity telemetry.Severity) {
+	r.TraceItem(&telemetry.Item{Kind: telemetry.MessageItem, Message: message, Severity: severity})
+}
+
+// TraceException records the error
+func (r *Recorder) TraceException(err error) {
+	r.TraceItem(&telemetry.Item{Kind: telemetry.ExceptionItem, Err: err})
+}
+
+// TracePanic records any panic which is being recovered, rethrowing it if requested
+func (r *Recorder) TracePanic(rethrow bool) {
+	if p := recover(); p != nil {
+		r.mutex.Lock()
+		r.panics = append(r.panics, p)
+		r.mutex.Unlock()
+
+		if rethrow {
+			panic(p)
+		}
+	}
+}
+
+// TrackAvailability records the start of an availability trace
+func (r *Recorder) TrackAvailability(name string) *telemetry.DurationTrace {
+	return r.TrackItem(&telemetry.Item{Kind: telemetry.AvailabilityItem, Name: name})
+}
+
+// TrackRequest records the start of a request trace
+func (r *Recorder) TrackRequest(method string, uri string) *telemetry.DurationTrace {
+	return r.TrackItem(&telemetry.Item{Kind: telemetry.RequestItem, Method: method, URI: uri})
+}
+
+// TrackDependency records the start of a dependency trace
+func (r *Recorder) TrackDependency(name string, dependencyType string, target string) *telemetry.DurationTrace {
+	return r.TrackItem(&telemetry.Item{Kind: telemetry.DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
+
+// TraceMetric records the metric
+func (r *Recorder) TraceMetric(name string, value float64) {
+	r.TraceItem(&telemetry.Item{Kind: telemetry.MetricItem, Name: name, Value: value})
+}
+
+// TraceEvent records the event
+func (r *Recorder) TraceEvent(name string) {
+	r.TraceItem(&telemetry.Item{Kind: telemetry.EventItem, Name: name})
+}
+
+// TraceItem records a message, exception, metric or event item
+func (r *Recorder) TraceItem(item *telemetry.Item) {
+	timestamp := item.Time(r.clock)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch item.Kind {
+	case telemetry.MessageItem:
+		r.messages = append(r.messages, Message{
+			Message:     item.Message,
+			Severity:    item.Severity,
+			OperationID: item.OperationID,
+			SampleRate:  item.SampleRate,
+			Properties:  item.Clone().Properties,
+			Timestamp:   timestamp,
+		})
+	case telemetry.ExceptionItem:
+		r.exceptions = append(r.exceptions, item.Err)
+	case telemetry.MetricItem:
+		r.metrics = append(r.metrics, Metric{
+			Name:        item.Name,
+			Value:       item.Value,
+			OperationID: item.OperationID,
+			SampleRate:  item.SampleRate,
+			Properties:  item.Clone().Properties,
+			Timestamp:   timestamp,
+		})
+	case telemetry.EventItem:
+		r.events = append(r.events, Event{
+			Name:        item.Name,
+			OperationID: item.OperationID,
+			SampleRate:  item.SampleRate,
+			Properties:  item.Clone().Properties,
+			Timestamp:   timestamp,
+		})
+	}
+}
+
+// TrackItem records the start of a request, dependency or availability trace
+func (r *Recorder) TrackItem(item *telemetry.Item) *telemetry.DurationTrace {
+	clone := item.Clone()
+	trace := &Trace{
+		ID:           item.ID,
+		ParentID:     item.ParentID,
+		Source:       item.Source,
+		URL:          item.URL,
+		Data:         item.Data,
+		RunLocation:  item.RunLocation,
+		OperationID:  item.OperationID,
+		SampleRate:   item.SampleRate,
+		Properties:   clone.Properties,
+		Measurements: clone.Measurements,
+	}
+
+	switch item.Kind {
+	case telemetry.AvailabilityItem:
+		trace.Kind = AvailabilityTrace
+		trace.Name = item.Name
+	case telemetry.RequestItem:
+		trace.Kind = RequestTrace
+		trace.Name = fmt.Sprintf("%v %v", item.Method, item.URI)
+		trace.Method = item.Method
+		trace.URI = item.URI
+	case telemetry.DependencyItem:
+		trace.Kind = DependencyTrace
+		trace.Name = item.Name
+		trace.DependencyType = item.DependencyType
+		trace.Target = item.Target
+	default:
+		return telemetry.NoopDurationTrace()
+	}
+
+	return r.newDurationTrace(item.Describe(), trace, item.Time(r.clock))
+}
+
+// Flush records that the listener was flushed
+func (r *Recorder) Flush() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.flushes++
+}
+
+// Close records that the listener was closed
+func (r *Recorder) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+}
+
+// Messages returns a copy of the recorded messages
+func (r *Recorder) Messages() []Message {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Message{}, r.messages...)
+}
+
+// Exceptions returns a copy of the recorded errors
+func (r *Recorder) Exceptions() []error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]error{}, r.exceptions...)
+}
+
+// Panics returns a copy of the recorded panic values
+func (r *Recorder) Panics() []interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]interface{}{}, r.panics...)
+}
+
+// Metrics returns a copy of the recorded metrics
+func (r *Recorder) Metrics() []Metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Metric{}, r.metrics...)
+}
+
+// Events returns a copy of the recorded events
+func (r *Recorder) Events() []Event {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]Event{}, r.events...)
+}
+
+// Traces returns snapshots of the recorded duration traces of every kind
+func (r *Recorder) Traces() []Trace {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	traces := make([]Trace, 0, len(r.traces))
+	for _, trace := range r.traces {
+		traces = append(traces, *trace)
+	}
+
+	return traces
+}
+
+// Availabilities returns snapshots of the recorded availability traces
+func (r *Recorder) Availabilities() []Trace {
+	return r.tracesOfKind(AvailabilityTrace)
+}
+
+// Requests returns snapshots of the recorded request traces
+func (r *Recorder) Requests() []Trace {
+	return r.tracesOfKind(RequestTrace)
+}
+
+// Dependencies returns snapshots of the recorded dependency traces
+func (r *Recorder) Dependencies() []Trace {
+	return r.tracesOfKind(DependencyTrace)
+}
+
+// Flushes returns the number of times the listener has been flushed
+func (r *Recorder) Flushes() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.flushes
+}
+
+// Closed indicates whether the listener has been closed
+func (r *Recorder) Closed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.closed
+}
+
+// Reset discards everything recorded so far
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.messages = nil
+	r.exceptions = nil
+	r.panics = nil
+	r.metrics = nil
+	r.events = nil
+	r.traces = nil
+	r.flushes = 0
+	r.closed = false
+}
+
+func (r *Recorder) tracesOfKind(kind TraceKind) []Trace {
+	traces := make([]Trace, 0)
+
+	for _, trace := range r.Traces() {
+		if trace.Kind == kind {
+			traces = append(traces, trace)
+		}
+	}
+
+	return traces
+}
+
+func (r *Recorder) newDurationTrace(description string, trace *Trace, startTime time.Time) *telemetry.DurationTrace {
+	trace.StatusCode = "Incomplete"
+	trace.StartTime = startTime
+
+	r.mutex.Lock()
+	r.traces = append(r.traces, trace)
+	r.mutex.Unlock()
+
+	var durationTrace telemetry.DurationTrace = &recordedDurationTrace{TraceState: telemetry.NewTraceState(description, r.clock, startTime), recorder: r, trace: trace}
+
+	return &durationTrace
+}
+
+// recordedDurationTrace updates the recorded trace as the outcome is reported
+type recordedDurationTrace struct {
+	telemetry.TraceState
+	recorder *Recorder
+	trace    *Trace
+	reported bool
+}
+
+// Complete indicates a successful completion of the measured duration activity
+func (rdt *recordedDurationTrace) Complete() {
+	rdt.Update("Complete", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.Success = true
+		rdt.trace.StatusCode = "OK"
+		rdt.reported = true
+	})
+}
+
+// Fail indicates an unsuccessful completion of the measured duration activity
+func (rdt *recordedDurationTrace) Fail(statusCode string) {
+	rdt.Update("Fail", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.Success = false
+		rdt.trace.StatusCode = statusCode
+		rdt.reported = true
+	})
+}
+
+// CompleteWithStatus indicates a successful completion of the measured duration activity with the status code
+func (rdt *recordedDurationTrace) CompleteWithStatus(statusCode string) {
+	rdt.Update("CompleteWithStatus", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.Success = true
+		rdt.trace.StatusCode = statusCode
+		rdt.reported = true
+	})
+}
+
+// SetStatusCode indicates the completion of the measured duration activity with a numeric status code
+func (rdt *recordedDurationTrace) SetStatusCode(code int) {
+	rdt.Update("SetStatusCode", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.Success = telemetry.IsSuccessStatusCode(code)
+		rdt.trace.StatusCode = strconv.Itoa(code)
+		rdt.reported = true
+	})
+}
+
+// StartChild starts the trace of a named phase of the measured duration activity, which is recorded with this trace's ID as its ParentID
+func (rdt *recordedDurationTrace) StartChild(name string) *telemetry.DurationTrace {
+	var parent telemetry.Item
+
+	started := rdt.Update("StartChild", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		if rdt.trace.ID == "" {
+			rdt.trace.ID = telemetry.NewSpanID()
+		}
+
+		parent = telemetry.Item{OperationID: rdt.trace.OperationID, ID: rdt.trace.ID, SampleRate: rdt.trace.SampleRate}
+	})
+
+	if !started {
+		return telemetry.NoopDurationTrace()
+	}
+
+	return rdt.recorder.TrackItem(telemetry.NewChildItem(&parent, name))
+}
+
+// SetProperty sets a custom named value of the measured duration activity. The properties are copied rather than modified, so that the
+// snapshots already returned by the Recorder are not changed.
+func (rdt *recordedDurationTrace) SetProperty(name string, value string) {
+	rdt.Update("SetProperty", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		properties := make(map[string]string, len(rdt.trace.Properties)+1)
+		for k, v := range rdt.trace.Properties {
+			properties[k] = v
+		}
+
+		properties[name] = value
+		rdt.trace.Properties = properties
+	})
+}
+
+// SetMeasurement sets a custom named numeric measurement of the measured duration activity, copying the measurements as SetProperty does
+func (rdt *recordedDurationTrace) SetMeasurement(name string, value float64) {
+	rdt.Update("SetMeasurement", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		measurements := make(map[string]float64, len(rdt.trace.Measurements)+1)
+		for k, v := range rdt.trace.Measurements {
+			measurements[k] = v
+		}
+
+		measurements[name] = value
+		rdt.trace.Measurements = measurements
+	})
+}
+
+// SetSource sets the source of a request
+func (rdt *recordedDurationTrace) SetSource(source string) {
+	rdt.Update("SetSource", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.Source = source
+	})
+}
+
+// SetURL sets the full URL of a request
+func (rdt *recordedDurationTrace) SetURL(url string) {
+	rdt.Update("SetURL", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.URL = url
+	})
+}
+
+// SetData sets the command of a dependency call
+func (rdt *recordedDurationTrace) SetData(data string) {
+	rdt.Update("SetData", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.Data = data
+	})
+}
+
+// SetRunLocation sets where an availability test ran
+func (rdt *recordedDurationTrace) SetRunLocation(location string) {
+	rdt.Update("SetRunLocation", func() {
+		rdt.recorder.mutex.Lock()
+		defer rdt.recorder.mutex.Unlock()
+
+		rdt.trace.RunLocation = location
+	})
+}
+
+// Done indicates that the trace is complete and should be committed to the telemetry source
+func (rdt *recordedDurationTrace) Done() {
+	rdt.DoneAt(rdt.recorder.clock.Now())
+}
+
+// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source. Only the first call is
+// recorded.
+func (rdt *recordedDurationTrace) DoneAt(endTime time.Time) {
+	if !rdt.Finish(endTime) {
+		return
+	}
+
+	rdt.recorder.mutex.Lock()
+	defer rdt.recorder.mutex.Unlock()
+
+	rdt.trace.Finished = true
+	rdt.trace.Incomplete = !rdt.reported
+	rdt.trace.EndTime = endTime
+	rdt.trace.Duration = endTime.Sub(rdt.trace.StartTime)
+}
@@ -0,0 +1,140 @@
+package telemetrytest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+// failureRecorder is a testing.TB which records failures instead of failing the test
+type failureRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (fr *failureRecorder) Helper() {}
+
+func (fr *failureRecorder) Errorf(format string, args ...interface{}) {
+	fr.failures = append(fr.failures, fmt.Sprintf(format, args...))
+}
+
+func TestRecorderCapturesTelemetry(t *testing.T) {
+	t.Log("Given a Recorder registered with the telemetry package, using a manual clock")
+	{
+		clock := NewManualClock(time.Date(2020, time.March, 4, 9, 30, 0, 0, time.UTC))
+		recorder := Register(t, telemetry.WithClock(clock))
+
+		t.Log("\tWhen every kind of telemetry is traced")
+		{
+			telemetry.TraceWarning("Disk nearly full")
+			telemetry.TraceException(errors.New("connection refused"))
+			telemetry.TraceMetric("queue", 3)
+			telemetry.TraceEvent("started")
+
+			request := telemetry.TrackRequest("GET", "/orders")
+			dependency := telemetry.TrackDependency("db", "SQL", "server")
+			availability := telemetry.TrackAvailability("health")
+
+			clock.Advance(10 * time.Millisecond)
+
+			(*dependency).Fail("500")
+			(*dependency).Done()
+			(*request).Complete()
+			(*request).Done()
+			(*availability).Done()
+
+			if recorder.AssertMessage(t, telemetry.Warning, "nearly full") &&
+				recorder.AssertException(t, "refused") &&
+				recorder.AssertMetric(t, "queue", 3) &&
+				recorder.AssertEvent(t, "started") &&
+				recorder.AssertRequestCompleted(t, "GET", "/orders") &&
+				recorder.AssertDependencyFailed(t, "db", "500") &&
+				recorder.AssertAvailabilityFailed(t, "health", "Incomplete") {
+				t.Logf("\t\t[%v] Everything traced is recorded and found by the assertions.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Everything traced is recorded and found by the assertions.", ballotX)
+			}
+
+			dependencies := recorder.Dependencies()
+			if len(dependencies) == 1 && dependencies[0].Duration == 10*time.Millisecond && dependencies[0].EndTime.Equal(clock.Now()) {
+				t.Logf("\t\t[%v] The timing of the duration trace is recorded.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The timing of the duration trace is recorded. Actual: %+v", ballotX, dependencies)
+			}
+
+			if availabilities := recorder.Availabilities(); len(availabilities) == 1 && availabilities[0].Incomplete && !dependencies[0].Incomplete {
+				t.Logf("\t\t[%v] The trace done without being completed or failed is recorded as incomplete.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The trace done without being completed or failed is recorded as incomplete. Actual: %+v", ballotX, availabilities)
+			}
+		}
+	}
+}
+
+func TestAssertionsReportMismatches(t *testing.T) {
+	t.Log("Given a Recorder with a warning message and a completed dependency")
+	{
+		recorder := NewRecorder()
+		recorder.TraceMessage("Disk nearly full", telemetry.Warning)
+
+		dependency := recorder.TrackDependency("db", "SQL", "server")
+		(*dependency).Complete()
+		(*dependency).Done()
+
+		t.Log("\tWhen assertions are made which do not match")
+		{
+			tb := &failureRecorder{}
+
+			recorder.AssertMessage(tb, telemetry.Error, "nearly full")
+			recorder.AssertNoMessage(tb, telemetry.Warning, "Disk")
+			recorder.AssertDependencyFailed(tb, "db", "500")
+			recorder.AssertMetric(tb, "queue", 1)
+
+			if len(tb.failures) == 4 {
+				t.Logf("\t\t[%v] Each mismatch is reported as a failure.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Each mismatch is reported as a failure. Actual: %v", ballotX, tb.failures)
+			}
+		}
+	}
+}
+
+func TestRecorderIsThreadSafe(t *testing.T) {
+	t.Log("Given a Recorder")
+	{
+		recorder := NewRecorder()
+
+		t.Log("\tWhen messages are traced from many goroutines")
+		{
+			var waitGroup sync.WaitGroup
+
+			for i := 0; i < 50; i++ {
+				waitGroup.Add(1)
+
+				go func(i int) {
+					defer waitGroup.Done()
+
+					recorder.TraceMessage(fmt.Sprintf("Message %v", i), telemetry.Information)
+					_ = recorder.Messages()
+				}(i)
+			}
+
+			waitGroup.Wait()
+
+			if count := len(recorder.Messages()); count == 50 {
+				t.Logf("\t\t[%v] Every message is recorded.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] Every message is recorded. Expected: 50, Actual: %v", ballotX, count)
+			}
+		}
+	}
+}
@@ -0,0 +1,9 @@
+module github.com/phbarton/Telemetry-Go/v2
+
+go 1.21
+
+require github.com/phbarton/Telemetry-Go v0.0.0
+
+// The v2 API runs on the v1 pipeline and listeners, which are developed alongside it in this repository. Replace this with a tagged
+// release of version 1 once one is published.
+replace github.com/phbarton/Telemetry-Go => ../
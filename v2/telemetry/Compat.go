@@ -0,0 +1,264 @@
+package telemetry
+
+import (
+	"time"
+
+	v1 "github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// FromV1Listener adapts a version 1 trace listener, such as those created by the stream, syslog and appinsights packages, to this version.
+// A listener adapted by ToV1Listener is returned unwrapped.
+func FromV1Listener(listener v1.TraceListener) TraceListener {
+	if adapted, ok := listener.(*v1TraceListener); ok {
+		return adapted.listener
+	}
+
+	return &v2TraceListener{listener: listener}
+}
+
+// ToV1Listener adapts a trace listener of this version to version 1, so that it can be added or wrapped by code which has not yet migrated,
+// e.g. by the guard or ratelimit packages. The adapted listener implements v1.ItemTraceListener, so it receives every detail of the items.
+// A listener adapted by FromV1Listener is returned unwrapped.
+func ToV1Listener(listener TraceListener) v1.TraceListener {
+	if adapted, ok := listener.(*v2TraceListener); ok {
+		return adapted.listener
+	}
+
+	return &v1TraceListener{listener: listener}
+}
+
+// FromV1Trace adapts a version 1 duration trace to this version. A nil trace is adapted to a trace which records nothing.
+func FromV1Trace(trace *v1.DurationTrace) DurationTrace {
+	if trace == nil || *trace == nil {
+		return NoopDurationTrace()
+	}
+
+	if adapted, ok := (*trace).(*v1DurationTrace); ok {
+		return adapted.trace
+	}
+
+	return &v2DurationTrace{trace: trace}
+}
+
+// ToV1Trace adapts a duration trace of this version to version 1. A nil trace is adapted to a trace which records nothing.
+func ToV1Trace(trace DurationTrace) *v1.DurationTrace {
+	if trace == nil {
+		return v1.NoopDurationTrace()
+	}
+
+	if adapted, ok := trace.(*v2DurationTrace); ok {
+		return adapted.trace
+	}
+
+	var dt v1.DurationTrace = &v1DurationTrace{trace: trace}
+	return &dt
+}
+
+// v2TraceListener passes the calls of this version to a version 1 listener
+type v2TraceListener struct {
+	listener v1.TraceListener
+}
+
+func (tl *v2TraceListener) Trace(item *Item) {
+	v1.TraceItemTo(tl.listener, item)
+}
+
+func (tl *v2TraceListener) Track(item *Item) DurationTrace {
+	return FromV1Trace(v1.TrackItemTo(tl.listener, item))
+}
+
+func (tl *v2TraceListener) TracePanic(rethrow bool) {
+	tl.listener.TracePanic(rethrow)
+}
+
+func (tl *v2TraceListener) Flush() {
+	tl.listener.Flush()
+}
+
+func (tl *v2TraceListener) Close() {
+	tl.listener.Close()
+}
+
+// v1TraceListener passes the calls of version 1 to a listener of this version
+type v1TraceListener struct {
+	listener TraceListener
+}
+
+func (tl *v1TraceListener) TraceMessage(message string, severity Severity) {
+	tl.listener.Trace(&Item{Kind: MessageItem, Message: message, Severity: severity})
+}
+
+func (tl *v1TraceListener) TraceException(err error) {
+	tl.listener.Trace(&Item{Kind: ExceptionItem, Err: err})
+}
+
+func (tl *v1TraceListener) TracePanic(rethrow bool) {
+	tl.listener.TracePanic(rethrow)
+}
+
+func (tl *v1TraceListener) TrackAvailability(name string) *v1.DurationTrace {
+	return tl.TrackItem(&Item{Kind: AvailabilityItem, Name: name})
+}
+
+func (tl *v1TraceListener) TrackRequest(method string, uri string) *v1.DurationTrace {
+	return tl.TrackItem(&Item{Kind: RequestItem, Method: method, URI: uri})
+}
+
+func (tl *v1TraceListener) TrackDependency(name string, dependencyType string, target string) *v1.DurationTrace {
+	return tl.TrackItem(&Item{Kind: DependencyItem, Name: name, DependencyType: dependencyType, Target: target})
+}
+
+func (tl *v1TraceListener) TraceMetric(name string, value float64) {
+	tl.listener.Trace(&Item{Kind: MetricItem, Name: name, Value: value})
+}
+
+func (tl *v1TraceListener) TraceEvent(name string) {
+	tl.listener.Trace(&Item{Kind: EventItem, Name: name})
+}
+
+func (tl *v1TraceListener) TraceItem(item *Item) {
+	tl.listener.Trace(item)
+}
+
+func (tl *v1TraceListener) TrackItem(item *Item) *v1.DurationTrace {
+	return ToV1Trace(tl.listener.Track(item))
+}
+
+func (tl *v1TraceListener) Flush() {
+	tl.listener.Flush()
+}
+
+func (tl *v1TraceListener) Close() {
+	tl.listener.Close()
+}
+
+// v2DurationTrace passes the calls of this version to a version 1 trace
+type v2DurationTrace struct {
+	trace *v1.DurationTrace
+}
+
+func (dt *v2DurationTrace) Complete() {
+	(*dt.trace).Complete()
+}
+
+func (dt *v2DurationTrace) Fail(statusCode string) {
+	(*dt.trace).Fail(statusCode)
+}
+
+func (dt *v2DurationTrace) CompleteWithStatus(statusCode string) {
+	(*dt.trace).CompleteWithStatus(statusCode)
+}
+
+func (dt *v2DurationTrace) SetStatusCode(code int) {
+	(*dt.trace).SetStatusCode(code)
+}
+
+func (dt *v2DurationTrace) Done() {
+	(*dt.trace).Done()
+}
+
+func (dt *v2DurationTrace) DoneAt(end time.Time) {
+	v1.DoneAt(dt.trace, end)
+}
+
+func (dt *v2DurationTrace) Finished() bool {
+	return (*dt.trace).Finished()
+}
+
+func (dt *v2DurationTrace) Duration() time.Duration {
+	return (*dt.trace).Duration()
+}
+
+func (dt *v2DurationTrace) StartChild(name string) DurationTrace {
+	return FromV1Trace((*dt.trace).StartChild(name))
+}
+
+func (dt *v2DurationTrace) SetProperty(name string, value string) {
+	(*dt.trace).SetProperty(name, value)
+}
+
+func (dt *v2DurationTrace) SetMeasurement(name string, value float64) {
+	(*dt.trace).SetMeasurement(name, value)
+}
+
+func (dt *v2DurationTrace) SetSource(source string) {
+	(*dt.trace).SetSource(source)
+}
+
+func (dt *v2DurationTrace) SetURL(url string) {
+	(*dt.trace).SetURL(url)
+}
+
+func (dt *v2DurationTrace) SetData(data string) {
+	(*dt.trace).SetData(data)
+}
+
+func (dt *v2DurationTrace) SetRunLocation(location string) {
+	(*dt.trace).SetRunLocation(location)
+}
+
+// v1DurationTrace passes the calls of version 1 to a trace of this version. It implements v1.TimedDurationTrace, so asynchronous dispatch
+// keeps the exact end of the trace.
+type v1DurationTrace struct {
+	trace DurationTrace
+}
+
+func (dt *v1DurationTrace) Complete() {
+	dt.trace.Complete()
+}
+
+func (dt *v1DurationTrace) Fail(statusCode string) {
+	dt.trace.Fail(statusCode)
+}
+
+func (dt *v1DurationTrace) CompleteWithStatus(statusCode string) {
+	dt.trace.CompleteWithStatus(statusCode)
+}
+
+func (dt *v1DurationTrace) SetStatusCode(code int) {
+	dt.trace.SetStatusCode(code)
+}
+
+func (dt *v1DurationTrace) Done() {
+	dt.trace.Done()
+}
+
+func (dt *v1DurationTrace) DoneAt(end time.Time) {
+	dt.trace.DoneAt(end)
+}
+
+func (dt *v1DurationTrace) Finished() bool {
+	return dt.trace.Finished()
+}
+
+func (dt *v1DurationTrace) Duration() time.Duration {
+	return dt.trace.Duration()
+}
+
+func (dt *v1DurationTrace) StartChild(name string) *v1.DurationTrace {
+	return ToV1Trace(dt.trace.StartChild(name))
+}
+
+func (dt *v1DurationTrace) SetProperty(name string, value string) {
+	dt.trace.SetProperty(name, value)
+}
+
+func (dt *v1DurationTrace) SetMeasurement(name string, value float64) {
+	dt.trace.SetMeasurement(name, value)
+}
+
+func (dt *v1DurationTrace) SetSource(source string) {
+	dt.trace.SetSource(source)
+}
+
+func (dt *v1DurationTrace) SetURL(url string) {
+	dt.trace.SetURL(url)
+}
+
+func (dt *v1DurationTrace) SetData(data string) {
+	dt.trace.SetData(data)
+}
+
+func (dt *v1DurationTrace) SetRunLocation(location string) {
+	dt.trace.SetRunLocation(location)
+}
@@ -0,0 +1,171 @@
+package telemetry
+
+import (
+	"fmt"
+	"time"
+
+	v1 "github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// DurationTrace measures a tracked request, dependency or availability test. Traces are safe for concurrent use, and are only committed
+// once: calls after Done are ignored and reported as ErrTraceDone to the diagnostics handler.
+type DurationTrace interface {
+	// Complete indicates a successful completion of the measured duration activity
+	Complete()
+
+	// Fail indicates an unsuccessful completion of the measured duration activity
+	Fail(statusCode string)
+
+	// CompleteWithStatus indicates a successful completion of the measured duration activity with a status code other than "OK"
+	CompleteWithStatus(statusCode string)
+
+	// SetStatusCode indicates the completion of the measured duration activity with a numeric status code, such as an HTTP status code,
+	// which is successful or not as classified by IsSuccessStatusCode
+	SetStatusCode(code int)
+
+	// Done indicates that the trace is complete and should be committed to the telemetry source. If neither Complete nor Fail (nor their
+	// variants) was called first, the trace is reported as incomplete.
+	Done()
+
+	// DoneAt indicates that the trace ended at the specified time and should be committed to the telemetry source
+	DoneAt(end time.Time)
+
+	// Finished indicates whether the trace is done
+	Finished() bool
+
+	// Duration returns the time taken by the measured duration activity, which is the time elapsed so far until the trace is done
+	Duration() time.Duration
+
+	// StartChild starts the trace of a named phase of the measured duration activity, as an in-process dependency which records this trace
+	// as its parent
+	StartChild(name string) DurationTrace
+
+	// SetProperty sets a custom named value of the measured duration activity
+	SetProperty(name string, value string)
+
+	// SetMeasurement sets a custom named numeric measurement of the measured duration activity
+	SetMeasurement(name string, value float64)
+
+	// SetSource sets the source of a request, when it is only known once the request has started. It is ignored by other traces.
+	SetSource(source string)
+
+	// SetURL sets the full URL of a request, when it is only known once the request has started. It is ignored by other traces.
+	SetURL(url string)
+
+	// SetData sets the command of a dependency call, when it is only known once the call has started. It is ignored by other traces.
+	SetData(data string)
+
+	// SetRunLocation sets where an availability test ran, when it is only known once the test has started. It is ignored by other traces.
+	SetRunLocation(location string)
+}
+
+// ErrTraceDone is reported through the diagnostics handler when a duration trace is used after it is done
+var ErrTraceDone = v1.ErrTraceDone
+
+const (
+	// IncompleteStatusCode is the status code of a trace which is done without being completed or failed
+	IncompleteStatusCode = v1.IncompleteStatusCode
+
+	// ErrorStatusCode is the status code with which End fails a trace whose function returned an error
+	ErrorStatusCode = v1.ErrorStatusCode
+
+	// PanicStatusCode is the status code with which End fails a trace whose function panicked
+	PanicStatusCode = v1.PanicStatusCode
+)
+
+// IsSuccessStatusCode indicates whether a numeric status code is successful, i.e. below 400
+func IsSuccessStatusCode(code int) bool {
+	return v1.IsSuccessStatusCode(code)
+}
+
+// SetDiagnosticsHandler sets the function which is called with the errors in the use of the telemetry which are otherwise ignored, such as
+// ErrTraceDone. It is shared with version 1.
+func SetDiagnosticsHandler(handler func(err error)) {
+	v1.SetDiagnosticsHandler(handler)
+}
+
+// End completes the trace, or fails it with ErrorStatusCode if the error that err points to is not nil, and then marks it as done. It is
+// meant to be deferred with the named error result of the traced function:
+//
+//	func loadOrders(ctx context.Context) (err error) {
+//		defer telemetry.End(telemetry.TrackDependency(ctx, telemetry.Dependency{Name: "orders", Type: "SQL", Target: "server"}), &err)
+//		...
+//	}
+//
+// The text of the error is set as the "error" property. When End is deferred directly, a panic in the function is recovered, recorded as
+// the "panic" property of a trace failed with PanicStatusCode, and then continued once the trace is done.
+func End(trace DurationTrace, err *error) {
+	if r := recover(); r != nil {
+		trace.SetProperty("panic", fmt.Sprint(r))
+		trace.Fail(PanicStatusCode)
+		trace.Done()
+
+		panic(r)
+	}
+
+	if err != nil && *err != nil {
+		trace.SetProperty("error", (*err).Error())
+		trace.Fail(ErrorStatusCode)
+	} else {
+		trace.Complete()
+	}
+
+	trace.Done()
+}
+
+// TraceState keeps whether a duration trace is done, and when it started and ended, on behalf of the implementations of DurationTrace,
+// which embed it to be safe for concurrent use and committed only once, as in version 1
+type TraceState = v1.TraceState
+
+// Clock provides the current time to trace listeners and duration traces
+type Clock = v1.Clock
+
+// NewTraceState creates the state of a trace of the described activity, e.g. "request GET /orders", which started at the time given, by
+// the clock
+func NewTraceState(description string, clock Clock, start time.Time) TraceState {
+	return v1.NewTraceState(description, clock, start)
+}
+
+type noopDurationTrace struct{}
+
+// NoopDurationTrace returns a DurationTrace which records nothing, for activities which are not traced. It is never finished, and its
+// duration is zero.
+func NoopDurationTrace() DurationTrace {
+	return noopDurationTrace{}
+}
+
+func (noopDurationTrace) Complete() {}
+
+func (noopDurationTrace) Fail(statusCode string) {}
+
+func (noopDurationTrace) CompleteWithStatus(statusCode string) {}
+
+func (noopDurationTrace) SetStatusCode(code int) {}
+
+func (noopDurationTrace) Done() {}
+
+func (noopDurationTrace) DoneAt(end time.Time) {}
+
+func (noopDurationTrace) Finished() bool {
+	return false
+}
+
+func (noopDurationTrace) Duration() time.Duration {
+	return 0
+}
+
+func (noopDurationTrace) StartChild(name string) DurationTrace {
+	return noopDurationTrace{}
+}
+
+func (noopDurationTrace) SetProperty(name string, value string) {}
+
+func (noopDurationTrace) SetMeasurement(name string, value float64) {}
+
+func (noopDurationTrace) SetSource(source string) {}
+
+func (noopDurationTrace) SetURL(url string) {}
+
+func (noopDurationTrace) SetData(data string) {}
+
+func (noopDurationTrace) SetRunLocation(location string) {}
@@ -0,0 +1,193 @@
+package telemetry
+
+import "time"
+
+// Request describes a tracked service request. Method and URI are required; the other fields are optional.
+type Request struct {
+	// Method is the method of the request, e.g. "GET"
+	Method string
+
+	// URI is the URI of the request, which may be a route template such as "/orders/{id}"
+	URI string
+
+	// Source identifies the caller, e.g. the ID of the calling application
+	Source string
+
+	// URL is the full URL of the request, when it differs from the URI
+	URL string
+
+	// Timestamp is when the request started. Zero means now.
+	Timestamp time.Time
+
+	// Properties are custom named values of the request
+	Properties map[string]string
+
+	// Measurements are custom named numeric values of the request
+	Measurements map[string]float64
+}
+
+// Dependency describes a tracked call to an external service dependency. Name is required; the other fields are optional.
+type Dependency struct {
+	// Name is the name of the call, e.g. "GetOrders"
+	Name string
+
+	// Type is the type of the dependency, e.g. "SQL" or "HTTP"
+	Type string
+
+	// Target is the server called, e.g. the host name
+	Target string
+
+	// Data is the command of the call, e.g. the SQL statement or the full URL called
+	Data string
+
+	// Timestamp is when the call started. Zero means now.
+	Timestamp time.Time
+
+	// Properties are custom named values of the call
+	Properties map[string]string
+
+	// Measurements are custom named numeric values of the call
+	Measurements map[string]float64
+}
+
+// Availability describes a tracked availability test. Name is required; the other fields are optional.
+type Availability struct {
+	// Name is the name of the test
+	Name string
+
+	// RunLocation is where the test ran
+	RunLocation string
+
+	// Timestamp is when the test started. Zero means now.
+	Timestamp time.Time
+
+	// Properties are custom named values of the test
+	Properties map[string]string
+
+	// Measurements are custom named numeric values of the test
+	Measurements map[string]float64
+}
+
+// Event describes a named event. Name is required; the other fields are optional.
+type Event struct {
+	// Name is the name of the event
+	Name string
+
+	// Timestamp is when the event happened. Zero means now.
+	Timestamp time.Time
+
+	// Properties are custom named values of the event
+	Properties map[string]string
+
+	// Measurements are custom named numeric values of the event
+	Measurements map[string]float64
+}
+
+// Metric describes a named single-valued metric. Name is required; the other fields are optional.
+type Metric struct {
+	// Name is the name of the metric
+	Name string
+
+	// Value is the value of the metric
+	Value float64
+
+	// Timestamp is when the value was measured. Zero means now.
+	Timestamp time.Time
+
+	// Properties are custom named values of the metric
+	Properties map[string]string
+}
+
+// item converts the request to the Item passed to the listeners, as part of the operation
+func (r *Request) item(operationID string) *Item {
+	return &Item{
+		Kind:         RequestItem,
+		OperationID:  operationID,
+		Timestamp:    r.Timestamp,
+		Method:       r.Method,
+		URI:          r.URI,
+		Properties:   r.Properties,
+		Measurements: r.Measurements,
+	}
+}
+
+// start sets the details of the request which are given to the trace rather than the item, so that every listener records them
+func (r *Request) start(trace DurationTrace) DurationTrace {
+	if r.Source != "" {
+		trace.SetSource(r.Source)
+	}
+
+	if r.URL != "" {
+		trace.SetURL(r.URL)
+	}
+
+	return trace
+}
+
+// item converts the call to the Item passed to the listeners, as part of the operation
+func (d *Dependency) item(operationID string) *Item {
+	return &Item{
+		Kind:           DependencyItem,
+		OperationID:    operationID,
+		Timestamp:      d.Timestamp,
+		Name:           d.Name,
+		DependencyType: d.Type,
+		Target:         d.Target,
+		Properties:     d.Properties,
+		Measurements:   d.Measurements,
+	}
+}
+
+// start sets the details of the call which are given to the trace rather than the item, so that every listener records them
+func (d *Dependency) start(trace DurationTrace) DurationTrace {
+	if d.Data != "" {
+		trace.SetData(d.Data)
+	}
+
+	return trace
+}
+
+// item converts the test to the Item passed to the listeners, as part of the operation
+func (a *Availability) item(operationID string) *Item {
+	return &Item{
+		Kind:         AvailabilityItem,
+		OperationID:  operationID,
+		Timestamp:    a.Timestamp,
+		Name:         a.Name,
+		Properties:   a.Properties,
+		Measurements: a.Measurements,
+	}
+}
+
+// start sets the details of the test which are given to the trace rather than the item, so that every listener records them
+func (a *Availability) start(trace DurationTrace) DurationTrace {
+	if a.RunLocation != "" {
+		trace.SetRunLocation(a.RunLocation)
+	}
+
+	return trace
+}
+
+// item converts the event to the Item passed to the listeners, as part of the operation
+func (e *Event) item(operationID string) *Item {
+	return &Item{
+		Kind:         EventItem,
+		OperationID:  operationID,
+		Timestamp:    e.Timestamp,
+		Name:         e.Name,
+		Properties:   e.Properties,
+		Measurements: e.Measurements,
+	}
+}
+
+// item converts the metric to the Item passed to the listeners, as part of the operation
+func (m *Metric) item(operationID string) *Item {
+	return &Item{
+		Kind:        MetricItem,
+		OperationID: operationID,
+		Timestamp:   m.Timestamp,
+		Name:        m.Name,
+		Value:       m.Value,
+		Properties:  m.Properties,
+	}
+}
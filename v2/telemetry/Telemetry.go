@@ -0,0 +1,162 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// Options configures the telemetry of an application in a single call to Start. Fields may be added in later minor versions, so the
+// options should be set by name.
+type Options struct {
+	// Listeners are the destinations of the telemetry
+	Listeners []TraceListener
+
+	// Processors run in order on every item before it reaches the listeners
+	Processors []Processor
+
+	// Dispatch, if set, starts asynchronous dispatch with the options, so that items are delivered to the listeners by worker goroutines
+	Dispatch *DispatchOptions
+}
+
+// Start adds the listeners and processors of the options, and starts asynchronous dispatch if it is configured. Close undoes it.
+func Start(options Options) {
+	for _, processor := range options.Processors {
+		AddProcessor(processor)
+	}
+
+	for _, listener := range options.Listeners {
+		AddListener(listener)
+	}
+
+	if options.Dispatch != nil {
+		v1.StartAsyncDispatch(*options.Dispatch)
+	}
+}
+
+// AddListener adds a trace listener to the list of all listeners, which is shared with version 1
+func AddListener(listener TraceListener) {
+	adapted := ToV1Listener(listener)
+	v1.AddListener(&adapted)
+}
+
+// AddProcessor adds a Processor to the pipeline which every item passes through before reaching the listeners. Processors run in the order
+// they are added.
+func AddProcessor(processor Processor) {
+	v1.AddProcessor(processor)
+}
+
+// WithOperationID returns a copy of the context which carries the operation ID
+func WithOperationID(ctx context.Context, operationID string) context.Context {
+	return v1.WithOperationID(ctx, operationID)
+}
+
+// OperationIDFromContext returns the operation ID carried by the context, or an empty string if there is none
+func OperationIDFromContext(ctx context.Context) string {
+	return v1.OperationIDFromContext(ctx)
+}
+
+// TraceMessage writes a message with the specified severity to the trace listeners, as part of the operation carried by the context
+func TraceMessage(ctx context.Context, message string, severity Severity) {
+	v1.TraceItem(&Item{Kind: MessageItem, OperationID: OperationIDFromContext(ctx), Message: message, Severity: severity})
+}
+
+// TraceException traces the error to the trace listeners, as part of the operation carried by the context
+func TraceException(ctx context.Context, err error) {
+	v1.TraceItem(&Item{Kind: ExceptionItem, OperationID: OperationIDFromContext(ctx), Err: err})
+}
+
+// TracePanic recovers any panic which is being thrown and traces its value to the trace listeners as a critical message, continuing the
+// panic if rethrow is set, once the listeners have been flushed. It only recovers a panic when it is deferred directly, e.g.
+//
+//	defer telemetry.TracePanic(true)
+func TracePanic(rethrow bool) {
+	if r := recover(); r != nil {
+		v1.TraceItem(&Item{Kind: MessageItem, Message: fmt.Sprint(r), Severity: Critical})
+
+		if rethrow {
+			v1.Flush()
+			panic(r)
+		}
+	}
+}
+
+// TraceMetric traces the metric to the trace listeners, as part of the operation carried by the context
+func TraceMetric(ctx context.Context, metric Metric) {
+	v1.TraceItem(metric.item(OperationIDFromContext(ctx)))
+}
+
+// TraceEvent traces the event to the trace listeners, as part of the operation carried by the context
+func TraceEvent(ctx context.Context, event Event) {
+	v1.TraceItem(event.item(OperationIDFromContext(ctx)))
+}
+
+// Trace traces a message, exception, metric or event item to the trace listeners
+func Trace(item *Item) {
+	v1.TraceItem(item)
+}
+
+// TrackRequest creates a tracking of the service request. The request joins the operation carried by the context, or starts a new
+// operation if there is none; the returned context carries the operation for the request's dependencies.
+func TrackRequest(ctx context.Context, request Request) (context.Context, DurationTrace) {
+	operationID := OperationIDFromContext(ctx)
+
+	if operationID == "" {
+		operationID = v1.NewOperationID()
+		ctx = WithOperationID(ctx, operationID)
+	}
+
+	return ctx, request.start(Track(request.item(operationID)))
+}
+
+// TrackDependency creates a tracking of the call to the external service dependency, as part of the operation carried by the context
+func TrackDependency(ctx context.Context, dependency Dependency) DurationTrace {
+	return dependency.start(Track(dependency.item(OperationIDFromContext(ctx))))
+}
+
+// TrackAvailability creates a tracking of the availability test, as part of the operation carried by the context
+func TrackAvailability(ctx context.Context, availability Availability) DurationTrace {
+	return availability.start(Track(availability.item(OperationIDFromContext(ctx))))
+}
+
+// Track creates a tracking of a request, dependency or availability item
+func Track(item *Item) DurationTrace {
+	return FromV1Trace(v1.TrackItem(item))
+}
+
+// TrackRequestFunc tracks the handling of the service request by fn, which is given the context carrying the request's operation, as by
+// TrackRequest. The trace is ended with the error returned by fn, which is returned, as by End.
+func TrackRequestFunc(ctx context.Context, request Request, fn func(ctx context.Context) error) (err error) {
+	ctx, trace := TrackRequest(ctx, request)
+	defer End(trace, &err)
+
+	return fn(ctx)
+}
+
+// TrackDependencyFunc tracks the call of the external service dependency made by fn, as part of the operation carried by the context. The
+// trace is ended with the error returned by fn, which is returned, as by End.
+func TrackDependencyFunc(ctx context.Context, dependency Dependency, fn func(ctx context.Context) error) (err error) {
+	defer End(TrackDependency(ctx, dependency), &err)
+
+	return fn(ctx)
+}
+
+// TrackAvailabilityFunc tracks the availability test run by fn, as part of the operation carried by the context. The trace is ended with
+// the error returned by fn, which is returned, as by End.
+func TrackAvailabilityFunc(ctx context.Context, availability Availability, fn func(ctx context.Context) error) (err error) {
+	defer End(TrackAvailability(ctx, availability), &err)
+
+	return fn(ctx)
+}
+
+// Flush causes all trace listeners to flush their data to their respective providers, after any items queued for asynchronous dispatch
+// have been delivered
+func Flush() {
+	v1.Flush()
+}
+
+// Close stops any asynchronous dispatch, closes all trace listeners and removes the references to them and to the processors
+func Close() {
+	v1.Close()
+}
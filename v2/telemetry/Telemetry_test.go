@@ -0,0 +1,182 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	v1 "github.com/phbarton/Telemetry-Go/telemetry"
+	"github.com/phbarton/Telemetry-Go/telemetry/telemetrytest"
+)
+
+const (
+	checkMark = "\u2713"
+	ballotX   = "\u2717"
+)
+
+// itemListener is a TraceListener of this version which records the items passed to it
+type itemListener struct {
+	mutex sync.Mutex
+	items []Item
+}
+
+func (il *itemListener) Trace(item *Item) {
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+
+	il.items = append(il.items, *item)
+}
+
+func (il *itemListener) Track(item *Item) DurationTrace {
+	il.Trace(item)
+
+	return NoopDurationTrace()
+}
+
+func (il *itemListener) TracePanic(rethrow bool) {}
+
+func (il *itemListener) Flush() {}
+
+func (il *itemListener) Close() {}
+
+func TestVersion1ListenersRecordTheTelemetryOfThisVersion(t *testing.T) {
+	defer Close()
+
+	t.Log("Given a version 1 Recorder started through FromV1Listener")
+	{
+		recorder := telemetrytest.NewRecorder()
+		Start(Options{Listeners: []TraceListener{FromV1Listener(recorder)}})
+
+		t.Log("\tWhen a request with a failing dependency is tracked from option structs")
+		{
+			failure := errors.New("connection refused")
+
+			err := TrackRequestFunc(context.Background(), Request{Method: "GET", URI: "/orders", Source: "web"}, func(ctx context.Context) error {
+				TraceEvent(ctx, Event{Name: "validated", Properties: map[string]string{"tenant": "contoso"}})
+
+				return TrackDependencyFunc(ctx, Dependency{Name: "db", Type: "SQL", Target: "server", Data: "SELECT 1"}, func(ctx context.Context) error {
+					return failure
+				})
+			})
+
+			requests, dependencies, events := recorder.Requests(), recorder.Dependencies(), recorder.Events()
+
+			if err == failure && len(requests) == 1 && requests[0].Source == "web" && requests[0].StatusCode == ErrorStatusCode && requests[0].Finished {
+				t.Logf("\t\t[%v] The request is recorded with its details and outcome.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The request is recorded with its details and outcome. Actual: %v, %+v", ballotX, err, requests)
+			}
+
+			if len(dependencies) == 1 && dependencies[0].Data == "SELECT 1" && dependencies[0].Properties["error"] == "connection refused" &&
+				dependencies[0].OperationID == requests[0].OperationID && requests[0].OperationID != "" {
+				t.Logf("\t\t[%v] The dependency is recorded with its error, in the request's operation.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The dependency is recorded with its error, in the request's operation. Actual: %+v", ballotX, dependencies)
+			}
+
+			if len(events) == 1 && events[0].Properties["tenant"] == "contoso" && events[0].OperationID == requests[0].OperationID {
+				t.Logf("\t\t[%v] The event is recorded with its properties.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The event is recorded with its properties. Actual: %+v", ballotX, events)
+			}
+		}
+
+		t.Log("\tWhen a child trace is started from a trace passed by value")
+		{
+			_, request := TrackRequest(context.Background(), Request{Method: "GET", URI: "/invoices"})
+			child := request.StartChild("render")
+			child.Complete()
+			child.Done()
+			request.Complete()
+			request.Done()
+
+			traces := recorder.Traces()
+			parent, phase := traces[len(traces)-2], traces[len(traces)-1]
+
+			if phase.Name == "render" && phase.ParentID != "" && phase.ParentID == parent.ID && child.Finished() && request.Finished() {
+				t.Logf("\t\t[%v] The child is recorded with the request as its parent.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The child is recorded with the request as its parent. Actual: %+v, %+v", ballotX, parent, phase)
+			}
+		}
+	}
+}
+
+func TestListenersOfThisVersionReceiveVersion1Telemetry(t *testing.T) {
+	defer Close()
+
+	t.Log("Given a listener of this version added by version 1 code through ToV1Listener")
+	{
+		listener := &itemListener{}
+		adapted := ToV1Listener(listener)
+		v1.AddListener(&adapted)
+
+		t.Log("\tWhen version 1 code traces a message and a dependency")
+		{
+			v1.TraceWarning("Disk nearly full")
+			dependency := v1.TrackDependency("db", "SQL", "server")
+			(*dependency).Complete()
+			(*dependency).Done()
+
+			if len(listener.items) == 2 && listener.items[0].Message == "Disk nearly full" && listener.items[1].Kind == DependencyItem &&
+				listener.items[1].DependencyType == "SQL" {
+				t.Logf("\t\t[%v] The listener receives the items.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The listener receives the items. Actual: %+v", ballotX, listener.items)
+			}
+		}
+
+		t.Log("\tWhen the adapted listener is adapted back")
+		{
+			if FromV1Listener(adapted) == TraceListener(listener) {
+				t.Logf("\t\t[%v] The original listener is returned.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The original listener is returned.", ballotX)
+			}
+		}
+	}
+}
+
+func TestTracePanicRecordsTheRecoveredPanic(t *testing.T) {
+	defer Close()
+
+	t.Log("Given a listener of this version")
+	{
+		listener := &itemListener{}
+		Start(Options{Listeners: []TraceListener{listener}})
+
+		t.Log("\tWhen a function which defers TracePanic without rethrowing panics")
+		{
+			func() {
+				defer TracePanic(false)
+
+				panic("out of orders")
+			}()
+
+			if len(listener.items) == 1 && listener.items[0].Message == "out of orders" && listener.items[0].Severity == Critical {
+				t.Logf("\t\t[%v] The panic is recovered and traced as a critical message.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The panic is recovered and traced as a critical message. Actual: %+v", ballotX, listener.items)
+			}
+		}
+
+		t.Log("\tWhen a function which defers TracePanic with rethrowing panics")
+		{
+			var rethrown any
+
+			func() {
+				defer func() { rethrown = recover() }()
+				defer TracePanic(true)
+
+				panic("out of invoices")
+			}()
+
+			if rethrown == "out of invoices" && len(listener.items) == 2 && listener.items[1].Message == "out of invoices" {
+				t.Logf("\t\t[%v] The panic is traced and then continued.", checkMark)
+			} else {
+				t.Errorf("\t\t[%v] The panic is traced and then continued. Actual: %v, %+v", ballotX, rethrown, listener.items)
+			}
+		}
+	}
+}
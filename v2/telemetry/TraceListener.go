@@ -0,0 +1,89 @@
+// Package telemetry is version 2 of the telemetry API, in which trace listeners and duration traces are passed by value rather than as
+// pointers to interfaces, and the details of each item are given by an option struct rather than by positional arguments and setters.
+//
+// It runs on the same pipeline as version 1, so processors, sampling and asynchronous dispatch apply to both, and the items traced by
+// either version reach the listeners added by either. The listeners in the version 1 packages, such as stream and appinsights, are used
+// through FromV1Listener, and the listeners written for this version are passed to version 1 code through ToV1Listener, so that an
+// application can migrate one call site at a time.
+package telemetry
+
+import (
+	v1 "github.com/phbarton/Telemetry-Go/telemetry"
+)
+
+// Item is a single unit of telemetry on its way to the trace listeners, which is shared with version 1
+type Item = v1.Item
+
+// ItemKind identifies the kind of telemetry carried by an Item
+type ItemKind = v1.ItemKind
+
+// Severity is the severity level of a traced message
+type Severity = v1.Severity
+
+// Processor inspects each item before it reaches the trace listeners, which is shared with version 1
+type Processor = v1.Processor
+
+// ProcessorFunc adapts an ordinary function to the Processor interface
+type ProcessorFunc = v1.ProcessorFunc
+
+// DispatchOptions configures asynchronous dispatch
+type DispatchOptions = v1.DispatchOptions
+
+const (
+	// MessageItem represents a message traced with a severity
+	MessageItem = v1.MessageItem
+
+	// ExceptionItem represents a traced error
+	ExceptionItem = v1.ExceptionItem
+
+	// MetricItem represents a named single-valued metric
+	MetricItem = v1.MetricItem
+
+	// EventItem represents a named event
+	EventItem = v1.EventItem
+
+	// RequestItem represents a tracked service request
+	RequestItem = v1.RequestItem
+
+	// DependencyItem represents a tracked call to an external service dependency
+	DependencyItem = v1.DependencyItem
+
+	// AvailabilityItem represents a tracked availability test
+	AvailabilityItem = v1.AvailabilityItem
+)
+
+const (
+	// Verbose represents a verbose message, typically for debugging
+	Verbose = v1.Verbose
+
+	// Information represents an informational message
+	Information = v1.Information
+
+	// Warning represents a message of interest that is not critical to the application's ability to function
+	Warning = v1.Warning
+
+	// Error represents a message that an exceptional condition has occured but has not caused the application to fail
+	Error = v1.Error
+
+	// Critical represents a message that an exceptional condition has occured which has caused the application to fail
+	Critical = v1.Critical
+)
+
+// TraceListener is the interface implemented by the destinations of the telemetry. Every item is passed as an Item, so a listener records
+// whatever it supports of it, and new kinds of detail do not change the interface. Listeners must not modify the items they are given.
+type TraceListener interface {
+	// Trace records a message, exception, metric or event item
+	Trace(item *Item)
+
+	// Track creates a tracking of a request, dependency or availability item
+	Track(item *Item) DurationTrace
+
+	// TracePanic records any panic which is being recovered, continuing it if rethrow is set. It must be called from a deferred function.
+	TracePanic(rethrow bool)
+
+	// Flush sends any buffered telemetry
+	Flush()
+
+	// Close flushes the listener and releases its resources
+	Close()
+}